@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/linuxsuren/atest-mcp-server/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configOption holds the flags which could override the config file
+type configOption struct {
+	configFile    string
+	port          int
+	runnerAddress string
+	mode          string
+	logLevel      string
+	logFormat     string
+	bind          string
+	tlsCert       string
+	tlsKey        string
+	tlsSelfSigned bool
+	corsOrigins   []string
+}
+
+func (o *configOption) addFlags(flags *pflag.FlagSet) {
+	defaultConfig := pkg.NewDefaultConfig()
+	flags.StringVarP(&o.configFile, "config", "c", "", "The config file in YAML or JSON format, or set via env "+pkg.EnvPrefix+"CONFIG")
+	flags.IntVarP(&o.port, "port", "p", defaultConfig.Transport.Port, "The port to run server")
+	flags.StringVarP(&o.runnerAddress, "runner-address", "", "", "The address of the runner")
+	flags.StringVarP(&o.mode, "mode", "m", defaultConfig.Transport.Mode, "The mode: http, stdio or sse, or a comma separated list of them to serve simultaneously, such as http,sse")
+	flags.StringVarP(&o.bind, "bind", "", defaultConfig.Transport.Bind, "The address to bind, such as 127.0.0.1. All interfaces are bound if it's empty")
+	flags.StringVarP(&o.tlsCert, "tls-cert", "", "", "The certificate file to serve HTTPS")
+	flags.StringVarP(&o.tlsKey, "tls-key", "", "", "The private key file to serve HTTPS")
+	flags.BoolVarP(&o.tlsSelfSigned, "tls-self-signed", "", false, "Serve HTTPS with a generated self-signed certificate, it's for local development")
+	flags.StringSliceVarP(&o.corsOrigins, "cors-origins", "", nil, "The origins allowed to access the server from browser, such as http://localhost:3000")
+	flags.StringVarP(&o.logLevel, "log-level", "", defaultConfig.Log.Level, "The log level: debug, info, warn or error")
+	flags.StringVarP(&o.logFormat, "log-format", "", defaultConfig.Log.Format, "The log format: text or json")
+}
+
+// loadConfig merges and validates the config
+func (o *configOption) loadConfig(flags *pflag.FlagSet) (config *pkg.Config, err error) {
+	if config, err = o.mergeConfig(flags); err == nil {
+		if err = config.Validate(); err != nil {
+			err = fmt.Errorf("invalid config:\n%w", err)
+		}
+	}
+	return
+}
+
+// mergeConfig merges the config in order: defaults, config file, environment variables, flags
+func (o *configOption) mergeConfig(flags *pflag.FlagSet) (config *pkg.Config, err error) {
+	configFile := o.configFile
+	if configFile == "" {
+		configFile = os.Getenv(pkg.EnvPrefix + "CONFIG")
+	}
+
+	if config, err = pkg.LoadConfig(configFile); err != nil {
+		return
+	}
+	if err = config.ApplyEnv(os.LookupEnv); err != nil {
+		return
+	}
+
+	if flags.Changed("port") {
+		config.Transport.Port = o.port
+	}
+	if flags.Changed("runner-address") {
+		config.SetDefaultRunnerAddress(o.runnerAddress)
+	}
+	if flags.Changed("mode") {
+		config.Transport.Mode = o.mode
+	}
+	if flags.Changed("bind") {
+		config.Transport.Bind = o.bind
+	}
+	if flags.Changed("tls-cert") {
+		config.Transport.TLS.CertFile = o.tlsCert
+	}
+	if flags.Changed("tls-key") {
+		config.Transport.TLS.KeyFile = o.tlsKey
+	}
+	if flags.Changed("tls-self-signed") {
+		config.Transport.TLS.SelfSigned = o.tlsSelfSigned
+	}
+	if flags.Changed("cors-origins") {
+		config.Transport.CORS.AllowedOrigins = o.corsOrigins
+	}
+	if flags.Changed("log-level") {
+		config.Log.Level = o.logLevel
+	}
+	if flags.Changed("log-format") {
+		config.Log.Format = o.logFormat
+	}
+	return
+}
+
+type configPrintOption struct {
+	configOption
+}
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage the config of the server",
+	}
+	cmd.AddCommand(newConfigPrintCommand())
+	return cmd
+}
+
+func newConfigPrintCommand() *cobra.Command {
+	opt := configPrintOption{}
+	cmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective config which merges the config file, environment variables and flags, the credentials are masked",
+		RunE:  opt.runE,
+	}
+	opt.addFlags(cmd.Flags())
+	return cmd
+}
+
+// runE prints the config even if it's invalid, then an incomplete config can be debugged.
+// The problems are reported to the stderr
+func (o *configPrintOption) runE(c *cobra.Command, args []string) (err error) {
+	var config *pkg.Config
+	if config, err = o.mergeConfig(c.Flags()); err != nil {
+		return
+	}
+
+	var data []byte
+	if data, err = yaml.Marshal(config.Redacted()); err == nil {
+		_, err = fmt.Fprint(c.OutOrStdout(), string(data))
+	}
+	if invalid := config.Validate(); invalid != nil && err == nil {
+		_, err = fmt.Fprintf(c.ErrOrStderr(), "invalid config:\n%v\n", invalid)
+	}
+	return
+}
@@ -6,6 +6,6 @@ func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use: "atest-mcp-server",
 	}
-	rootCmd.AddCommand(newServerCommand())
+	rootCmd.AddCommand(newServerCommand(), newConfigCommand(), newVersionCommand())
 	return rootCmd
 }
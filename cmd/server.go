@@ -1,24 +1,40 @@
 package cmd
 
 import (
+	"cmp"
 	"context"
+	"crypto/subtle"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/linuxsuren/api-testing/pkg/mock"
 	"github.com/linuxsuren/atest-mcp-server/pkg"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 type serverOption struct {
-	port          int
-	runnerAddress string
-	mode          string
+	configOption
+	config   *pkg.Config
+	logger   *slog.Logger
+	redactor *pkg.Redactor
+	inflight inflightRequests
 
 	mockServer mock.DynamicServer
 }
@@ -31,9 +47,7 @@ func newServerCommand() *cobra.Command {
 		PreRunE: opt.preRunE,
 		RunE:    opt.runE,
 	}
-	cmd.Flags().IntVarP(&opt.port, "port", "p", 7845, "The port to run server")
-	cmd.Flags().StringVarP(&opt.runnerAddress, "runner-address", "", "", "The address of the runner")
-	cmd.Flags().StringVarP(&opt.mode, "mode", "m", "http", "The mode: http, stdio or sse")
+	opt.addFlags(cmd.Flags())
 	return cmd
 }
 
@@ -44,8 +58,12 @@ type Args struct {
 }
 
 func (o *serverOption) preRunE(c *cobra.Command, args []string) (err error) {
-	if o.runnerAddress == "" {
-		err = fmt.Errorf("the runner-address is required")
+	if o.config, err = o.loadConfig(c.Flags()); err == nil {
+		// logs always go to stderr, stdout is the channel of MCP messages in stdio mode
+		o.redactor = pkg.NewRedactor(o.config.Redact)
+		o.logger = pkg.NewLogger(o.config.Log, c.ErrOrStderr())
+		o.logger = slog.New(pkg.NewRedactHandler(o.logger.Handler(), o.redactor))
+		slog.SetDefault(o.logger)
 	}
 	return
 }
@@ -53,6 +71,9 @@ func (o *serverOption) preRunE(c *cobra.Command, args []string) (err error) {
 //go:embed data/mainPrompt.txt
 var mainPrompt string
 
+// secretsRefreshInterval is how often the secrets of the runners are loaded for the redaction
+const secretsRefreshInterval = 5 * time.Minute
+
 func (o *serverOption) runE(c *cobra.Command, args []string) (err error) {
 	opts := &mcp.ServerOptions{
 		Instructions:      "ATest Server",
@@ -63,6 +84,7 @@ func (o *serverOption) runE(c *cobra.Command, args []string) (err error) {
 		Name:  "atest-mcp-server",
 		Title: "api-testing (aka atest) MCP Server",
 	}, opts)
+	server.AddReceivingMiddleware(o.inflight.middleware)
 
 	server.AddPrompt(&mcp.Prompt{
 		Name:        "create-test-case",
@@ -104,98 +126,611 @@ func (o *serverOption) runE(c *cobra.Command, args []string) (err error) {
 		URI:         "embedded:info",
 	}, embeddedResource)
 
-	mockServer := pkg.NewRemoteMockServer(o.runnerAddress)
-	mcp.AddTool(server, &mcp.Tool{
+	runnerAddress := o.config.DefaultRunner().Address
+	sessions := pkg.NewSessionStore(server.Sessions)
+	tools := newToolRegistry(server, o.config, o.logger, o.redactor)
+	var shutdownTracing func(context.Context) error
+	if shutdownTracing, err = pkg.SetupTracing(c.Context(), o.config.Tracing); err != nil {
+		return
+	}
+	defer func() {
+		// the spans are flushed within the grace period
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), o.config.Timeouts.Shutdown)
+		defer cancel()
+		if shutdownErr := shutdownTracing(shutdownCtx); shutdownErr != nil {
+			o.logger.Warn("failed to flush the traces", "error", shutdownErr)
+		}
+	}()
+
+	pool := pkg.NewConnectionPool(
+		grpc.WithChainUnaryInterceptor(pkg.NewRetryInterceptor(o.config.Retry), pkg.NewMetricsInterceptor()),
+		pkg.NewTracingDialOption())
+	defer pool.Close()
+
+	mockServer := pkg.NewRemoteMockServer(runnerAddress, pool)
+	addTool(tools, &mcp.Tool{
 		Name:        "start-mock-server",
 		Description: "Start a mock server",
 	}, mockServer.Start)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "get-mock-config",
 		Description: "Get the mock config as YAML format",
 	}, mockServer.GetConfig)
 
-	runner := pkg.NewRunner(o.runnerAddress)
-	mcp.AddTool(server, &mcp.Tool{
+	var store pkg.RunStore
+	if o.config.Store.Enabled {
+		// the server works without the store, it might be locked by another instance
+		if store, err = pkg.NewRunStore(o.config.Store); err != nil {
+			o.logger.Warn("the runs are not recorded", "error", err)
+			err = nil
+		} else {
+			defer store.Close()
+		}
+	}
+
+	runner := pkg.NewRunner(o.config.Runners, pool, sessions)
+	run, runTestCase := runner.Run, runner.RunTestCase
+	if store != nil {
+		recorder := pkg.NewRunRecorder(store, o.config.Runners, pool, sessions, o.redactor)
+		run = pkg.RecordRun(recorder, "run", run)
+		runTestCase = pkg.RecordRun(recorder, "run-test-case", runTestCase)
+
+		records := pkg.NewRunRecordManager(store)
+		addTool(tools, &mcp.Tool{
+			Name:        "query-runs",
+			Description: "Query the runs made through this MCP server, filtered by suite, case, tool, session, status or time. The latest one comes first.",
+		}, records.QueryRuns)
+		addTool(tools, &mcp.Tool{
+			Name:        "get-run-record",
+			Description: "Get a run made through this MCP server by its ID, including the tool args, request, response and duration",
+		}, records.GetRunRecord)
+		addTool(tools, &mcp.Tool{
+			Name:        "export-runs",
+			Description: "Export the latest runs made through this MCP server as JSON Lines, filtered in the same way as query-runs, at most 1000 runs",
+		}, records.ExportRuns)
+	}
+	addTool(tools, &mcp.Tool{
 		Name:        "run",
 		Description: "Run a test case",
-	}, runner.Run)
-	mcp.AddTool(server, &mcp.Tool{
+	}, run)
+	addTool(tools, &mcp.Tool{
 		Name:        "get-suites",
 		Description: "Get all test suites",
 	}, runner.GetSuites)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "create-test-suite",
-		Description: "Create a test suite for HTTP testing. Test suite is a collection of test cases. Should put similar test cases into one suite.",
+		Description: "Create a test suite for HTTP, gRPC or GraphQL testing. Test suite is a collection of test cases. Should put similar test cases into one suite. The gRPC suite needs the proto file, protoset or server reflection in rpc.",
 	}, runner.CreateTestSuite)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "create-test-case",
 		Title:       "Create a test case",
-		Description: "Create a test case for HTTP testing. Prefer to use expectStatus, expectSchema, and expectHeaders.",
+		Description: "Create a test case for HTTP testing, or use grpc or graphql for the test case of the gRPC or GraphQL suite. Prefer to use expectStatus, expectSchema, and expectHeaders.",
 	}, runner.CreateTestCase)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "get-test-suite",
 		Description: "Get a test suite for HTTP testing",
 	}, runner.GetTestSuite)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "delete-test-suite",
 		Description: "Delete a test suite for HTTP testing",
 	}, runner.DeleteTestSuite)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "list-test-case",
 		Description: "List all test cases",
 	}, runner.ListTestCase)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "get-test-case",
 		Description: "Get a test case for HTTP testing",
 	}, runner.GetTestCase)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "run-test-case",
 		Description: "Run a test case",
-	}, runner.RunTestCase)
-	mcp.AddTool(server, &mcp.Tool{
+	}, runTestCase)
+	addTool(tools, &mcp.Tool{
 		Name:        "update-test-suite",
-		Description: "Update a test suite for HTTP testing",
+		Description: "Update a test suite for HTTP testing. The given fields are merged into the current suite and the omitted ones are kept, including the params and the API spec with the gRPC and TLS settings. The runner has no default headers, auth or description of test suite, use use-test-suite for the default headers of the session.",
 	}, runner.UpdateTestSuite)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "update-test-case",
-		Description: "Update a test case for HTTP testing",
+		Description: "Update a test case, all the fields are replaced. It is validated and gets the default headers of the session like create-test-case",
 	}, runner.UpdateTestCase)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "get-suggested-apis",
 		Description: "Get suggested APIs from swagger for HTTP testing",
 	}, runner.GetSuggestedAPIs)
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "delete-test-case",
 		Description: "Delete a test case for HTTP testing",
 	}, runner.DeleteTestCase)
+	addTool(tools, &mcp.Tool{
+		Name:        "bulk-test-cases",
+		Description: "Create, update, delete, move or duplicate multiple test cases in one call, within or across suites. It reports the result of each item, and could rollback all the changes if any item fails.",
+	}, runner.BulkTestCases)
+	addTool(tools, &mcp.Tool{
+		Name:        "duplicate-test-suite",
+		Description: "Duplicate a test suite along with its params, spec and all the test cases. It refuses to overwrite the existing target unless force is set.",
+	}, runner.DuplicateTestSuite)
+	addTool(tools, &mcp.Tool{
+		Name:        "rename-test-suite",
+		Description: "Rename a test suite. It refuses to overwrite the existing target unless force is set.",
+	}, runner.RenameTestSuite)
+	addTool(tools, &mcp.Tool{
+		Name:        "duplicate-test-case",
+		Description: "Duplicate a test case with all the request and expect fields, within or across suites. It refuses to overwrite the existing target unless force is set.",
+	}, runner.DuplicateTestCase)
+	addTool(tools, &mcp.Tool{
+		Name:        "rename-test-case",
+		Description: "Rename a test case within its suite. It refuses to overwrite the existing target unless force is set.",
+	}, runner.RenameTestCase)
+	addTool(tools, &mcp.Tool{
+		Name:        "list-history",
+		Description: "List the latest historical runs of a test case or a test suite with the time and status, the latest one comes first. It helps to find out when a test case started failing. Use offset along with limit to page through the runs.",
+	}, runner.ListHistory)
+	addTool(tools, &mcp.Tool{
+		Name:        "get-history-run",
+		Description: "Get the request, the expectation and the result of a historical run by its ID",
+	}, runner.GetHistoryRun)
+	addTool(tools, &mcp.Tool{
+		Name:        "generate-history-code",
+		Description: "Generate the code, such as curl or golang, which reproduces a historical run",
+	}, runner.GenerateHistoryCode)
+	addTool(tools, &mcp.Tool{
+		Name:        "list-code-generators",
+		Description: "List the available code generators of the runner",
+	}, runner.ListCodeGenerators)
+	addTool(tools, &mcp.Tool{
+		Name:        "explain-failure",
+		Description: "Explain why a test case failed by rerunning it or loading its last result. It reports the failed assertions (status, header, body field, schema path or verify expression) with the expected and actual values, the request which was sent, and the likely causes such as auth, wrong base URL or schema drift.",
+	}, runner.ExplainFailure)
+	addTool(tools, &mcp.Tool{
+		Name:        "infer-schema",
+		Description: "Infer a JSON schema from one or more sample JSON responses. The fields missing in some samples are optional, the types of all samples are merged, and the string formats such as date-time, date, uuid, email and uri are detected. The result can be used as the expectSchema of a test case.",
+	}, pkg.InferSchemaFromSamples)
+	addTool(tools, &mcp.Tool{
+		Name:        "validate-response",
+		Description: "Validate a JSON payload against the expectSchema of a test case, or against the given schema. It reports every violation with its JSON path, and the expected and actual values.",
+	}, runner.ValidateResponse)
+	addTool(tools, &mcp.Tool{
+		Name:        "render-template",
+		Description: "Preview a template expression used in the request fields, such as {{.param.server}}/api or {{randAlpha 6}}. It renders with the params of the given suite and the given params and env, and shows the output or the position of the error. The functions which read the files, the secrets or the DNS, and generate files are only available in the runner, and the counts and the output size are limited in the preview.",
+	}, runner.RenderTemplate)
+	addTool(tools, &mcp.Tool{
+		Name:        "list-template-functions",
+		Description: "List the functions supported by the runner with their signatures and examples. The kind is template for the request fields, or verify for the verify expressions.",
+	}, runner.ListTemplateFunctions)
+	addTool(tools, &mcp.Tool{
+		Name:        "verify-expressions",
+		Description: "Evaluate the verify expressions against the given response, or a fresh response of the test case, before saving them. It reports the result of each expression, or the compile error with its position, and the hints for the common mistakes. The response body is data, status and headers are available in the playground but not in the runner.",
+	}, runner.VerifyExpressions)
+
+	runComparer := pkg.NewRunComparer(o.config.Runners, pool, sessions, store, o.config.Diff)
+	addTool(tools, &mcp.Tool{
+		Name:        "diff-runs",
+		Description: "Compare two historical runs of a test case, or the latest two runs of all the cases in a suite, to highlight the regressions. It reports the differences of the status, status code, headers and the JSON body paths, the volatile fields like timestamps and IDs are ignored.",
+	}, runComparer.DiffRuns)
+
+	assertionSuggester := pkg.NewAssertionSuggester(o.config.Runners, pool, sessions, o.config.Diff)
+	addTool(tools, &mcp.Tool{
+		Name:        "suggest-assertions",
+		Description: "Propose the assertions of a test case from its live response or a given one: expectStatus, the stable expectHeaders, a JSON schema inferred from the body, and the verify expressions of the key fields. The volatile values like IDs and timestamps are excluded. The suggestions could be applied to the test case while keeping the existing expectations.",
+	}, assertionSuggester.SuggestAssertions)
+
+	suiteReporter := pkg.NewSuiteReporter(o.config.Runners, pool, sessions, o.config.Report, o.redactor)
+	addTool(tools, &mcp.Tool{
+		Name:        "run-test-suite",
+		Description: "Run all the test cases of a suite in order, and generate the reports in JUnit XML, HTML and Markdown, with the status, duration, failure reason, request and response of each case. The reports could be written into the configured directory.",
+	}, suiteReporter.RunTestSuite)
+
+	secretManager := pkg.NewSecretManager(o.config.Runners, pool, sessions, o.redactor)
+	// the secrets which are created out of the MCP server are masked after the next refresh
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	defer stopRefresh()
+	go func() {
+		ticker := time.NewTicker(secretsRefreshInterval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(refreshCtx, o.config.Timeouts.Default)
+			if err := secretManager.LoadSecrets(ctx); err != nil {
+				o.logger.Debug("the secrets of the runners are not loaded", "error", err)
+			}
+			cancel()
+			select {
+			case <-ticker.C:
+			case <-refreshCtx.Done():
+				return
+			}
+		}
+	}()
+	addTool(tools, &mcp.Tool{
+		Name:        "list-secrets",
+		Description: "List the secrets of the runner, the values are never returned",
+	}, secretManager.ListSecrets)
+	addTool(tools, &mcp.Tool{
+		Name:        "create-secret",
+		Description: "Create a secret in the runner, such as an API token. Reference it in the test cases by secretHeaders or {{secretValue \"name\"}} instead of putting the value into the headers. The value is masked in all the outputs.",
+	}, secretManager.CreateSecret)
+	addTool(tools, &mcp.Tool{
+		Name:        "update-secret",
+		Description: "Update the value or description of a secret in the runner",
+	}, secretManager.UpdateSecret)
+	addTool(tools, &mcp.Tool{
+		Name:        "delete-secret",
+		Description: "Delete a secret from the runner",
+	}, secretManager.DeleteSecret)
+
+	storeManager := pkg.NewStoreManager(o.config.Runners, pool, sessions, o.redactor)
+	addTool(tools, &mcp.Tool{
+		Name:        "list-store-kinds",
+		Description: "List the kinds of store supported by the runner, such as git, orm, etcd and mongodb",
+	}, storeManager.ListStoreKinds)
+	addTool(tools, &mcp.Tool{
+		Name:        "list-stores",
+		Description: "List the stores of the runner where the test suites are persisted, with the kind, address and connectivity of each store. The passwords are never returned.",
+	}, storeManager.ListStores)
+	addTool(tools, &mcp.Tool{
+		Name:        "create-store",
+		Description: "Create a store in the runner to persist the test suites in a backend such as a git repository or a database, and verify its connectivity",
+	}, storeManager.CreateStore)
+	addTool(tools, &mcp.Tool{
+		Name:        "update-store",
+		Description: "Update a store of the runner. The given fields are merged into the current store and the omitted ones are kept. It needs the approval of the user, by elicitation or by confirm.",
+	}, storeManager.UpdateStore)
+	addTool(tools, &mcp.Tool{
+		Name:        "delete-store",
+		Description: "Delete a store from the runner, the test suites in it are no longer reachable. It needs the approval of the user, by elicitation or by confirm.",
+	}, storeManager.DeleteStore)
+	addTool(tools, &mcp.Tool{
+		Name:        "verify-store",
+		Description: "Verify the connectivity of a store, and tell if it is read-only",
+	}, storeManager.VerifyStore)
+	addTool(tools, &mcp.Tool{
+		Name:        "use-store",
+		Description: "Use a store for the following suite and test case operations in this session, local is the built-in store of the runner",
+	}, storeManager.UseStore)
+
+	sessionManager := pkg.NewSessionManager(o.config.Runners, pool, sessions)
+	addTool(tools, &mcp.Tool{
+		Name:        "use-suite",
+		Description: "Use a test suite as the default one of the following tool calls in this session, along with the optional runner, store, base API and default headers",
+	}, sessionManager.UseSuite)
+	addTool(tools, &mcp.Tool{
+		Name:        "session-info",
+		Description: "Get the session-scoped defaults, such as the active test suite and runner",
+	}, sessionManager.SessionInfo)
+
+	health := pkg.NewHealthServer(runnerAddress, pool)
 
 	started := pkg.NewStarter()
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(tools, &mcp.Tool{
 		Name:        "start-atest-desktop",
 		Description: "Start atest desktop application",
 	}, started.Start)
 
-	switch o.mode {
-	case "sse":
-		handler := mcp.NewSSEHandler(func(request *http.Request) *mcp.Server {
-			return server
+	if err = tools.checkAllowlist(); err != nil {
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	modes := o.config.Transport.Modes()
+	serveErrs := make(chan error, len(modes))
+	transports := 0
+	if slices.Contains(modes, pkg.ModeHTTP) || slices.Contains(modes, pkg.ModeSSE) {
+		transports++
+		o.logger.Info("starting HTTP server", "modes", modes, "bind", o.config.Transport.Bind,
+			"port", o.config.Transport.Port, "tls", o.config.Transport.TLS.Enabled())
+		if !pkg.IsLoopback(o.config.Transport.Bind) && o.config.Auth.Token == "" {
+			o.logger.Warn("the server is reachable from the network without a token, set auth.token or bind 127.0.0.1")
+		}
+		if !pkg.IsLoopback(o.config.Transport.Bind) && len(o.config.Transport.AllowedHosts) == 0 {
+			o.logger.Info("all hosts are accepted in the Host header, set transport.allowedHosts to check it")
+		}
+		transport := o.config.Transport
+		var listener net.Listener
+		if listener, err = net.Listen("tcp", net.JoinHostPort(transport.Bind, strconv.Itoa(transport.Port))); err != nil {
+			return
+		}
+		go func() {
+			serveErrs <- o.serveHTTP(ctx, server, listener, o.newHTTPHandler(server, modes, health))
+		}()
+	}
+	if slices.Contains(modes, pkg.ModeStdio) {
+		transports++
+		o.logger.Info("starting stdio server")
+		go func() {
+			serveErrs <- o.serveStdio(ctx, server, &mcp.StdioTransport{})
+		}()
+	}
+
+	// all the transports stop once any of them fails
+	for i := 0; i < transports; i++ {
+		if serveErr := <-serveErrs; serveErr != nil {
+			err = errors.Join(err, serveErr)
+			stop()
+		}
+	}
+	return
+}
+
+// serveHTTP serves on the listener until the context is done, then it shuts down gracefully:
+// stop accepting new connections, and wait for the in-flight tool calls within the grace period
+func (o *serverOption) serveHTTP(ctx context.Context, server *mcp.Server, listener net.Listener, handler http.Handler) (err error) {
+	transport := o.config.Transport
+	httpServer := &http.Server{
+		Handler:           pkg.NewSecurityHandler(o.inflight.handler(handler), transport),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if transport.TLS.Enabled() {
+		if httpServer.TLSConfig, err = pkg.NewTLSConfig(transport.TLS, transport.Bind); err != nil {
+			_ = listener.Close()
+			return
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if httpServer.TLSConfig != nil {
+			serveErr <- httpServer.ServeTLS(listener, "", "")
+		} else {
+			serveErr <- httpServer.Serve(listener)
+		}
+	}()
+
+	select {
+	case err = <-serveErr:
+		return
+	case <-ctx.Done():
+	}
+
+	gracePeriod := o.config.Timeouts.Shutdown
+	o.logger.Info("shutting down the server", "gracePeriod", gracePeriod)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	// the long-lived SSE streams only end when their sessions are closed
+	drained := make(chan error, 1)
+	go func() {
+		drained <- drainSessions(shutdownCtx, server, &o.inflight)
+	}()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		o.logger.Warn("failed to shutdown the server gracefully, closing it", "error", err)
+		err = httpServer.Close()
+	}
+	err = errors.Join(err, <-drained)
+	return
+}
+
+// serveStdio serves until the stdin is closed or the context is done
+func (o *serverOption) serveStdio(ctx context.Context, server *mcp.Server, transport mcp.Transport) (err error) {
+	var session *mcp.ServerSession
+	if session, err = server.Connect(ctx, transport, nil); err != nil {
+		return
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- session.Wait()
+	}()
+
+	select {
+	case err = <-closed:
+		if err == nil || errors.Is(err, io.EOF) {
+			// the other transports keep serving if there are
+			o.logger.Info("stdin is closed, the stdio server exits")
+			err = nil
+		}
+	case <-ctx.Done():
+		o.logger.Info("shutting down the stdio server", "gracePeriod", o.config.Timeouts.Shutdown)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), o.config.Timeouts.Shutdown)
+		defer cancel()
+
+		err = o.inflight.wait(shutdownCtx)
+		drained := make(chan error, 1)
+		go func() {
+			drained <- session.Close()
+		}()
+		select {
+		case <-drained:
+		case <-shutdownCtx.Done():
+			err = cmp.Or(err, fmt.Errorf("timed out closing the session: %w", shutdownCtx.Err()))
+		}
+	}
+	return
+}
+
+// drainSessions waits for the in-flight requests to send their results, then closes all the MCP sessions
+func drainSessions(ctx context.Context, server *mcp.Server, inflight *inflightRequests) error {
+	// the sessions are closed anyway once the grace period is over
+	waitErr := inflight.wait(ctx)
+
+	var wg sync.WaitGroup
+	for session := range server.Sessions() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = session.Close()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return waitErr
+	case <-ctx.Done():
+		return cmp.Or(waitErr, fmt.Errorf("timed out closing the sessions: %w", ctx.Err()))
+	}
+}
+
+// inflightRequests counts the MCP requests which are being handled,
+// and the HTTP requests which are sending the results
+type inflightRequests struct {
+	count atomic.Int64
+}
+
+// handler counts the HTTP requests except the long-lived GET streams, which only end when the sessions are closed
+func (r *inflightRequests) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			r.count.Add(1)
+			defer r.count.Add(-1)
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func (r *inflightRequests) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		r.count.Add(1)
+		defer r.count.Add(-1)
+		return next(ctx, method, req)
+	}
+}
+
+// wait returns once there is no in-flight request, or the context is done
+func (r *inflightRequests) wait(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for r.count.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %d in-flight request(s): %w", r.count.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// newHTTPHandler serves the streamable HTTP on /mcp and the SSE on /sse, all of them share the same MCP server.
+// The root path serves the streamable HTTP if it's enabled, otherwise the SSE, it keeps compatible with the single mode.
+// The unknown paths are not found. The health endpoints don't require auth.
+func (o *serverOption) newHTTPHandler(server *mcp.Server, modes []string, health pkg.HealthServer) http.Handler {
+	getServer := func(request *http.Request) *mcp.Server {
+		return server
+	}
+
+	mux := http.NewServeMux()
+	health.Register(mux)
+	mux.Handle("/metrics", pkg.MetricsHandler())
+
+	var rootHandler http.Handler
+	if slices.Contains(modes, pkg.ModeSSE) {
+		rootHandler = withAuth(mcp.NewSSEHandler(getServer), o.config.Auth.Token)
+		mux.Handle("/sse", rootHandler)
+	}
+	if slices.Contains(modes, pkg.ModeHTTP) {
+		rootHandler = withAuth(mcp.NewStreamableHTTPHandler(getServer, nil), o.config.Auth.Token)
+		mux.Handle("/mcp", rootHandler)
+	}
+	// the other paths are not found
+	mux.Handle("/{$}", rootHandler)
+	return mux
+}
+
+// toolRegistry adds the tools which are allowed by the config
+type toolRegistry struct {
+	server   *mcp.Server
+	config   *pkg.Config
+	logger   *slog.Logger
+	redactor *pkg.Redactor
+	names    map[string]bool
+}
+
+func newToolRegistry(server *mcp.Server, config *pkg.Config, logger *slog.Logger, redactor *pkg.Redactor) *toolRegistry {
+	return &toolRegistry{
+		server:   server,
+		config:   config,
+		logger:   logger,
+		redactor: redactor,
+		names:    map[string]bool{},
+	}
+}
+
+func addTool[In, Out any](r *toolRegistry, tool *mcp.Tool, handler mcp.ToolHandlerFor[In, Out]) {
+	r.names[tool.Name] = true
+	if !r.config.IsToolAllowed(tool.Name) {
+		return
+	}
+
+	timeout := r.config.ToolTimeout(tool.Name)
+	mcp.AddTool(r.server, tool, func(ctx context.Context, request *mcp.CallToolRequest, args In) (
+		result *mcp.CallToolResult, out Out, err error) {
+		err = pkg.InstrumentToolCall(ctx, request, tool.Name, func(ctx context.Context) (*mcp.CallToolResult, error) {
+			// the context is cancelled when the client cancels the request,
+			// it aborts the in-flight gRPC call of the runner as well
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			logger := pkg.NewToolLogger(r.logger, request.Session, tool.Name, r.redactor)
+			ctx = pkg.WithLogger(ctx, logger)
+			logger.DebugContext(ctx, "tool call started")
+			start := time.Now()
+
+			var callErr error
+			if result, out, callErr = handler(ctx, request, args); callErr != nil {
+				callErr = wrapContextError(ctx, tool.Name, timeout, callErr)
+				logger.ErrorContext(ctx, "tool call failed", "duration", time.Since(start), "error", callErr)
+			} else {
+				logger.InfoContext(ctx, "tool call finished", "duration", time.Since(start))
+			}
+			// the secrets never leave the server, even in the error messages
+			r.redactor.Result(result)
+			out = pkg.RedactValue(r.redactor, out)
+			return result, r.redactor.Error(callErr)
 		})
-		c.Println("Starting SSE server on port:", o.port)
-		err = http.ListenAndServe(fmt.Sprintf(":%d", o.port), handler)
-	case "stdio":
-		err = server.Run(c.Context(), &mcp.StdioTransport{})
-	case "http":
-		fallthrough
-	default:
-		handler := mcp.NewStreamableHTTPHandler(func(request *http.Request) *mcp.Server {
-			return server
-		}, nil)
-		c.Println("Starting HTTP server on port:", o.port)
-		err = http.ListenAndServe(fmt.Sprintf(":%d", o.port), handler)
+		return
+	})
+}
+
+// wrapContextError explains the error if it's caused by the deadline or the cancellation
+func wrapContextError(ctx context.Context, name string, timeout time.Duration, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("tool %q timed out after %s: %w", name, timeout, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("tool %q was cancelled: %w", name, err)
+	}
+	return err
+}
+
+// checkAllowlist makes sure there is no typo in the tools allowlist
+func (r *toolRegistry) checkAllowlist() (err error) {
+	var unknown []string
+	for _, name := range r.config.Tools.Allow {
+		if !r.names[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		err = fmt.Errorf("tools.allow: unknown tools %q", unknown)
 	}
 	return
 }
 
+// withAuth requires the bearer token if it's configured
+func withAuth(handler http.Handler, token string) http.Handler {
+	if token == "" {
+		return handler
+	}
+	expected := "Bearer " + token
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
 var embeddedResources = map[string]string{
 	"info": mainPrompt,
 }
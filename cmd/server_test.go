@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/atest-mcp-server/pkg"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestWrapContextError(t *testing.T) {
+	cause := errors.New("rpc error")
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		expect string
+	}{
+		{name: "timeout", ctx: expired, expect: `tool "run" timed out after 3s: rpc error`},
+		{name: "cancelled", ctx: cancelled, expect: `tool "run" was cancelled: rpc error`},
+		{name: "other", ctx: context.Background(), expect: "rpc error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapContextError(tt.ctx, "run", 3*time.Second, cause)
+			if err.Error() != tt.expect {
+				t.Fatalf("expected %q, got %q", tt.expect, err.Error())
+			}
+			if !errors.Is(err, cause) {
+				t.Fatal("the cause should be kept")
+			}
+		})
+	}
+}
+
+func newTestServerOption(gracePeriod time.Duration) *serverOption {
+	config := pkg.NewDefaultConfig()
+	config.Transport.Bind = "127.0.0.1"
+	config.Timeouts.Shutdown = gracePeriod
+	return &serverOption{config: config, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// newTestServer creates the MCP server with a tool which takes a while, the finished calls are counted
+func newTestServer(inflight *inflightRequests) (*mcp.Server, *atomic.Int32) {
+	finished := &atomic.Int32{}
+	server := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	server.AddReceivingMiddleware(inflight.middleware)
+	mcp.AddTool(server, &mcp.Tool{Name: "slow"}, func(ctx context.Context, _ *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+			finished.Add(1)
+		case <-ctx.Done():
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "done"}}}, nil, nil
+	})
+	return server, finished
+}
+
+// callSlowTool starts the slow tool call, and waits until the server receives it
+func callSlowTool(t *testing.T, session *mcp.ClientSession) <-chan error {
+	t.Helper()
+	called := make(chan error, 1)
+	go func() {
+		_, err := session.CallTool(context.Background(), &mcp.CallToolParams{Name: "slow"})
+		called <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	return called
+}
+
+func countSessions(server *mcp.Server) (count int) {
+	for range server.Sessions() {
+		count++
+	}
+	return
+}
+
+func TestServeHTTPShutdown(t *testing.T) {
+	const gracePeriod = 3 * time.Second
+	o := newTestServerOption(gracePeriod)
+	server, finished := newTestServer(&o.inflight)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- o.serveHTTP(ctx, server, listener, o.newHTTPHandler(server, []string{pkg.ModeHTTP, pkg.ModeSSE},
+			pkg.NewHealthServer("", pkg.NewConnectionPool())))
+	}()
+
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(),
+		mcp.NewStreamableClientTransport("http://"+address+"/mcp", nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if count := countSessions(server); count != 1 {
+		t.Fatalf("expected an open session, got %d", count)
+	}
+	called := callSlowTool(t, session)
+
+	start := time.Now()
+	cancel()
+	select {
+	case err = <-served:
+		if err != nil {
+			t.Fatalf("expected the graceful shutdown, got %v", err)
+		}
+	case <-time.After(2 * gracePeriod):
+		t.Fatal("the server did not stop")
+	}
+	if elapsed := time.Since(start); elapsed >= gracePeriod {
+		t.Fatalf("the sessions should be drained within the grace period, took %s", elapsed)
+	}
+	// the client might lose the result, since it fails the session once the stream of the session is closed
+	<-called
+	if count := finished.Load(); count != 1 {
+		t.Fatal("the in-flight tool call should finish before the session is closed")
+	}
+	if count := countSessions(server); count != 0 {
+		t.Fatalf("expected the sessions closed, got %d", count)
+	}
+	if _, err = http.Get("http://" + address + "/healthz"); err == nil {
+		t.Fatal("the server should stop accepting new connections")
+	}
+}
+
+func TestServeStdioShutdown(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(cancel context.CancelFunc, session *mcp.ClientSession)
+	}{{
+		name: "context is done",
+		stop: func(cancel context.CancelFunc, _ *mcp.ClientSession) { cancel() },
+	}, {
+		name: "stdin is closed",
+		stop: func(_ context.CancelFunc, session *mcp.ClientSession) { _ = session.Close() },
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestServerOption(3 * time.Second)
+			server, _ := newTestServer(&o.inflight)
+			serverTransport, clientTransport := mcp.NewInMemoryTransports()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			served := make(chan error, 1)
+			go func() {
+				served <- o.serveStdio(ctx, server, serverTransport)
+			}()
+			session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), clientTransport, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer session.Close()
+
+			tt.stop(cancel, session)
+			select {
+			case err = <-served:
+				if err != nil {
+					t.Fatalf("expected the graceful shutdown, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the server did not stop")
+			}
+		})
+	}
+}
+
+func TestDrainSessions(t *testing.T) {
+	inflight := &inflightRequests{}
+	server, finished := newTestServer(inflight)
+	var calls []<-chan error
+	for range 2 {
+		serverTransport, clientTransport := mcp.NewInMemoryTransports()
+		if _, err := server.Connect(context.Background(), serverTransport, nil); err != nil {
+			t.Fatal(err)
+		}
+		session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), clientTransport, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Close()
+		calls = append(calls, callSlowTool(t, session))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := drainSessions(ctx, server, inflight); err != nil {
+		t.Fatal(err)
+	}
+	if count := countSessions(server); count != 0 {
+		t.Fatalf("expected the sessions closed, got %d", count)
+	}
+	for _, called := range calls {
+		if err := <-called; err != nil {
+			t.Fatalf("the in-flight tool call should finish, got %v", err)
+		}
+	}
+	if count := finished.Load(); count != 2 {
+		t.Fatalf("expected 2 finished calls, got %d", count)
+	}
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(context.Background(), serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil).Connect(context.Background(), clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	called := callSlowTool(t, session)
+	if err := drainSessions(expired, server, inflight); err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout, got %v", err)
+	}
+	<-called
+}
+
+func TestNewHTTPHandler(t *testing.T) {
+	const (
+		streamable = "Accept must contain"
+		sse        = "sessionid must be provided"
+		notFound   = "404 page not found"
+	)
+	tests := []struct {
+		name  string
+		modes []string
+		paths map[string]string
+	}{{
+		name:  "http",
+		modes: []string{pkg.ModeHTTP},
+		paths: map[string]string{"/": streamable, "/mcp": streamable, "/sse": notFound, "/unknown": notFound, "/mcp/x": notFound},
+	}, {
+		name:  "sse",
+		modes: []string{pkg.ModeSSE},
+		paths: map[string]string{"/": sse, "/mcp": notFound, "/sse": sse, "/unknown": notFound, "/sse/x": notFound},
+	}, {
+		name:  "http and sse",
+		modes: []string{pkg.ModeHTTP, pkg.ModeSSE},
+		paths: map[string]string{"/": streamable, "/mcp": streamable, "/sse": sse, "/unknown": notFound, "/index.html": notFound},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestServerOption(time.Second)
+			server, _ := newTestServer(&o.inflight)
+			handler := o.newHTTPHandler(server, tt.modes, pkg.NewHealthServer("", pkg.NewConnectionPool()))
+			for path, expected := range tt.paths {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+				if !strings.Contains(recorder.Body.String(), expected) {
+					t.Fatalf("expected %q of %s, got %d: %s", expected, path, recorder.Code, recorder.Body)
+				}
+				if (expected == notFound) != (recorder.Code == http.StatusNotFound) {
+					t.Fatalf("unexpected status %d of %s", recorder.Code, path)
+				}
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("the health endpoint should be served, got %d", recorder.Code)
+			}
+		})
+	}
+}
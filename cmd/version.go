@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/linuxsuren/atest-mcp-server/pkg"
+	"github.com/spf13/cobra"
+)
+
+type versionOption struct {
+	configOption
+	timeout time.Duration
+}
+
+func newVersionCommand() *cobra.Command {
+	opt := versionOption{}
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of the server and the connected runner",
+		RunE:  opt.runE,
+	}
+	opt.addFlags(cmd.Flags())
+	cmd.Flags().DurationVarP(&opt.timeout, "timeout", "", 3*time.Second, "The timeout of querying the runner version")
+	return cmd
+}
+
+func (o *versionOption) runE(c *cobra.Command, args []string) (err error) {
+	var config *pkg.Config
+	if config, err = o.mergeConfig(c.Flags()); err != nil {
+		return
+	}
+
+	info := pkg.VersionInfo{
+		Server: pkg.GetBuildInfo(),
+	}
+	if address := config.DefaultRunner().Address; address != "" {
+		pool := pkg.NewConnectionPool()
+		defer pool.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+		defer cancel()
+		info = pkg.NewHealthServer(address, pool).VersionInfo(ctx)
+	}
+
+	var data []byte
+	if data, err = json.MarshalIndent(info, "", "  "); err == nil {
+		_, err = fmt.Fprintln(c.OutOrStdout(), string(data))
+	}
+	return
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/linuxsuren/atest-mcp-server/pkg"
+)
+
+func TestVersionCommand(t *testing.T) {
+	// a closed port, so that the runner is unreachable
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	tests := []struct {
+		name        string
+		args        []string
+		runnerError bool
+	}{
+		{name: "without runner"},
+		{name: "unreachable runner", args: []string{"--runner-address", address, "--timeout", "200ms"}, runnerError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(pkg.EnvPrefix+"CONFIG", "")
+			t.Setenv(pkg.EnvPrefix+"RUNNER_ADDRESS", "")
+			t.Setenv(pkg.EnvPrefix+"RUNNERS", "")
+
+			buf := &bytes.Buffer{}
+			cmd := newVersionCommand()
+			cmd.SetOut(buf)
+			cmd.SetArgs(tt.args)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			var info pkg.VersionInfo
+			if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+				t.Fatalf("invalid output %s: %v", buf, err)
+			}
+			if info.Server.GoVersion == "" || info.Server.Platform == "" || info.Runner != nil ||
+				(info.RunnerError != "") != tt.runnerError {
+				t.Fatalf("unexpected version %+v", info)
+			}
+		})
+	}
+}
@@ -8,14 +8,14 @@ import (
 	"github.com/linuxsuren/api-testing/pkg/server"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"maps"
 )
 
 type Runner interface {
 	Run(ctx context.Context, request *mcp.CallToolRequest, args RunRequest) (result *mcp.CallToolResult, a any, err error)
 	GetSuites(ctx context.Context, request *mcp.CallToolRequest, args any) (
 		result *mcp.CallToolResult, data map[string]*server.Items, err error)
-	CreateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteIndentityRequest) (*mcp.CallToolResult, any, error)
+	CreateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CreateTestSuiteRequest) (*mcp.CallToolResult, any, error)
 	CreateTestCase(ctx context.Context, request *mcp.CallToolRequest, args CreateTestCaseRequest) (*mcp.CallToolResult, any, error)
 	GetTestSuite(ctx context.Context, request *mcp.CallToolRequest, args GetTestSuiteRequest) (result *mcp.CallToolResult, a any, err error)
 	UpdateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteArgs) (
@@ -34,6 +34,34 @@ type Runner interface {
 		result *mcp.CallToolResult, a any, err error)
 	DeleteTestCase(ctx context.Context, request *mcp.CallToolRequest, args TestCaseIndentityRequest) (
 		result *mcp.CallToolResult, a any, err error)
+	BulkTestCases(ctx context.Context, request *mcp.CallToolRequest, args BulkTestCaseRequest) (
+		result *mcp.CallToolResult, data BulkResult, err error)
+	DuplicateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CopyTestSuiteRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	RenameTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CopyTestSuiteRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	DuplicateTestCase(ctx context.Context, request *mcp.CallToolRequest, args CopyTestCaseRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	RenameTestCase(ctx context.Context, request *mcp.CallToolRequest, args CopyTestCaseRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	ListHistory(ctx context.Context, request *mcp.CallToolRequest, args ListHistoryRequest) (
+		result *mcp.CallToolResult, data HistoryList, err error)
+	GetHistoryRun(ctx context.Context, request *mcp.CallToolRequest, args HistoryRunRequest) (
+		result *mcp.CallToolResult, data HistoryRunDetail, err error)
+	GenerateHistoryCode(ctx context.Context, request *mcp.CallToolRequest, args HistoryCodeRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	ListCodeGenerators(ctx context.Context, request *mcp.CallToolRequest, args any) (
+		result *mcp.CallToolResult, data CodeGenerators, err error)
+	ExplainFailure(ctx context.Context, request *mcp.CallToolRequest, args ExplainFailureRequest) (
+		result *mcp.CallToolResult, data FailureDiagnosis, err error)
+	ValidateResponse(ctx context.Context, request *mcp.CallToolRequest, args ValidateResponseRequest) (
+		result *mcp.CallToolResult, data ValidationResult, err error)
+	RenderTemplate(ctx context.Context, request *mcp.CallToolRequest, args RenderTemplateRequest) (
+		result *mcp.CallToolResult, data RenderedTemplate, err error)
+	ListTemplateFunctions(ctx context.Context, request *mcp.CallToolRequest, args ListTemplateFunctionsRequest) (
+		result *mcp.CallToolResult, data TemplateFunctions, err error)
+	VerifyExpressions(ctx context.Context, request *mcp.CallToolRequest, args VerifyExpressionsRequest) (
+		result *mcp.CallToolResult, data VerifyResult, err error)
 }
 
 type TestCases struct {
@@ -41,31 +69,64 @@ type TestCases struct {
 }
 
 type gRPCRunner struct {
-	Address string
+	runners  []RunnerConfig
+	pool     ConnectionPool
+	sessions SessionStore
 }
 
-func NewRunner(address string) Runner {
+func NewRunner(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore) Runner {
 	return &gRPCRunner{
-		Address: address,
+		runners:  runners,
+		pool:     pool,
+		sessions: sessions,
 	}
 }
 
-// getConnection creates a gRPC connection to the server
-func (r *gRPCRunner) getConnection() (*grpc.ClientConn, error) {
-	return grpc.NewClient(r.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// getConnection gets the gRPC connection of the session's runner from the pool,
+// the calls on it target the store of the session
+func (r *gRPCRunner) getConnection(request *mcp.CallToolRequest) (conn grpc.ClientConnInterface, err error) {
+	state := r.session(request)
+	if address, ok := runnerAddress(r.runners, state.Runner); ok {
+		var cc *grpc.ClientConn
+		if cc, err = r.pool.Get(address); err == nil {
+			conn = withStore(cc, state.Store)
+		}
+	} else {
+		err = fmt.Errorf("runner %q is not found", state.Runner)
+	}
+	return
+}
+
+// session returns the session-scoped defaults of the tool call
+func (r *gRPCRunner) session(request *mcp.CallToolRequest) SessionState {
+	return r.sessions.Get(sessionOf(request))
 }
 
 type RunRequest struct {
-	SuiteName string `json:"suiteName" jsonschema:"the name of test suite" mcp:"the name of test suite"`
+	SuiteName string `json:"suiteName,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty" mcp:"the name of test suite"`
 	CaseName  string `json:"caseName" jsonschema:"the name of test case" mcp:"the name of test case"`
 }
 
 func (r *gRPCRunner) Run(ctx context.Context, request *mcp.CallToolRequest, args RunRequest) (result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.SuiteName == "" {
+		args.SuiteName = r.session(request).Suite
+	}
+	if args.SuiteName == "" || args.CaseName == "" {
+		err = fmt.Errorf("suiteName and caseName are required")
+		return
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
+		// the runner runs the case along with the cases it depends on in the suite
+		var suite *server.YamlData
+		if suite, err = runner.GetTestSuiteYaml(ctx, &server.TestSuiteIdentity{Name: args.SuiteName}); err != nil {
+			return
+		}
 		runReq := &server.TestTask{
+			Data:     string(suite.Data),
+			Kind:     "testcaseInSuite",
 			CaseName: args.CaseName,
 		}
 
@@ -89,8 +150,8 @@ func (r *gRPCRunner) Run(ctx context.Context, request *mcp.CallToolRequest, args
 
 func (r *gRPCRunner) GetSuites(ctx context.Context, request *mcp.CallToolRequest, args any) (
 	result *mcp.CallToolResult, data map[string]*server.Items, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		var reply *server.Suites
@@ -123,15 +184,28 @@ func objectToJSON(obj any) string {
 }
 
 type TestSuiteIndentityRequest struct {
-	Name string `json:"name" jsonschema:"the name of test suite"`
-	API  string `json:"api" jsonschema:"the API path for test suite, such as http://localhost:8080/"`
+	Name string `json:"name,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	API  string `json:"api,omitempty" jsonschema:"the API path for test suite, such as http://localhost:8080/"`
 	Kind string `json:"kind" jsonschema:"the kind of test suite, such as swagger"`
 }
 
-func (r *gRPCRunner) CreateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteIndentityRequest) (
+type CreateTestSuiteRequest struct {
+	Name string   `json:"name,omitempty" jsonschema:"the name of test suite"`
+	API  string   `json:"api,omitempty" jsonschema:"the API of test suite, such as http://localhost:8080/ for HTTP or localhost:7070 for gRPC"`
+	Kind string   `json:"kind,omitempty" jsonschema:"the kind of test suite: http (default), swagger, grpc or graphql"`
+	RPC  *RPCSpec `json:"rpc,omitempty" jsonschema:"the proto settings of the grpc suite"`
+}
+
+func (r *gRPCRunner) CreateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CreateTestSuiteRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.API == "" {
+		args.API = r.session(request).API
+	}
+	if err = args.validate(); err != nil {
+		return
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		if request.Session.InitializeParams().Capabilities.Elicitation != nil && args.Name == "" {
@@ -150,9 +224,7 @@ func (r *gRPCRunner) CreateTestSuite(ctx context.Context, request *mcp.CallToolR
 			}); err == nil && elicitResult.Content != nil {
 				args.Name = elicitResult.Content["name"].(string)
 			} else if err != nil {
-				request.Session.Log(ctx, &mcp.LoggingMessageParams{
-					Data: "get elicit failed",
-				})
+				LoggerFrom(ctx).Error("get elicit failed", "error", err)
 
 				result = &mcp.CallToolResult{
 					Content: []mcp.Content{
@@ -172,6 +244,9 @@ func (r *gRPCRunner) CreateTestSuite(ctx context.Context, request *mcp.CallToolR
 
 		var reply *server.HelloReply
 		reply, err = runner.CreateTestSuite(ctx, suite)
+		if err == nil && args.RPC != nil {
+			err = updateSuiteSpec(ctx, runner, args.Name, &APISpec{RPC: args.RPC})
+		}
 		if err == nil {
 			result = &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -193,8 +268,19 @@ func (r *gRPCRunner) CreateTestSuite(ctx context.Context, request *mcp.CallToolR
 	return
 }
 
+// withDefaultSuite fills the suite name and API with the session-scoped defaults
+func (r *gRPCRunner) withDefaultSuite(request *mcp.CallToolRequest, args *TestSuiteIndentityRequest) {
+	state := r.session(request)
+	if args.Name == "" {
+		args.Name = state.Suite
+		if args.API == "" {
+			args.API = state.API
+		}
+	}
+}
+
 type CreateTestCaseRequest struct {
-	SuiteName     string            `json:"suiteName" jsonschema:"the name of test suite"`
+	SuiteName     string            `json:"suiteName,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
 	CaseName      string            `json:"caseName" jsonschema:"the name of test case"`
 	API           string            `json:"api" jsonschema:"the API path for test case, such as /api/v1/users"`
 	Method        string            `json:"method" jsonschema:"the HTTP method for test case"`
@@ -207,16 +293,22 @@ type CreateTestCaseRequest struct {
 	ExpectBody    string            `json:"expectBody,omitempty" jsonschema:"the expected HTTP response body for test case"`
 	ExpectHeaders map[string]string `json:"expectHeaders,omitempty" jsonschema:"the expected HTTP response headers for test case"`
 	ExpectSchema  string            `json:"expectSchema,omitempty" jsonschema:"the expected HTTP response to verify as JSON schema for test case"`
+	SecretHeaders map[string]string `json:"secretHeaders,omitempty" jsonschema:"the HTTP request headers whose values are read from the secrets of the runner, the value is the name of secret, such as Authorization: api-token"`
+	GRPC          *GRPCRequest      `json:"grpc,omitempty" jsonschema:"the gRPC request, the suite should be grpc kind, api, method and body are not used"`
+	GraphQL       *GraphQLRequest   `json:"graphql,omitempty" jsonschema:"the GraphQL request, the suite should be graphql kind, it is sent as POST to the api"`
 }
 
 type GetTestSuiteRequest struct {
-	Name string `json:"name" jsonschema:"the name of test suite"`
+	Name string `json:"name,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
 }
 
 func (r *gRPCRunner) GetTestSuite(ctx context.Context, request *mcp.CallToolRequest, args GetTestSuiteRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.Name == "" {
+		args.Name = r.session(request).Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		suite := &server.TestSuiteIdentity{
@@ -238,10 +330,14 @@ func (r *gRPCRunner) GetTestSuite(ctx context.Context, request *mcp.CallToolRequ
 }
 
 type TestSuiteArgs struct {
-	Name  string   `json:"name" jsonschema:"the name of test suite"`
-	API   string   `json:"api" jsonschema:"the API path for test suite"`
-	Param []*Pair  `json:"param" jsonschema:"the params for test suite"`
-	Spec  *APISpec `json:"spec" jsonschema:"the API spec for test suite"`
+	Name         string            `json:"name,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	API          string            `json:"api,omitempty" jsonschema:"the API path for test suite, the current one is kept if it is empty"`
+	Param        []*Pair           `json:"param,omitempty" jsonschema:"the params to add or update, the other params are kept"`
+	RemoveParams []string          `json:"removeParams,omitempty" jsonschema:"the keys of params to remove"`
+	Spec         *APISpec          `json:"spec,omitempty" jsonschema:"the API spec for test suite, the omitted fields are kept"`
+	Headers      map[string]string `json:"headers,omitempty" jsonschema:"not supported by the runner, set the default headers with use-test-suite instead"`
+	Auth         any               `json:"auth,omitempty" jsonschema:"not supported by the runner, set the auth header with use-test-suite instead"`
+	Description  string            `json:"description,omitempty" jsonschema:"not supported by the runner"`
 }
 
 type Pair struct {
@@ -251,33 +347,30 @@ type Pair struct {
 }
 
 type APISpec struct {
-	Kind string `json:"kind" jsonschema:"the kind of API spec, such as swagger"`
-	Url  string `json:"url" jsonschema:"the URL of API spec, such as http://localhost:8080/swagger.json"`
+	Kind   string      `json:"kind,omitempty" jsonschema:"the kind of API spec, such as swagger"`
+	Url    string      `json:"url,omitempty" jsonschema:"the URL of API spec, such as http://localhost:8080/swagger.json"`
+	RPC    *RPCSpec    `json:"rpc,omitempty" jsonschema:"the gRPC settings"`
+	Secure *SecureSpec `json:"secure,omitempty" jsonschema:"the TLS settings"`
 }
 
 func (r *gRPCRunner) UpdateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteArgs) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.Name == "" {
+		args.Name = r.session(request).Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
-		suite := &server.TestSuite{
-			Name: args.Name,
-			Api:  args.API,
-			Spec: &server.APISpec{
-				Kind: args.Spec.Kind,
-				Url:  args.Spec.Url,
-			},
+		var suite *server.TestSuite
+		if suite, err = runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Name}); err != nil {
+			return
 		}
-
-		var reply *server.HelloReply
-		reply, err = runner.UpdateTestSuite(ctx, suite)
-		if err == nil {
-			result = &mcp.CallToolResult{
-				Content: []mcp.Content{
-					&mcp.TextContent{Text: reply.Message},
-				},
-			}
+		if err = args.mergeInto(suite); err != nil {
+			return
+		}
+		if err = replyError(runner.UpdateTestSuite(ctx, suite)); err == nil {
+			result = textResult(fmt.Sprintf("updated test suite %q", args.Name))
 		}
 	}
 	return
@@ -285,8 +378,9 @@ func (r *gRPCRunner) UpdateTestSuite(ctx context.Context, request *mcp.CallToolR
 
 func (r *gRPCRunner) DeleteTestSuite(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteIndentityRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	r.withDefaultSuite(request, &args)
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		suite := &server.TestSuiteIdentity{
@@ -309,8 +403,9 @@ func (r *gRPCRunner) DeleteTestSuite(ctx context.Context, request *mcp.CallToolR
 
 func (r *gRPCRunner) ListTestCase(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteIndentityRequest) (
 	result *mcp.CallToolResult, data TestCases, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	r.withDefaultSuite(request, &args)
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		suite := &server.TestSuiteIdentity{
@@ -318,11 +413,7 @@ func (r *gRPCRunner) ListTestCase(ctx context.Context, request *mcp.CallToolRequ
 			Api:  args.API,
 		}
 
-		request.Session.Log(ctx, &mcp.LoggingMessageParams{
-			Data:   fmt.Sprintf("list test cases from suite: %q", suite.String()),
-			Level:  "debug",
-			Logger: "runner",
-		})
+		LoggerFrom(ctx).Debug("list test cases", "suite", suite.Name, "api", suite.Api)
 
 		var reply *server.Suite
 		reply, err = runner.ListTestCase(ctx, suite)
@@ -341,15 +432,18 @@ func (r *gRPCRunner) ListTestCase(ctx context.Context, request *mcp.CallToolRequ
 }
 
 type TestCaseIndentityRequest struct {
-	Suite      string  `json:"suite" jsonschema:"the name of test suite"`
+	Suite      string  `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
 	Testcase   string  `json:"testcase" jsonschema:"the name of test case"`
 	Parameters []*Pair `json:"parameters" jsonschema:"the params for test case"`
 }
 
 func (r *gRPCRunner) RunTestCase(ctx context.Context, request *mcp.CallToolRequest, args TestCaseIndentityRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		testCase := &server.TestCaseIdentity{
@@ -360,6 +454,7 @@ func (r *gRPCRunner) RunTestCase(ctx context.Context, request *mcp.CallToolReque
 		var reply *server.TestCaseResult
 		reply, err = runner.RunTestCase(ctx, testCase)
 		if err == nil {
+			a = reply
 			result = &mcp.CallToolResult{
 				Content: []mcp.Content{
 					&mcp.TextContent{Text: reply.String()},
@@ -372,8 +467,11 @@ func (r *gRPCRunner) RunTestCase(ctx context.Context, request *mcp.CallToolReque
 
 func (r *gRPCRunner) GetTestCase(ctx context.Context, request *mcp.CallToolRequest, args TestCaseIndentityRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		testCase := &server.TestCaseIdentity{
@@ -396,35 +494,26 @@ func (r *gRPCRunner) GetTestCase(ctx context.Context, request *mcp.CallToolReque
 
 func (r *gRPCRunner) CreateTestCase(ctx context.Context, request *mcp.CallToolRequest, args CreateTestCaseRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	state := r.session(request)
+	if args.SuiteName == "" {
+		args.SuiteName = state.Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
-		testCase := &server.TestCaseWithSuite{
-			SuiteName: args.SuiteName,
-			Data: &server.TestCase{
-				Name:      args.CaseName,
-				SuiteName: args.SuiteName,
-				Request: &server.Request{
-					Api:    args.API,
-					Method: args.Method,
-					Body:   args.Body,
-					Header: convertMapToPairs(args.Headers),
-					Query:  convertMapToPairs(args.QueryParams),
-					Cookie: convertMapToPairs(args.Cookies),
-					Form:   convertMapToPairs(args.FormParams),
-				},
-				Response: &server.Response{
-					Body:       args.ExpectBody,
-					StatusCode: args.ExpectStatus,
-					Header:     convertMapToPairs(args.ExpectHeaders),
-					Schema:     args.ExpectSchema,
-				},
-			},
+		var testCase *server.TestCase
+		var problems []string
+		if testCase, problems = buildTestCase(ctx, runner, state, args); len(problems) > 0 {
+			result = invalidResult(problems)
+			return
 		}
 
 		var reply *server.HelloReply
-		reply, err = runner.CreateTestCase(ctx, testCase)
+		reply, err = runner.CreateTestCase(ctx, &server.TestCaseWithSuite{
+			SuiteName: args.SuiteName,
+			Data:      testCase,
+		})
 		if err == nil {
 			result = &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -436,6 +525,63 @@ func (r *gRPCRunner) CreateTestCase(ctx context.Context, request *mcp.CallToolRe
 	return
 }
 
+// buildTestCase validates the test case, and converts it along with the default headers of the session
+func buildTestCase(ctx context.Context, runner server.RunnerClient, state SessionState, args CreateTestCaseRequest) (
+	testCase *server.TestCase, problems []string) {
+	args.Headers = mergeHeaders(state.Headers, args.Headers)
+	if problems = args.Validate(); len(problems) > 0 {
+		return
+	}
+	// the runner reports the missing suite when saving the test case
+	if suite, err := runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.SuiteName}); err == nil {
+		if problems = args.validateAgainstSuite(suite); len(problems) > 0 {
+			return
+		}
+	}
+	testCase = args.toTestCase(args.SuiteName)
+	return
+}
+
+// toTestCase converts the request to the test case of the given suite
+func (args CreateTestCaseRequest) toTestCase(suite string) *server.TestCase {
+	testCase := &server.TestCase{
+		Name:      args.CaseName,
+		SuiteName: suite,
+		Request: &server.Request{
+			Api:    args.API,
+			Method: args.Method,
+			Body:   args.Body,
+			Header: convertMapToPairs(args.requestHeaders()),
+			Query:  convertMapToPairs(args.QueryParams),
+			Cookie: convertMapToPairs(args.Cookies),
+			Form:   convertMapToPairs(args.FormParams),
+		},
+		Response: &server.Response{
+			Body:       args.ExpectBody,
+			StatusCode: args.ExpectStatus,
+			Header:     convertMapToPairs(args.ExpectHeaders),
+			Schema:     args.ExpectSchema,
+		},
+	}
+	args.shapeRequest(testCase.Request)
+	return testCase
+}
+
+// requestHeaders returns the headers along with the ones which reference the secrets
+func (args CreateTestCaseRequest) requestHeaders() map[string]string {
+	if len(args.SecretHeaders) == 0 {
+		return args.Headers
+	}
+	headers := maps.Clone(args.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	for key, name := range args.SecretHeaders {
+		headers[key] = secretRef(name)
+	}
+	return headers
+}
+
 func convertMapToPairs(data map[string]string) []*server.Pair {
 	pairs := make([]*server.Pair, 0, len(data))
 	for k, v := range data {
@@ -447,27 +593,29 @@ func convertMapToPairs(data map[string]string) []*server.Pair {
 	return pairs
 }
 
+// UpdateTestCase replaces the test case, it is validated and gets the default headers like a new one
 func (r *gRPCRunner) UpdateTestCase(ctx context.Context, request *mcp.CallToolRequest, args CreateTestCaseRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	state := r.session(request)
+	if args.SuiteName == "" {
+		args.SuiteName = state.Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
-		testCase := &server.TestCaseWithSuite{
-			SuiteName: args.SuiteName,
-			Data: &server.TestCase{
-				Name:      args.CaseName,
-				SuiteName: args.SuiteName,
-				Request: &server.Request{
-					Api:    args.API,
-					Method: args.Method,
-					Body:   args.Body,
-				},
-			},
+		var testCase *server.TestCase
+		var problems []string
+		if testCase, problems = buildTestCase(ctx, runner, state, args); len(problems) > 0 {
+			result = invalidResult(problems)
+			return
 		}
 
 		var reply *server.HelloReply
-		reply, err = runner.UpdateTestCase(ctx, testCase)
+		reply, err = runner.UpdateTestCase(ctx, &server.TestCaseWithSuite{
+			SuiteName: args.SuiteName,
+			Data:      testCase,
+		})
 		if err == nil {
 			result = &mcp.CallToolResult{
 				Content: []mcp.Content{
@@ -481,8 +629,9 @@ func (r *gRPCRunner) UpdateTestCase(ctx context.Context, request *mcp.CallToolRe
 
 func (r *gRPCRunner) GetSuggestedAPIs(ctx context.Context, request *mcp.CallToolRequest, args TestSuiteIndentityRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	r.withDefaultSuite(request, &args)
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		suite := &server.TestSuiteIdentity{
@@ -505,8 +654,11 @@ func (r *gRPCRunner) GetSuggestedAPIs(ctx context.Context, request *mcp.CallTool
 
 func (r *gRPCRunner) DeleteTestCase(ctx context.Context, request *mcp.CallToolRequest, args TestCaseIndentityRequest) (
 	result *mcp.CallToolResult, a any, err error) {
-	var conn *grpc.ClientConn
-	if conn, err = r.getConnection(); err == nil {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
 		runner := server.NewRunnerClient(conn)
 
 		testCase := &server.TestCaseIdentity{
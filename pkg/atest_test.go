@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSaveTestCase(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  bool
+		args    CreateTestCaseRequest
+		headers map[string]string
+		problem string
+	}{{
+		name: "create with the default headers",
+		args: CreateTestCaseRequest{CaseName: "new", API: "/new", Method: "GET", ExpectStatus: 200,
+			Headers: map[string]string{"X-Trace": "off"}, SecretHeaders: map[string]string{"Authorization": "token"}},
+		headers: map[string]string{"X-Tenant": "session", "X-Trace": "off",
+			"Authorization": `{{secretValue "token"}}`},
+	}, {
+		name:   "update with the default headers",
+		update: true,
+		args: CreateTestCaseRequest{CaseName: "a", API: "/new", Method: "GET", ExpectStatus: 200,
+			SecretHeaders: map[string]string{"Authorization": "token"}},
+		headers: map[string]string{"X-Tenant": "session", "X-Trace": "on",
+			"Authorization": `{{secretValue "token"}}`},
+	}, {
+		name:    "create an invalid case",
+		args:    CreateTestCaseRequest{CaseName: "new", Method: "GET"},
+		problem: "api is required",
+	}, {
+		name:    "update an invalid case",
+		update:  true,
+		args:    CreateTestCaseRequest{CaseName: "a", API: "/a", Method: "FETCH"},
+		problem: "method \"FETCH\" is not one of",
+	}, {
+		name:    "update with an empty secret",
+		update:  true,
+		args:    CreateTestCaseRequest{CaseName: "a", API: "/a", Method: "GET", SecretHeaders: map[string]string{"Authorization": ""}},
+		problem: "should be the name of secret",
+	}, {
+		name:    "update a case of another protocol",
+		update:  true,
+		args:    CreateTestCaseRequest{SuiteName: "grpc", CaseName: "a", API: "/a", Method: "GET"},
+		problem: "but the suite \"grpc\" is grpc",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"}, &server.TestCase{Name: "a", Request: &server.Request{Api: "/a"}})
+			fake.addSuite(&server.TestSuite{Name: "grpc", Spec: &server.APISpec{Kind: "grpc"}},
+				&server.TestCase{Name: "a"})
+			runner.sessions.Set(nil, SessionState{Suite: "sample", Headers: map[string]string{"X-Tenant": "session", "X-Trace": "on"}})
+
+			save := runner.CreateTestCase
+			if tt.update {
+				save = runner.UpdateTestCase
+			}
+			result, _, err := save(context.Background(), nil, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.problem != "" {
+				if text := result.Content[0].(*mcp.TextContent).Text; !result.IsError || !strings.Contains(text, tt.problem) {
+					t.Fatalf("expected problem %q, got %q", tt.problem, text)
+				}
+				if calls := fake.callsOf("CreateTestCase") + fake.callsOf("UpdateTestCase"); calls != 0 {
+					t.Fatalf("the invalid case should not be saved")
+				}
+				return
+			}
+
+			testCase := fake.testCase("sample", tt.args.CaseName)
+			if testCase.Request.Api != tt.args.API || testCase.Response.StatusCode != tt.args.ExpectStatus {
+				t.Fatalf("unexpected test case %v", testCase)
+			}
+			for key, value := range tt.headers {
+				if actual := headerValue(testCase.Request.Header, key); actual != value {
+					t.Fatalf("expected header %s=%q, got %q", key, value, actual)
+				}
+			}
+		})
+	}
+}
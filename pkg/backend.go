@@ -0,0 +1,509 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// localStore is the built-in store of the runner, it can't be changed
+const localStore = "local"
+
+type StoreRequest struct {
+	Name        string            `json:"name" jsonschema:"the name of store"`
+	Kind        string            `json:"kind,omitempty" jsonschema:"the kind of store, such as git, orm or etcd, see list-store-kinds"`
+	KindURL     string            `json:"kindURL,omitempty" jsonschema:"the address of the store extension, the unix socket of the kind is used if it is empty"`
+	URL         string            `json:"url,omitempty" jsonschema:"the address of the backend, such as the git repository or the database"`
+	Username    string            `json:"username,omitempty" jsonschema:"the username of the backend"`
+	Password    string            `json:"password,omitempty" jsonschema:"the password of the backend, it is never returned"`
+	Description string            `json:"description,omitempty" jsonschema:"the description of store"`
+	Properties  map[string]string `json:"properties,omitempty" jsonschema:"the kind-specific properties, such as branch of git or database of orm, an empty value removes the property when updating"`
+	Confirm     bool              `json:"confirm,omitempty" jsonschema:"the user approved the change, it is only accepted if the client doesn't support elicitation, the user is asked otherwise"`
+}
+
+type DeleteStoreRequest struct {
+	Name    string `json:"name" jsonschema:"the name of store"`
+	Confirm bool   `json:"confirm,omitempty" jsonschema:"the user approved the deletion, it is only accepted if the client doesn't support elicitation, the user is asked otherwise"`
+}
+
+type StoreNameRequest struct {
+	Name string `json:"name" jsonschema:"the name of store, local is the built-in one"`
+}
+
+type StoreKindInfo struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+type StoreKindList struct {
+	Kinds []StoreKindInfo `json:"kinds"`
+}
+
+// StoreInfo is a store without its password
+type StoreInfo struct {
+	Name        string            `json:"name"`
+	Kind        string            `json:"kind,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	Ready       bool              `json:"ready"`
+	ReadOnly    bool              `json:"readOnly,omitempty"`
+}
+
+type StoreList struct {
+	Stores []StoreInfo `json:"stores"`
+}
+
+type StoreStatus struct {
+	Name     string `json:"name"`
+	Ready    bool   `json:"ready"`
+	ReadOnly bool   `json:"readOnly,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// StoreManager provides the tools to manage the stores of the runner, where the test suites are persisted
+type StoreManager interface {
+	ListStoreKinds(ctx context.Context, request *mcp.CallToolRequest, args any) (
+		result *mcp.CallToolResult, data StoreKindList, err error)
+	ListStores(ctx context.Context, request *mcp.CallToolRequest, args any) (
+		result *mcp.CallToolResult, data StoreList, err error)
+	CreateStore(ctx context.Context, request *mcp.CallToolRequest, args StoreRequest) (
+		result *mcp.CallToolResult, data StoreStatus, err error)
+	UpdateStore(ctx context.Context, request *mcp.CallToolRequest, args StoreRequest) (
+		result *mcp.CallToolResult, data StoreStatus, err error)
+	DeleteStore(ctx context.Context, request *mcp.CallToolRequest, args DeleteStoreRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	VerifyStore(ctx context.Context, request *mcp.CallToolRequest, args StoreNameRequest) (
+		result *mcp.CallToolResult, data StoreStatus, err error)
+	// UseStore makes the suite operations of the session target the store
+	UseStore(ctx context.Context, request *mcp.CallToolRequest, args StoreNameRequest) (
+		result *mcp.CallToolResult, state SessionState, err error)
+}
+
+type storeManager struct {
+	*gRPCRunner
+	redactor *Redactor
+}
+
+// NewStoreManager creates the manager, the passwords of the stores are given to the redactor
+func NewStoreManager(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, redactor *Redactor) StoreManager {
+	return &storeManager{
+		gRPCRunner: &gRPCRunner{
+			runners:  runners,
+			pool:     pool,
+			sessions: sessions,
+		},
+		redactor: redactor,
+	}
+}
+
+// WithStore makes the runner calls of the context target the store, it overrides the store set before
+func WithStore(ctx context.Context, store string) context.Context {
+	if store == "" {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(server.HeaderKeyStoreName, store)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// withStore makes the calls on the connection target the store, the local store needs no header
+func withStore(conn *grpc.ClientConn, store string) grpc.ClientConnInterface {
+	if store == "" || store == localStore {
+		return conn
+	}
+	return &storeConn{ClientConn: conn, store: store}
+}
+
+type storeConn struct {
+	*grpc.ClientConn
+	store string
+}
+
+func (c *storeConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	return c.ClientConn.Invoke(WithStore(ctx, c.store), method, args, reply, opts...)
+}
+
+func (c *storeConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.ClientConn.NewStream(WithStore(ctx, c.store), desc, method, opts...)
+}
+
+func (s *storeManager) runner(request *mcp.CallToolRequest) (runner server.RunnerClient, err error) {
+	var conn grpc.ClientConnInterface
+	if conn, err = s.getConnection(request); err == nil {
+		runner = server.NewRunnerClient(conn)
+	}
+	return
+}
+
+func (s *storeManager) ListStoreKinds(ctx context.Context, request *mcp.CallToolRequest, args any) (
+	result *mcp.CallToolResult, data StoreKindList, err error) {
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err != nil {
+		return
+	}
+	var reply *server.StoreKinds
+	if reply, err = runner.GetStoreKinds(ctx, &server.Empty{}); err != nil {
+		return
+	}
+
+	data.Kinds = make([]StoreKindInfo, 0, len(reply.Data))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d store kind(s):\n", len(reply.Data))
+	for _, kind := range reply.Data {
+		data.Kinds = append(data.Kinds, StoreKindInfo{Name: kind.Name, URL: kind.Url, Enabled: kind.Enabled})
+		fmt.Fprintf(&buf, "- %s", kind.Name)
+		if !kind.Enabled {
+			buf.WriteString(" (disabled)")
+		}
+		buf.WriteString("\n")
+	}
+	result = textResult(buf.String())
+	return
+}
+
+func (s *storeManager) ListStores(ctx context.Context, request *mcp.CallToolRequest, args any) (
+	result *mcp.CallToolResult, data StoreList, err error) {
+	var stores []*server.Store
+	if stores, err = s.stores(ctx, request); err != nil {
+		return
+	}
+
+	current := s.session(request).Store
+	data.Stores = make([]StoreInfo, 0, len(stores))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d store(s), the disabled ones are not listed:\n", len(stores))
+	for _, store := range stores {
+		info := storeInfo(store)
+		data.Stores = append(data.Stores, info)
+		fmt.Fprintf(&buf, "- %s (%s)", info.Name, info.Kind)
+		switch {
+		case !info.Ready:
+			buf.WriteString(" not ready")
+		case info.ReadOnly:
+			buf.WriteString(" read-only")
+		}
+		if info.Name == current {
+			buf.WriteString(", used by this session")
+		}
+		buf.WriteString("\n")
+	}
+	result = textResult(buf.String())
+	return
+}
+
+// stores returns the enabled stores of the runner, sorted by name
+func (s *storeManager) stores(ctx context.Context, request *mcp.CallToolRequest) (stores []*server.Store, err error) {
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err != nil {
+		return
+	}
+	var reply *server.Stores
+	if reply, err = runner.GetStores(ctx, &server.Empty{}); err == nil {
+		stores = reply.Data
+		slices.SortFunc(stores, func(a, b *server.Store) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+	return
+}
+
+func (s *storeManager) CreateStore(ctx context.Context, request *mcp.CallToolRequest, args StoreRequest) (
+	result *mcp.CallToolResult, data StoreStatus, err error) {
+	if args.Name == "" || args.Kind == "" {
+		err = errors.New("name and kind are required")
+		return
+	}
+	if args.Name == localStore {
+		err = fmt.Errorf("store %q is built-in", localStore)
+		return
+	}
+	s.redactor.AddSecrets(args.Password)
+
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err != nil {
+		return
+	}
+	// the kind is checked if the runner tells the available ones
+	if kinds, kindsErr := runner.GetStoreKinds(ctx, &server.Empty{}); kindsErr == nil && len(kinds.Data) > 0 {
+		names := make([]string, 0, len(kinds.Data))
+		for _, kind := range kinds.Data {
+			names = append(names, kind.Name)
+		}
+		if !slices.Contains(names, args.Kind) {
+			err = fmt.Errorf("not supported store kind %q, should be one of %s", args.Kind, strings.Join(names, ", "))
+			return
+		}
+	}
+
+	store := &server.Store{Name: args.Name}
+	args.mergeInto(store)
+	if _, err = runner.CreateStore(ctx, store); err == nil {
+		data = s.verify(ctx, runner, args.Name)
+		result = textResult(fmt.Sprintf("store %q is created, %s", args.Name, data))
+	}
+	return
+}
+
+func (s *storeManager) UpdateStore(ctx context.Context, request *mcp.CallToolRequest, args StoreRequest) (
+	result *mcp.CallToolResult, data StoreStatus, err error) {
+	if args.Name == localStore {
+		err = fmt.Errorf("store %q is built-in", localStore)
+		return
+	}
+	s.redactor.AddSecrets(args.Password)
+
+	var stores []*server.Store
+	if stores, err = s.stores(ctx, request); err != nil {
+		return
+	}
+	index := slices.IndexFunc(stores, func(store *server.Store) bool {
+		return store.Name == args.Name
+	})
+	if index < 0 {
+		err = fmt.Errorf("store %q is not found or disabled", args.Name)
+		return
+	}
+
+	// the suites in the store are read from the new backend after the change
+	if result, err = confirmChange(ctx, request, args.Confirm, fmt.Sprintf(
+		"Update store %q? The test suites in it are loaded from the new settings.", args.Name)); result != nil || err != nil {
+		return
+	}
+
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err != nil {
+		return
+	}
+	// the password placeholder of the current store keeps the password
+	store := stores[index]
+	args.mergeInto(store)
+	if _, err = runner.UpdateStore(ctx, store); err == nil {
+		data = s.verify(ctx, runner, args.Name)
+		result = textResult(fmt.Sprintf("store %q is updated, %s", args.Name, data))
+	}
+	return
+}
+
+func (s *storeManager) DeleteStore(ctx context.Context, request *mcp.CallToolRequest, args DeleteStoreRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	if args.Name == "" {
+		err = errors.New("name is required")
+		return
+	}
+	if args.Name == localStore {
+		err = fmt.Errorf("store %q is built-in", localStore)
+		return
+	}
+
+	if result, err = confirmChange(ctx, request, args.Confirm, fmt.Sprintf(
+		"Delete store %q? The test suites in it are no longer reachable through the runner.", args.Name)); result != nil || err != nil {
+		return
+	}
+
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err != nil {
+		return
+	}
+	if _, err = runner.DeleteStore(ctx, &server.Store{Name: args.Name}); err != nil {
+		return
+	}
+
+	text := fmt.Sprintf("store %q is deleted", args.Name)
+	session := sessionOf(request)
+	if state := s.sessions.Get(session); state.Store == args.Name {
+		state.Store, state.Suite = "", ""
+		s.sessions.Set(session, state)
+		text += ", this session uses the local store now"
+	}
+	result = textResult(text)
+	return
+}
+
+func (s *storeManager) VerifyStore(ctx context.Context, request *mcp.CallToolRequest, args StoreNameRequest) (
+	result *mcp.CallToolResult, data StoreStatus, err error) {
+	if args.Name == "" {
+		args.Name = s.session(request).Store
+	}
+	if args.Name == "" {
+		err = errors.New("name is required")
+		return
+	}
+
+	var runner server.RunnerClient
+	if runner, err = s.runner(request); err == nil {
+		data = s.verify(ctx, runner, args.Name)
+		result = textResult(fmt.Sprintf("store %q is %s", args.Name, data))
+	}
+	return
+}
+
+func (s *storeManager) UseStore(ctx context.Context, request *mcp.CallToolRequest, args StoreNameRequest) (
+	result *mcp.CallToolResult, state SessionState, err error) {
+	if args.Name == "" {
+		err = errors.New("name is required")
+		return
+	}
+
+	if args.Name != localStore {
+		var runner server.RunnerClient
+		if runner, err = s.runner(request); err != nil {
+			return
+		}
+		if status := s.verify(ctx, runner, args.Name); !status.Ready {
+			err = fmt.Errorf("store %q is %s", args.Name, status)
+			return
+		}
+	}
+
+	// the active suite belongs to the previous store
+	session := sessionOf(request)
+	state = s.sessions.Get(session)
+	if state.Store != args.Name {
+		state.Suite = ""
+	}
+	state.Store = args.Name
+	if args.Name == localStore {
+		state.Store = ""
+	}
+	s.sessions.Set(session, state)
+	result = textResult(fmt.Sprintf("using store %q, the suite operations of this session target it", args.Name))
+	return
+}
+
+// verify checks the connectivity of the store, the failure is reported in the status
+func (s *storeManager) verify(ctx context.Context, runner server.RunnerClient, name string) (status StoreStatus) {
+	status.Name = name
+	reply, err := runner.VerifyStore(ctx, &server.SimpleQuery{Name: name})
+	if err != nil {
+		status.Message = err.Error()
+		return
+	}
+	status.Ready, status.ReadOnly, status.Version = reply.Ready, reply.ReadOnly, reply.Version
+	if !reply.Ready {
+		status.Message = reply.Message
+	}
+	return
+}
+
+// String describes the status in a readable way
+func (s StoreStatus) String() string {
+	switch {
+	case !s.Ready && s.Message != "":
+		return "not ready: " + s.Message
+	case !s.Ready:
+		return "not ready"
+	case s.ReadOnly:
+		return "ready, read-only"
+	default:
+		return "ready"
+	}
+}
+
+// mergeInto applies the given fields on the store, the omitted ones are kept
+func (args StoreRequest) mergeInto(store *server.Store) {
+	if args.Kind != "" || args.KindURL != "" {
+		if store.Kind == nil {
+			store.Kind = &server.StoreKind{}
+		}
+		mergeString(&store.Kind.Name, args.Kind)
+		mergeString(&store.Kind.Url, args.KindURL)
+	}
+	mergeString(&store.Url, args.URL)
+	mergeString(&store.Username, args.Username)
+	mergeString(&store.Password, args.Password)
+	mergeString(&store.Description, args.Description)
+
+	keys := slices.Sorted(maps.Keys(args.Properties))
+	for _, key := range keys {
+		store.Properties = slices.DeleteFunc(store.Properties, func(pair *server.Pair) bool {
+			return pair.Key == key
+		})
+		if value := args.Properties[key]; value != "" {
+			store.Properties = append(store.Properties, &server.Pair{Key: key, Value: value})
+		}
+	}
+}
+
+func storeInfo(store *server.Store) StoreInfo {
+	info := StoreInfo{
+		Name:        store.Name,
+		Kind:        store.GetKind().GetName(),
+		URL:         store.Url,
+		Username:    store.Username,
+		Description: store.Description,
+		Ready:       store.Ready,
+		ReadOnly:    store.ReadOnly,
+	}
+	if len(store.Properties) > 0 {
+		info.Properties = pairsToMap(store.Properties)
+	}
+	return info
+}
+
+// confirmChange asks the user to approve the destructive change by elicitation, the result explains why
+// the change is not made. The confirm argument is only accepted from the clients without elicitation,
+// otherwise the agent could approve the change by itself.
+func confirmChange(ctx context.Context, request *mcp.CallToolRequest, confirmed bool, message string) (
+	result *mcp.CallToolResult, err error) {
+	session := sessionOf(request)
+	if !supportsElicitation(session) {
+		if !confirmed {
+			result = &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: message + " Ask the user, and call again with confirm set to true once approved."},
+				},
+			}
+		}
+		return
+	}
+
+	var elicitResult *mcp.ElicitResult
+	if elicitResult, err = session.Elicit(ctx, &mcp.ElicitParams{
+		Message: message,
+		RequestedSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"confirm": {
+					Type:        "boolean",
+					Description: "approve the change",
+				},
+			},
+			Required: []string{"confirm"},
+		},
+	}); err != nil {
+		err = fmt.Errorf("failed to confirm the change: %w", err)
+		return
+	}
+	if approved, _ := elicitResult.Content["confirm"].(bool); elicitResult.Action != "accept" || !approved {
+		result = &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: "the change is cancelled by the user"},
+			},
+		}
+	}
+	return
+}
+
+func supportsElicitation(session *mcp.ServerSession) bool {
+	if session == nil {
+		return false
+	}
+	params := session.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
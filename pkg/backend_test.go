@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func (f *fakeRunner) GetStores(context.Context, *server.Empty) (*server.Stores, error) {
+	return &server.Stores{Data: []*server.Store{
+		{Name: "git", Kind: &server.StoreKind{Name: "git"}, Password: redactedValue, Ready: true,
+			Properties: []*server.Pair{{Key: "branch", Value: "main"}}},
+		{Name: "db", Kind: &server.StoreKind{Name: "orm"}},
+	}}, nil
+}
+
+func (f *fakeRunner) VerifyStore(_ context.Context, in *server.SimpleQuery) (*server.ExtensionStatus, error) {
+	return &server.ExtensionStatus{Ready: in.Name == "git", Message: "connection refused"}, nil
+}
+
+func (f *fakeRunner) UpdateStore(_ context.Context, in *server.Store) (*server.Store, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changes = append(f.changes, "update-store "+in.Name)
+	return &server.Store{}, nil
+}
+
+func (f *fakeRunner) DeleteStore(_ context.Context, in *server.Store) (*server.Store, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.changes = append(f.changes, "delete-store "+in.Name)
+	return &server.Store{}, nil
+}
+
+func newFakeStoreManager(t *testing.T) (*fakeRunner, *gRPCRunner, *storeManager) {
+	fake, runner := newFakeRunner(t)
+	fake.addSuite(&server.TestSuite{Name: "sample"})
+	return fake, runner, &storeManager{gRPCRunner: runner, redactor: NewRedactor(RedactConfig{})}
+}
+
+func TestSuiteCallsTargetSessionStore(t *testing.T) {
+	fake, runner, stores := newFakeStoreManager(t)
+	sessions := NewSessionManager(runner.runners, runner.pool, runner.sessions)
+	ctx := context.Background()
+
+	lastStore := func() string {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return fake.stores[len(fake.stores)-1]
+	}
+
+	tests := []struct {
+		name string
+		use  func() error
+		// suiteCheck tells if use checks the suite in the store
+		suiteCheck bool
+		expect     string
+	}{
+		{name: "local by default", expect: ""},
+		{name: "use-store", use: func() error {
+			_, _, err := stores.UseStore(ctx, nil, StoreNameRequest{Name: "git"})
+			return err
+		}, expect: "git"},
+		{name: "use-suite keeps the store", use: func() error {
+			_, _, err := sessions.UseSuite(ctx, nil, UseSuiteRequest{Suite: "sample"})
+			return err
+		}, suiteCheck: true, expect: "git"},
+		{name: "use-suite with local store", use: func() error {
+			_, _, err := sessions.UseSuite(ctx, nil, UseSuiteRequest{Suite: "sample", Store: localStore})
+			return err
+		}, suiteCheck: true, expect: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.use != nil {
+				if err := tt.use(); err != nil {
+					t.Fatal(err)
+				}
+				if store := lastStore(); tt.suiteCheck && store != tt.expect {
+					t.Fatalf("the check of the suite should target %q, got %q", tt.expect, store)
+				}
+			}
+
+			// the suite operations of the session go to the store
+			for _, call := range []func() error{
+				func() error {
+					_, _, err := runner.ListTestCase(ctx, nil, TestSuiteIndentityRequest{Name: "sample"})
+					return err
+				},
+				func() error {
+					_, _, err := runner.GetTestSuite(ctx, nil, GetTestSuiteRequest{Name: "sample"})
+					return err
+				},
+				func() error {
+					_, _, err := runner.Run(ctx, nil, RunRequest{SuiteName: "sample", CaseName: "get"})
+					return err
+				},
+			} {
+				if err := call(); err != nil {
+					t.Fatal(err)
+				}
+				if store := lastStore(); store != tt.expect {
+					t.Fatalf("expected store %q, got %q", tt.expect, store)
+				}
+			}
+		})
+	}
+
+	if _, _, err := stores.UseStore(ctx, nil, StoreNameRequest{Name: "db"}); err == nil {
+		t.Fatal("the store which is not ready should not be used")
+	}
+}
+
+func TestStoreChangesNeedConfirmation(t *testing.T) {
+	fake, _, stores := newFakeStoreManager(t)
+	ctx := context.Background()
+
+	result, _, err := stores.DeleteStore(ctx, nil, DeleteStoreRequest{Name: "git"})
+	if err != nil || result == nil || !result.IsError {
+		t.Fatalf("expected the deletion to be refused, got %v, %v", result, err)
+	}
+	if len(fake.changes) != 0 {
+		t.Fatal("the store should not be deleted")
+	}
+
+	stores.sessions.Set(nil, SessionState{Store: "git", Suite: "sample"})
+	if _, _, err = stores.DeleteStore(ctx, nil, DeleteStoreRequest{Name: "git", Confirm: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.changes) != 1 || fake.changes[0] != "delete-store git" {
+		t.Fatalf("the store should be deleted, got %v", fake.changes)
+	}
+	if state := stores.sessions.Get(nil); state.Store != "" || state.Suite != "" {
+		t.Fatalf("the session should leave the deleted store, got %+v", state)
+	}
+
+	if _, _, err = stores.DeleteStore(ctx, nil, DeleteStoreRequest{Name: localStore, Confirm: true}); err == nil {
+		t.Fatal("the local store should not be deleted")
+	}
+}
+
+func TestConfirmChangeElicitation(t *testing.T) {
+	tests := []struct {
+		name      string
+		elicit    *mcp.ElicitResult
+		confirmed bool
+		approved  bool
+	}{
+		{name: "accepted", elicit: &mcp.ElicitResult{Action: "accept", Content: map[string]any{"confirm": true}}, approved: true},
+		{name: "accepted without confirm", elicit: &mcp.ElicitResult{Action: "accept", Content: map[string]any{"confirm": false}}},
+		{name: "declined", elicit: &mcp.ElicitResult{Action: "decline"}},
+		{name: "the agent can't approve", elicit: &mcp.ElicitResult{Action: "decline"}, confirmed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked bool
+			s := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+			session, _ := connectSession(t, s, &mcp.ClientOptions{
+				ElicitationHandler: func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+					asked = true
+					return tt.elicit, nil
+				},
+			})
+
+			result, err := confirmChange(context.Background(), &mcp.CallToolRequest{Session: session}, tt.confirmed, "Delete?")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !asked {
+				t.Fatal("the user should be asked")
+			}
+			if approved := result == nil; approved != tt.approved {
+				t.Fatalf("expected approved %t, got %v", tt.approved, result)
+			}
+		})
+	}
+}
+
+func TestStoreRequestMergeInto(t *testing.T) {
+	store := &server.Store{Name: "git", Kind: &server.StoreKind{Name: "git"}, Url: "https://a", Password: redactedValue,
+		Properties: []*server.Pair{{Key: "branch", Value: "main"}, {Key: "path", Value: "suites"}}}
+	StoreRequest{URL: "https://b", Properties: map[string]string{"branch": "", "token": "x"}}.mergeInto(store)
+
+	if store.Url != "https://b" || store.Password != redactedValue || store.Kind.Name != "git" {
+		t.Fatalf("unexpected store %v", store)
+	}
+	if props := pairsToMap(store.Properties); len(props) != 2 || props["path"] != "suites" || props["token"] != "x" {
+		t.Fatalf("unexpected properties %v", props)
+	}
+}
@@ -0,0 +1,290 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const (
+	BulkCreate    = "create"
+	BulkUpdate    = "update"
+	BulkDelete    = "delete"
+	BulkMove      = "move"
+	BulkDuplicate = "duplicate"
+
+	defaultBulkConcurrency = 4
+	maxBulkConcurrency     = 32
+)
+
+type BulkTestCaseRequest struct {
+	Operation   string             `json:"operation" jsonschema:"the operation to apply on all the items: create, update, delete, move or duplicate"`
+	Items       []BulkTestCaseItem `json:"items" jsonschema:"the test cases to operate"`
+	Concurrency int                `json:"concurrency,omitempty" jsonschema:"the max number of the concurrent operations, default is 4"`
+	Atomic      bool               `json:"atomic,omitempty" jsonschema:"all or nothing, rollback the succeeded items if any item fails"`
+}
+
+type BulkTestCaseItem struct {
+	SuiteName       string                 `json:"suiteName,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	CaseName        string                 `json:"caseName,omitempty" jsonschema:"the name of test case, required by delete, move and duplicate"`
+	TargetSuiteName string                 `json:"targetSuiteName,omitempty" jsonschema:"the target test suite of move and duplicate, default is the source suite"`
+	TargetCaseName  string                 `json:"targetCaseName,omitempty" jsonschema:"the target test case name of move and duplicate, default is the source name"`
+	Case            *CreateTestCaseRequest `json:"case,omitempty" jsonschema:"the test case to create or update"`
+}
+
+type BulkItemResult struct {
+	Index   int    `json:"index"`
+	Suite   string `json:"suite"`
+	Case    string `json:"case"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type BulkResult struct {
+	Operation  string           `json:"operation"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	RolledBack bool             `json:"rolledBack"`
+	Items      []BulkItemResult `json:"items"`
+}
+
+const (
+	bulkSucceeded   = "succeeded"
+	bulkFailed      = "failed"
+	bulkRolledBack  = "rolled back"
+	bulkRollbackErr = "rollback failed"
+)
+
+func (r *gRPCRunner) BulkTestCases(ctx context.Context, request *mcp.CallToolRequest, args BulkTestCaseRequest) (
+	result *mcp.CallToolResult, data BulkResult, err error) {
+	switch args.Operation {
+	case BulkCreate, BulkUpdate, BulkDelete, BulkMove, BulkDuplicate:
+	default:
+		err = fmt.Errorf("not supported operation %q, should be one of create, update, delete, move, duplicate", args.Operation)
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+
+	concurrency := args.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBulkConcurrency
+	} else if concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+
+	state := r.session(request)
+	data = BulkResult{
+		Operation: args.Operation,
+		Items:     make([]BulkItemResult, len(args.Items)),
+	}
+	undos := make([]func(context.Context) error, len(args.Items))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i, item := range args.Items {
+		if item.SuiteName == "" {
+			item.SuiteName = state.Suite
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			itemResult := BulkItemResult{Index: i, Suite: item.SuiteName, Case: item.caseName()}
+			undo, itemErr := applyBulkItem(ctx, runner, state, args.Operation, item)
+			if itemErr == nil {
+				itemResult.Status = bulkSucceeded
+				undos[i] = undo
+			} else {
+				itemResult.Status = bulkFailed
+				itemResult.Message = itemErr.Error()
+			}
+			data.Items[i] = itemResult
+		}()
+	}
+	wg.Wait()
+
+	for _, item := range data.Items {
+		if item.Status == bulkSucceeded {
+			data.Succeeded++
+		} else {
+			data.Failed++
+		}
+	}
+
+	if args.Atomic && data.Failed > 0 && data.Succeeded > 0 {
+		data.RolledBack = true
+		// the rollback is not bound to the deadline of the tool call, the changes should be reverted anyway
+		rollbackCtx := context.WithoutCancel(ctx)
+		for i := len(undos) - 1; i >= 0; i-- {
+			if undos[i] == nil {
+				continue
+			}
+			if undoErr := undos[i](rollbackCtx); undoErr == nil {
+				data.Items[i].Status = bulkRolledBack
+			} else {
+				data.Items[i].Status = bulkRollbackErr
+				data.Items[i].Message = undoErr.Error()
+			}
+		}
+	}
+
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.Table()},
+		},
+		IsError: data.Failed > 0,
+	}
+	return
+}
+
+func (i BulkTestCaseItem) caseName() string {
+	if i.CaseName == "" && i.Case != nil {
+		return i.Case.CaseName
+	}
+	return i.CaseName
+}
+
+// applyBulkItem applies the operation on one item, and returns the function to revert it.
+// The test cases are created and updated along with the default headers like the single ones.
+func applyBulkItem(ctx context.Context, runner server.RunnerClient, state SessionState, operation string, item BulkTestCaseItem) (
+	undo func(context.Context) error, err error) {
+	if item.SuiteName == "" {
+		err = errors.New("suiteName is required")
+		return
+	}
+
+	switch operation {
+	case BulkCreate, BulkUpdate:
+		if item.Case == nil {
+			err = errors.New("case is required")
+			return
+		}
+		args := *item.Case
+		args.SuiteName = item.SuiteName
+		testCase, problems := buildTestCase(ctx, runner, state, args)
+		if len(problems) > 0 {
+			err = fmt.Errorf("invalid test case: %s", strings.Join(problems, "; "))
+			return
+		}
+		if operation == BulkCreate {
+			if err = replyError(runner.CreateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: item.SuiteName, Data: testCase})); err == nil {
+				undo = func(ctx context.Context) error {
+					return deleteTestCase(ctx, runner, item.SuiteName, testCase.Name)
+				}
+			}
+		} else {
+			var original *server.TestCase
+			if original, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: item.SuiteName, Testcase: testCase.Name}); err != nil {
+				return
+			}
+			if err = replyError(runner.UpdateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: item.SuiteName, Data: testCase})); err == nil {
+				undo = func(ctx context.Context) error {
+					return replyError(runner.UpdateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: item.SuiteName, Data: original}))
+				}
+			}
+		}
+	case BulkDelete:
+		var original *server.TestCase
+		if original, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: item.SuiteName, Testcase: item.CaseName}); err != nil {
+			return
+		}
+		if err = deleteTestCase(ctx, runner, item.SuiteName, item.CaseName); err == nil {
+			undo = func(ctx context.Context) error {
+				return replyError(runner.CreateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: item.SuiteName, Data: original}))
+			}
+		}
+	case BulkMove, BulkDuplicate:
+		targetSuite, targetCase := item.TargetSuiteName, item.TargetCaseName
+		if targetSuite == "" {
+			targetSuite = item.SuiteName
+		}
+		if targetCase == "" {
+			targetCase = item.CaseName
+		}
+		if targetSuite == item.SuiteName && targetCase == item.CaseName {
+			err = errors.New("the target should be different from the source")
+			return
+		}
+
+		if err = copyTestCase(ctx, runner, item.SuiteName, item.CaseName, targetSuite, targetCase); err != nil {
+			return
+		}
+		if operation == BulkMove {
+			if err = deleteTestCase(ctx, runner, item.SuiteName, item.CaseName); err != nil {
+				// keep the source only, the move is failed
+				err = errors.Join(err, deleteTestCase(ctx, runner, targetSuite, targetCase))
+				return
+			}
+			undo = func(ctx context.Context) error {
+				if err := copyTestCase(ctx, runner, targetSuite, targetCase, item.SuiteName, item.CaseName); err != nil {
+					return err
+				}
+				return deleteTestCase(ctx, runner, targetSuite, targetCase)
+			}
+		} else {
+			undo = func(ctx context.Context) error {
+				return deleteTestCase(ctx, runner, targetSuite, targetCase)
+			}
+		}
+	}
+	return
+}
+
+// copyTestCase copies all the fields of the test case to the target, it works across suites
+func copyTestCase(ctx context.Context, runner server.RunnerClient, sourceSuite, sourceCase, targetSuite, targetCase string) (err error) {
+	var testCase *server.TestCase
+	if testCase, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: sourceSuite, Testcase: sourceCase}); err == nil {
+		testCase.Name = targetCase
+		testCase.SuiteName = targetSuite
+		err = replyError(runner.CreateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: targetSuite, Data: testCase}))
+	}
+	return
+}
+
+func deleteTestCase(ctx context.Context, runner server.RunnerClient, suite, name string) error {
+	return replyError(runner.DeleteTestCase(ctx, &server.TestCaseIdentity{Suite: suite, Testcase: name}))
+}
+
+// replyError takes the error message in the reply into account
+func replyError(reply *server.HelloReply, err error) error {
+	if err == nil && reply != nil && reply.Error != "" {
+		err = errors.New(reply.Error)
+	}
+	return err
+}
+
+func commonResultError(reply *server.CommonResult, err error) error {
+	if err == nil && reply != nil && !reply.Success {
+		err = errors.New(reply.Message)
+	}
+	return err
+}
+
+// Table renders the result as a Markdown table
+func (r BulkResult) Table() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%s: %d succeeded, %d failed", r.Operation, r.Succeeded, r.Failed)
+	if r.RolledBack {
+		buf.WriteString(", the succeeded items are rolled back")
+	}
+	buf.WriteString("\n\n| # | Suite | Case | Status | Message |\n|---|---|---|---|---|\n")
+	for _, item := range r.Items {
+		fmt.Fprintf(&buf, "| %d | %s | %s | %s | %s |\n", item.Index, item.Suite, item.Case, item.Status,
+			strings.ReplaceAll(item.Message, "|", "\\|"))
+	}
+	return buf.String()
+}
@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+)
+
+func TestBulkTestCases(t *testing.T) {
+	newCase := func(name string) *CreateTestCaseRequest {
+		return &CreateTestCaseRequest{CaseName: name, API: "/" + name, Method: "GET"}
+	}
+	tests := []struct {
+		name     string
+		args     BulkTestCaseRequest
+		statuses []string
+		// cases are the expected cases of the suite along with their APIs
+		cases map[string]string
+		err   string
+	}{{
+		name: "create",
+		args: BulkTestCaseRequest{Operation: BulkCreate, Items: []BulkTestCaseItem{
+			{Case: newCase("c")}, {Case: newCase("d")}}},
+		statuses: []string{bulkSucceeded, bulkSucceeded},
+		cases:    map[string]string{"a": "/a", "b": "/b", "c": "/c", "d": "/d"},
+	}, {
+		name: "create without atomic",
+		args: BulkTestCaseRequest{Operation: BulkCreate, Items: []BulkTestCaseItem{
+			{Case: newCase("c")}, {Case: newCase("a")}}},
+		statuses: []string{bulkSucceeded, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b", "c": "/c"},
+	}, {
+		name: "create rollback",
+		args: BulkTestCaseRequest{Operation: BulkCreate, Atomic: true, Items: []BulkTestCaseItem{
+			{Case: newCase("c")}, {Case: newCase("a")}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "invalid case",
+		args: BulkTestCaseRequest{Operation: BulkCreate, Atomic: true, Items: []BulkTestCaseItem{
+			{Case: newCase("c")}, {Case: &CreateTestCaseRequest{CaseName: "d", Method: "GET"}}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "case of another protocol",
+		args: BulkTestCaseRequest{Operation: BulkCreate, Items: []BulkTestCaseItem{
+			{SuiteName: "grpc", Case: newCase("c")}}},
+		statuses: []string{bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "update rollback",
+		args: BulkTestCaseRequest{Operation: BulkUpdate, Atomic: true, Items: []BulkTestCaseItem{
+			{Case: &CreateTestCaseRequest{CaseName: "a", API: "/new", Method: "GET"}}, {Case: newCase("missing")}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "delete rollback",
+		args: BulkTestCaseRequest{Operation: BulkDelete, Atomic: true, Items: []BulkTestCaseItem{
+			{CaseName: "a"}, {CaseName: "missing"}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "move",
+		args: BulkTestCaseRequest{Operation: BulkMove, Items: []BulkTestCaseItem{
+			{CaseName: "a", TargetCaseName: "c"}}},
+		statuses: []string{bulkSucceeded},
+		cases:    map[string]string{"b": "/b", "c": "/a"},
+	}, {
+		name: "move rollback",
+		args: BulkTestCaseRequest{Operation: BulkMove, Atomic: true, Items: []BulkTestCaseItem{
+			{CaseName: "a", TargetCaseName: "c"}, {CaseName: "b"}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "duplicate rollback",
+		args: BulkTestCaseRequest{Operation: BulkDuplicate, Atomic: true, Items: []BulkTestCaseItem{
+			{CaseName: "a", TargetCaseName: "c"}, {CaseName: "missing", TargetCaseName: "d"}}},
+		statuses: []string{bulkRolledBack, bulkFailed},
+		cases:    map[string]string{"a": "/a", "b": "/b"},
+	}, {
+		name: "unknown operation",
+		args: BulkTestCaseRequest{Operation: "copy"},
+		err:  "not supported operation",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"},
+				&server.TestCase{Name: "a", Request: &server.Request{Api: "/a"}},
+				&server.TestCase{Name: "b", Request: &server.Request{Api: "/b"}})
+			fake.addSuite(&server.TestSuite{Name: "grpc", Spec: &server.APISpec{Kind: "grpc"}})
+			runner.sessions.Set(nil, SessionState{Suite: "sample"})
+
+			result, data, err := runner.BulkTestCases(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var statuses []string
+			for _, item := range data.Items {
+				statuses = append(statuses, item.Status)
+			}
+			if !slices.Equal(statuses, tt.statuses) {
+				t.Fatalf("expected %v, got %v", tt.statuses, data.Items)
+			}
+			if result.IsError != (data.Failed > 0) {
+				t.Fatalf("the result should be an error when any item fails")
+			}
+
+			if names := fake.caseNames("sample"); len(names) != len(tt.cases) {
+				t.Fatalf("expected cases %v, got %v", tt.cases, names)
+			}
+			for name, api := range tt.cases {
+				if testCase := fake.testCase("sample", name); testCase == nil || testCase.Request.Api != api {
+					t.Fatalf("expected case %q with API %q, got %v", name, api, testCase)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkTestCasesDefaultHeaders(t *testing.T) {
+	for _, operation := range []string{BulkCreate, BulkUpdate} {
+		t.Run(operation, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"}, &server.TestCase{Name: "a"})
+			runner.sessions.Set(nil, SessionState{Suite: "sample", Headers: map[string]string{"X-Tenant": "session", "X-Trace": "on"}})
+
+			name := "a"
+			if operation == BulkCreate {
+				name = "c"
+			}
+			_, data, err := runner.BulkTestCases(context.Background(), nil, BulkTestCaseRequest{
+				Operation: operation,
+				Items: []BulkTestCaseItem{{Case: &CreateTestCaseRequest{
+					CaseName: name, API: "/" + name, Method: "GET",
+					Headers:       map[string]string{"X-Trace": "off"},
+					SecretHeaders: map[string]string{"Authorization": "token"},
+				}}},
+			})
+			if err != nil || data.Failed > 0 {
+				t.Fatalf("unexpected failure %v: %v", data.Items, err)
+			}
+
+			expected := map[string]string{
+				"X-Tenant":      "session",
+				"X-Trace":       "off",
+				"Authorization": `{{secretValue "token"}}`,
+			}
+			header := fake.testCase("sample", name).Request.Header
+			for key, value := range expected {
+				if actual := headerValue(header, key); actual != value {
+					t.Fatalf("expected header %s=%q, got %q", key, value, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkTestCasesConcurrency(t *testing.T) {
+	fake, runner := newFakeRunner(t)
+	fake.addSuite(&server.TestSuite{Name: "sample"})
+	fake.delay = time.Millisecond
+
+	var items []BulkTestCaseItem
+	for i := range 10 {
+		items = append(items, BulkTestCaseItem{SuiteName: "sample", Case: &CreateTestCaseRequest{
+			CaseName: fmt.Sprintf("case-%d", i), API: "/api", Method: "GET"}})
+	}
+	_, data, err := runner.BulkTestCases(context.Background(), nil, BulkTestCaseRequest{
+		Operation: BulkCreate, Items: items, Concurrency: 2})
+	if err != nil || data.Succeeded != len(items) {
+		t.Fatalf("expected all created, got %v: %v", data.Items, err)
+	}
+	for i, item := range data.Items {
+		if item.Index != i || item.Case != fmt.Sprintf("case-%d", i) {
+			t.Fatalf("the results should keep the order of the items, got %v", data.Items)
+		}
+	}
+	if fake.maxActive > 2 {
+		t.Fatalf("expected up to 2 concurrent calls, got %d", fake.maxActive)
+	}
+	if len(fake.caseNames("sample")) != len(items) {
+		t.Fatalf("expected %d cases, got %v", len(items), fake.caseNames("sample"))
+	}
+}
@@ -0,0 +1,469 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables which override the config file
+const EnvPrefix = "ATEST_MCP_"
+
+// Config is the configuration of the MCP server
+type Config struct {
+	Runners   []RunnerConfig  `json:"runners" yaml:"runners"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth"`
+	Tools     ToolsConfig     `json:"tools" yaml:"tools"`
+	Transport TransportConfig `json:"transport" yaml:"transport"`
+	Timeouts  TimeoutsConfig  `json:"timeouts" yaml:"timeouts"`
+	Retry     RetryConfig     `json:"retry" yaml:"retry"`
+	Log       LogConfig       `json:"log" yaml:"log"`
+	Tracing   TracingConfig   `json:"tracing" yaml:"tracing"`
+	Diff      DiffConfig      `json:"diff" yaml:"diff"`
+	Store     StoreConfig     `json:"store" yaml:"store"`
+	Report    ReportConfig    `json:"report" yaml:"report"`
+	Redact    RedactConfig    `json:"redact" yaml:"redact"`
+}
+
+// RunnerConfig is an atest runner which serves the gRPC API
+type RunnerConfig struct {
+	Name    string `json:"name" yaml:"name"`
+	Address string `json:"address" yaml:"address"`
+}
+
+// AuthConfig protects the HTTP transports with a bearer token
+type AuthConfig struct {
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+// ToolsConfig limits the tools exposed to the clients, all tools are exposed if Allow is empty
+type ToolsConfig struct {
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+}
+
+// TransportConfig is how the MCP server talks to the clients
+type TransportConfig struct {
+	// Mode is one of http, sse and stdio, or a comma separated list of them to serve simultaneously
+	Mode string `json:"mode" yaml:"mode"`
+	Bind string `json:"bind" yaml:"bind"`
+	Port int    `json:"port" yaml:"port"`
+	// AllowedHosts are accepted in the Host header, "*" accepts all. Only the loopback hosts are accepted by default
+	// if the bind address is loopback, otherwise all hosts are accepted by default
+	AllowedHosts []string   `json:"allowedHosts,omitempty" yaml:"allowedHosts,omitempty"`
+	TLS          TLSConfig  `json:"tls" yaml:"tls"`
+	CORS         CORSConfig `json:"cors" yaml:"cors"`
+}
+
+// Modes returns the transports to serve, the mode could be a comma separated list, such as http,sse
+func (c TransportConfig) Modes() []string {
+	return splitList(c.Mode)
+}
+
+// TLSConfig serves the HTTP transports over HTTPS
+type TLSConfig struct {
+	CertFile   string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	SelfSigned bool   `json:"selfSigned" yaml:"selfSigned"`
+}
+
+// Enabled checks if the HTTPS is required
+func (c TLSConfig) Enabled() bool {
+	return c.SelfSigned || c.CertFile != ""
+}
+
+// CORSConfig allows the browser-based clients from other origins
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins,omitempty" yaml:"allowedOrigins,omitempty"`
+}
+
+// TimeoutsConfig holds the deadlines of the tool calls, and the grace period of shutting down the server
+type TimeoutsConfig struct {
+	Default  time.Duration            `json:"default" yaml:"default"`
+	Tools    map[string]time.Duration `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Shutdown time.Duration            `json:"shutdown" yaml:"shutdown"`
+}
+
+// RetryConfig is how to retry the idempotent read requests when the runner is unavailable
+type RetryConfig struct {
+	Max     int           `json:"max" yaml:"max"`
+	Backoff time.Duration `json:"backoff" yaml:"backoff"`
+}
+
+// LogConfig is the logging setting of the server process
+type LogConfig struct {
+	Level  string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+// TracingConfig is how to export the OpenTelemetry spans
+type TracingConfig struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	Endpoint    string `json:"endpoint" yaml:"endpoint"`
+	Insecure    bool   `json:"insecure" yaml:"insecure"`
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+}
+
+// StoreConfig is the local store of the runs made through the MCP server
+type StoreConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Path is the bbolt file, default is runs.db in the user config directory
+	Path       string        `json:"path,omitempty" yaml:"path,omitempty"`
+	MaxRecords int           `json:"maxRecords" yaml:"maxRecords"`
+	MaxAge     time.Duration `json:"maxAge" yaml:"maxAge"`
+}
+
+// ReportConfig is where to write the reports of the suite runs
+type ReportConfig struct {
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+}
+
+// DiffConfig is the volatile parts of the responses which are ignored when comparing runs
+type DiffConfig struct {
+	// IgnoreFields are the JSON field names at any depth, or the paths such as data.items[0].id
+	IgnoreFields  []string `json:"ignoreFields" yaml:"ignoreFields"`
+	IgnoreHeaders []string `json:"ignoreHeaders" yaml:"ignoreHeaders"`
+	// LatencyThreshold is the ratio of the slowdown which is a regression, such as 0.5 for 50% slower, 0 disables it
+	LatencyThreshold float64 `json:"latencyThreshold" yaml:"latencyThreshold"`
+}
+
+const (
+	ModeHTTP  = "http"
+	ModeSSE   = "sse"
+	ModeStdio = "stdio"
+
+	defaultRunnerName = "default"
+)
+
+// NewDefaultConfig returns the config with the default values
+func NewDefaultConfig() *Config {
+	return &Config{
+		Transport: TransportConfig{
+			Mode: ModeHTTP,
+			Port: 7845,
+		},
+		Timeouts: TimeoutsConfig{
+			Default:  2 * time.Minute,
+			Shutdown: 30 * time.Second,
+		},
+		Retry: RetryConfig{
+			Max:     3,
+			Backoff: 200 * time.Millisecond,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4317",
+			Insecure:    true,
+			ServiceName: "atest-mcp-server",
+		},
+		Store: StoreConfig{
+			MaxRecords: 1000,
+			MaxAge:     30 * 24 * time.Hour,
+		},
+		Diff: DiffConfig{
+			IgnoreFields:     []string{"id", "timestamp", "createdAt", "updatedAt", "requestId", "traceId"},
+			IgnoreHeaders:    []string{"Date", "Content-Length", "X-Request-Id", "Traceparent"},
+			LatencyThreshold: 0.5,
+		},
+		Redact: RedactConfig{
+			Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-API-Key"},
+		},
+	}
+}
+
+// LoadConfig reads the config file in YAML or JSON format on top of the default values.
+// The default config is returned if the path is empty.
+func LoadConfig(path string) (config *Config, err error) {
+	config = NewDefaultConfig()
+	if path == "" {
+		return
+	}
+
+	var data []byte
+	if data, err = os.ReadFile(path); err != nil {
+		err = fmt.Errorf("failed to read config file %q: %w", path, err)
+		return
+	}
+	// JSON is a subset of YAML, so the YAML decoder handles both formats
+	if err = yaml.Unmarshal(data, config); err != nil {
+		err = fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+	return
+}
+
+// ApplyEnv overrides the config with the ATEST_MCP_* environment variables
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) (err error) {
+	var errs []error
+	env := func(key string) (string, bool) {
+		val, ok := lookup(EnvPrefix + key)
+		return strings.TrimSpace(val), ok && strings.TrimSpace(val) != ""
+	}
+
+	if val, ok := env("RUNNERS"); ok {
+		c.Runners = nil
+		for _, item := range strings.Split(val, ",") {
+			name, address, found := strings.Cut(strings.TrimSpace(item), "=")
+			if !found {
+				errs = append(errs, fmt.Errorf("%sRUNNERS: %q should be in format name=address", EnvPrefix, item))
+				continue
+			}
+			c.Runners = append(c.Runners, RunnerConfig{Name: name, Address: address})
+		}
+	}
+	if val, ok := env("RUNNER_ADDRESS"); ok {
+		c.SetDefaultRunnerAddress(val)
+	}
+	if val, ok := env("AUTH_TOKEN"); ok {
+		c.Auth.Token = val
+	}
+	if val, ok := env("TOOLS"); ok {
+		c.Tools.Allow = splitList(val)
+	}
+	if val, ok := env("MODE"); ok {
+		c.Transport.Mode = val
+	}
+	if val, ok := env("BIND"); ok {
+		c.Transport.Bind = val
+	}
+	if val, ok := env("ALLOWED_HOSTS"); ok {
+		c.Transport.AllowedHosts = splitList(val)
+	}
+	if val, ok := env("TLS_CERT"); ok {
+		c.Transport.TLS.CertFile = val
+	}
+	if val, ok := env("TLS_KEY"); ok {
+		c.Transport.TLS.KeyFile = val
+	}
+	if val, ok := env("CORS_ORIGINS"); ok {
+		c.Transport.CORS.AllowedOrigins = splitList(val)
+	}
+	if val, ok := env("PORT"); ok {
+		if c.Transport.Port, err = strconv.Atoi(val); err != nil {
+			errs = append(errs, fmt.Errorf("%sPORT: %q is not a number", EnvPrefix, val))
+		}
+	}
+	if val, ok := env("TIMEOUT"); ok {
+		if c.Timeouts.Default, err = time.ParseDuration(val); err != nil {
+			errs = append(errs, fmt.Errorf("%sTIMEOUT: %q is not a duration", EnvPrefix, val))
+		}
+	}
+	if val, ok := env("SHUTDOWN_TIMEOUT"); ok {
+		if c.Timeouts.Shutdown, err = time.ParseDuration(val); err != nil {
+			errs = append(errs, fmt.Errorf("%sSHUTDOWN_TIMEOUT: %q is not a duration", EnvPrefix, val))
+		}
+	}
+	if val, ok := env("LOG_LEVEL"); ok {
+		c.Log.Level = val
+	}
+	if val, ok := env("LOG_FORMAT"); ok {
+		c.Log.Format = val
+	}
+	if val, ok := env("STORE_PATH"); ok {
+		c.Store.Enabled = true
+		c.Store.Path = val
+	}
+	if val, ok := env("REPORT_DIR"); ok {
+		c.Report.Dir = val
+	}
+	if val, ok := env("TRACING_ENDPOINT"); ok {
+		c.Tracing.Enabled = true
+		c.Tracing.Endpoint = val
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// SetDefaultRunnerAddress sets the address of the default runner, which is the first one
+func (c *Config) SetDefaultRunnerAddress(address string) {
+	if len(c.Runners) == 0 {
+		c.Runners = append(c.Runners, RunnerConfig{Name: defaultRunnerName})
+	}
+	c.Runners[0].Address = address
+}
+
+// DefaultRunner returns the runner used when no runner is specified
+func (c *Config) DefaultRunner() (runner RunnerConfig) {
+	if len(c.Runners) > 0 {
+		runner = c.Runners[0]
+	}
+	return
+}
+
+// IsToolAllowed checks if the tool is in the allowlist
+func (c *Config) IsToolAllowed(name string) bool {
+	if len(c.Tools.Allow) == 0 {
+		return true
+	}
+	for _, item := range c.Tools.Allow {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolTimeout returns the deadline of the given tool
+func (c *Config) ToolTimeout(name string) time.Duration {
+	if timeout, ok := c.Timeouts.Tools[name]; ok {
+		return timeout
+	}
+	return c.Timeouts.Default
+}
+
+// Validate checks the config and reports all the problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	if len(c.Runners) == 0 {
+		errs = append(errs, errors.New("runners: at least one runner is required, please set --runner-address"))
+	}
+	names := map[string]bool{}
+	for i, runner := range c.Runners {
+		if runner.Name == "" {
+			errs = append(errs, fmt.Errorf("runners[%d].name is required", i))
+		} else if names[runner.Name] {
+			errs = append(errs, fmt.Errorf("runners[%d].name: duplicated runner %q", i, runner.Name))
+		}
+		names[runner.Name] = true
+		if runner.Address == "" {
+			errs = append(errs, fmt.Errorf("runners[%d].address is required", i))
+		}
+	}
+
+	modes := c.Transport.Modes()
+	if len(modes) == 0 {
+		errs = append(errs, errors.New("transport.mode is required"))
+	}
+	seen := map[string]bool{}
+	for _, mode := range modes {
+		switch mode {
+		case ModeHTTP, ModeSSE, ModeStdio:
+		default:
+			errs = append(errs, fmt.Errorf("transport.mode: %q is not supported, should be one of http, sse, stdio", mode))
+		}
+		if seen[mode] {
+			errs = append(errs, fmt.Errorf("transport.mode: duplicated mode %q", mode))
+		}
+		seen[mode] = true
+	}
+	if c.Transport.Port <= 0 || c.Transport.Port > 65535 {
+		errs = append(errs, fmt.Errorf("transport.port: %d is out of range 1-65535", c.Transport.Port))
+	}
+	if c.Transport.Bind != "" && c.Transport.Bind != "localhost" && net.ParseIP(c.Transport.Bind) == nil {
+		errs = append(errs, fmt.Errorf("transport.bind: %q is not a valid IP address", c.Transport.Bind))
+	}
+	if tls := c.Transport.TLS; tls.SelfSigned && (tls.CertFile != "" || tls.KeyFile != "") {
+		errs = append(errs, errors.New("transport.tls: selfSigned conflicts with certFile and keyFile"))
+	} else if (tls.CertFile == "") != (tls.KeyFile == "") {
+		errs = append(errs, errors.New("transport.tls: both certFile and keyFile are required"))
+	}
+	for i, origin := range c.Transport.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("transport.cors.allowedOrigins[%d]: %q should be in format scheme://host[:port]", i, origin))
+		}
+	}
+
+	if c.Timeouts.Default < 0 {
+		errs = append(errs, fmt.Errorf("timeouts.default: %s should not be negative", c.Timeouts.Default))
+	}
+	if c.Timeouts.Shutdown <= 0 {
+		errs = append(errs, fmt.Errorf("timeouts.shutdown: %s should be positive", c.Timeouts.Shutdown))
+	}
+	for name, timeout := range c.Timeouts.Tools {
+		if timeout < 0 {
+			errs = append(errs, fmt.Errorf("timeouts.tools.%s: %s should not be negative", name, timeout))
+		}
+	}
+
+	if c.Retry.Max < 0 {
+		errs = append(errs, fmt.Errorf("retry.max: %d should not be negative", c.Retry.Max))
+	}
+	if c.Retry.Max > 0 && c.Retry.Backoff <= 0 {
+		errs = append(errs, fmt.Errorf("retry.backoff: %s should be positive", c.Retry.Backoff))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: %q is not supported, should be one of debug, info, warn, error", c.Log.Level))
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log.format: %q is not supported, should be one of text, json", c.Log.Format))
+	}
+
+	if c.Tracing.Enabled && c.Tracing.Endpoint == "" {
+		errs = append(errs, errors.New("tracing.endpoint is required when the tracing is enabled"))
+	}
+
+	if c.Store.MaxRecords < 0 {
+		errs = append(errs, fmt.Errorf("store.maxRecords: %d should not be negative", c.Store.MaxRecords))
+	}
+	if c.Diff.LatencyThreshold < 0 {
+		errs = append(errs, fmt.Errorf("diff.latencyThreshold: %v should not be negative", c.Diff.LatencyThreshold))
+	}
+	if c.Store.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("store.maxAge: %s should not be negative", c.Store.MaxAge))
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the config without the credentials, it's safe to print.
+// The credentials in the addresses, such as user:password@host or ?token=xxx, are masked as well
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Auth.Token = redactString(c.Auth.Token)
+	redacted.Transport.TLS.KeyFile = redactString(c.Transport.TLS.KeyFile)
+	redacted.Tracing.Endpoint = redactAddress(c.Tracing.Endpoint)
+	redacted.Runners = slices.Clone(c.Runners)
+	for i := range redacted.Runners {
+		redacted.Runners[i].Address = redactAddress(redacted.Runners[i].Address)
+	}
+	return &redacted
+}
+
+func redactString(val string) string {
+	if val == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// redactAddress masks the user info and the query of the address, the scheme is optional
+func redactAddress(address string) string {
+	scheme, rest, found := strings.Cut(address, "://")
+	if !found {
+		scheme, rest = "", address
+	} else {
+		scheme += "://"
+	}
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest = redactedValue + rest[i:]
+	}
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest = rest[:i+1] + redactedValue
+	}
+	return scheme + rest
+}
+
+func splitList(val string) (items []string) {
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
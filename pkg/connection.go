@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// ConnectionPool shares the gRPC connections of the runners across the tool calls
+type ConnectionPool interface {
+	Get(address string) (*grpc.ClientConn, error)
+	Close() error
+}
+
+type connectionPool struct {
+	mu      sync.Mutex
+	conns   map[string]*grpc.ClientConn
+	options []grpc.DialOption
+}
+
+// NewConnectionPool creates a pool which dials the runners lazily
+func NewConnectionPool(options ...grpc.DialOption) ConnectionPool {
+	return &connectionPool{
+		conns: map[string]*grpc.ClientConn{},
+		options: append([]grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		}, options...),
+	}
+}
+
+func (p *connectionPool) Get(address string) (conn *grpc.ClientConn, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ok bool
+	if conn, ok = p.conns[address]; !ok {
+		if conn, err = grpc.NewClient(address, p.options...); err == nil {
+			p.conns[address] = conn
+		}
+	}
+	return
+}
+
+func (p *connectionPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for address, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, address)
+	}
+	return errors.Join(errs...)
+}
+
+// idempotentMethods are the read-only RPCs which are safe to retry
+var idempotentMethods = map[string]bool{
+	"/server.Runner/GetSuites":                    true,
+	"/server.Runner/GetTestSuite":                 true,
+	"/server.Runner/ListTestCase":                 true,
+	"/server.Runner/GetTestCase":                  true,
+	"/server.Runner/GetSuggestedAPIs":             true,
+	"/server.Runner/GetVersion":                   true,
+	"/server.Runner/GetTestSuiteYaml":             true,
+	"/server.Runner/FunctionsQuery":               true,
+	"/server.Runner/ListCodeGenerator":            true,
+	"/server.Runner/GetHistorySuites":             true,
+	"/server.Runner/GetHistoryTestCase":           true,
+	"/server.Runner/GetHistoryTestCaseWithResult": true,
+	"/server.Runner/GetTestCaseAllHistory":        true,
+	"/server.Runner/GetSecrets":                   true,
+	"/server.Runner/GetStores":                    true,
+	"/server.Runner/GetStoreKinds":                true,
+	"/server.Runner/VerifyStore":                  true,
+	"/server.Mock/GetConfig":                      true,
+}
+
+// NewRetryInterceptor retries the idempotent RPCs with exponential backoff when the runner is unavailable.
+// The retry stops as soon as the context is done, for example, the client cancelled the tool call.
+func NewRetryInterceptor(config RetryConfig) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		backoff := config.Backoff
+		for attempt := 0; ; attempt++ {
+			err = invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= config.Max || !idempotentMethods[method] ||
+				status.Code(err) != codes.Unavailable {
+				return
+			}
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			backoff *= 2
+		}
+	}
+}
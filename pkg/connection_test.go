@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		unavailable int
+		max         int
+		code        codes.Code
+		calls       int
+	}{
+		{name: "idempotent recovers", method: "GetTestSuite", unavailable: 2, max: 3, code: codes.OK, calls: 3},
+		{name: "idempotent gives up", method: "GetTestSuite", unavailable: 5, max: 2, code: codes.Unavailable, calls: 3},
+		{name: "idempotent without retry", method: "GetTestSuite", unavailable: 1, max: 0, code: codes.Unavailable, calls: 1},
+		{name: "non-idempotent is not retried", method: "CreateTestSuite", unavailable: 1, max: 3, code: codes.Unavailable, calls: 1},
+		{name: "non-idempotent succeeds", method: "CreateTestSuite", max: 3, code: codes.OK, calls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t, grpc.WithUnaryInterceptor(
+				NewRetryInterceptor(RetryConfig{Max: tt.max, Backoff: time.Millisecond})))
+			fake.addSuite(&server.TestSuite{Name: "sample"})
+			fake.unavailable = tt.unavailable
+
+			client := fakeClient(t, runner)
+			var err error
+			switch tt.method {
+			case "GetTestSuite":
+				_, err = client.GetTestSuite(context.Background(), &server.TestSuiteIdentity{Name: "sample"})
+			case "CreateTestSuite":
+				_, err = client.CreateTestSuite(context.Background(), &server.TestSuiteIdentity{Name: "new"})
+			}
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+			if calls := fake.callsOf(tt.method); calls != tt.calls {
+				t.Fatalf("expected %d calls, got %d", tt.calls, calls)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	fake, runner := newFakeRunner(t, grpc.WithUnaryInterceptor(
+		NewRetryInterceptor(RetryConfig{Max: 10, Backoff: time.Hour})))
+	fake.unavailable = 10
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := fakeClient(t, runner).GetVersion(ctx, &server.Empty{})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the retry should stop with the context, it took %s", elapsed)
+	}
+	if calls := fake.callsOf("GetVersion"); calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestBlockingRunner(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		cancel bool
+		code   codes.Code
+	}{
+		{name: "idempotent timeout", method: "GetTestSuite", code: codes.DeadlineExceeded},
+		{name: "non-idempotent timeout", method: "CreateTestSuite", code: codes.DeadlineExceeded},
+		{name: "idempotent cancellation", method: "GetTestSuite", cancel: true, code: codes.Canceled},
+		{name: "non-idempotent cancellation", method: "CreateTestSuite", cancel: true, code: codes.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t, grpc.WithUnaryInterceptor(
+				NewRetryInterceptor(RetryConfig{Max: 3, Backoff: time.Millisecond})))
+			fake.block = true
+
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if tt.cancel {
+				ctx, cancel = context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+			} else {
+				ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+			}
+			defer cancel()
+
+			client := fakeClient(t, runner)
+			start := time.Now()
+			var err error
+			switch tt.method {
+			case "GetTestSuite":
+				_, err = client.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: "sample"})
+			case "CreateTestSuite":
+				_, err = client.CreateTestSuite(ctx, &server.TestSuiteIdentity{Name: "new"})
+			}
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("the call should be aborted, it took %s", elapsed)
+			}
+			// the abort is not retried even for the idempotent ones
+			if calls := fake.callsOf(tt.method); calls != 1 {
+				t.Fatalf("expected 1 call, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	_, runner := newFakeRunner(t)
+	first, err := runner.pool.Get(fakeAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := runner.pool.Get(fakeAddress)
+	if first != second {
+		t.Fatal("the connection should be shared")
+	}
+	if err = runner.pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	third, _ := runner.pool.Get(fakeAddress)
+	if third == first {
+		t.Fatal("a new connection should be dialed after closing the pool")
+	}
+}
+
+func fakeClient(t *testing.T, runner *gRPCRunner) server.RunnerClient {
+	t.Helper()
+	conn, err := runner.getConnection(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.NewRunnerClient(conn)
+}
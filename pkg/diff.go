@@ -0,0 +1,544 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+
+	maxDiffValueLength = 200
+
+	// latencyMatchWindow is the tolerance of matching a historical run with a local run record by time
+	latencyMatchWindow = 2 * time.Second
+	// minLatencyRegression avoids the noise of the fast runs
+	minLatencyRegression = 100 * time.Millisecond
+)
+
+type DiffRunsRequest struct {
+	Suite         string   `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase      string   `json:"testcase,omitempty" jsonschema:"the name of test case, the latest two runs of all the cases in the suite are compared if both it and the IDs are empty"`
+	BaseID        string   `json:"baseID,omitempty" jsonschema:"the ID of the baseline run, default is the run before the target one"`
+	TargetID      string   `json:"targetID,omitempty" jsonschema:"the ID of the run to compare, default is the latest run"`
+	IgnoreFields  []string `json:"ignoreFields,omitempty" jsonschema:"the extra volatile JSON field names or paths to ignore, such as token or data.items[*].id"`
+	IgnoreHeaders []string `json:"ignoreHeaders,omitempty" jsonschema:"the extra volatile response headers to ignore"`
+}
+
+// FieldChange is a difference at a path of the JSON body, or in a header
+type FieldChange struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Base   any    `json:"base,omitempty"`
+	Target any    `json:"target,omitempty"`
+}
+
+// RunDiff is the difference between two runs of a test case
+type RunDiff struct {
+	Suite      string         `json:"suite"`
+	Case       string         `json:"case"`
+	Base       HistoryRun     `json:"base"`
+	Target     HistoryRun     `json:"target"`
+	Status     *FieldChange   `json:"status,omitempty"`
+	StatusCode *FieldChange   `json:"statusCode,omitempty"`
+	Headers    []FieldChange  `json:"headers,omitempty"`
+	Body       []FieldChange  `json:"body,omitempty"`
+	Latency    *LatencyChange `json:"latency,omitempty"`
+	Regression bool           `json:"regression"`
+}
+
+// LatencyChange compares the durations of the runs, which are only known by the local run store.
+// The duration is zero if the run is not recorded locally.
+type LatencyChange struct {
+	Base       time.Duration `json:"base,omitempty"`
+	Target     time.Duration `json:"target,omitempty"`
+	Delta      time.Duration `json:"delta,omitempty"`
+	Regression bool          `json:"regression"`
+}
+
+type DiffResult struct {
+	Diffs       []RunDiff `json:"diffs"`
+	Regressions int       `json:"regressions"`
+	Skipped     []string  `json:"skipped,omitempty"`
+}
+
+// RunComparer compares the historical runs to find out the regressions
+type RunComparer interface {
+	DiffRuns(ctx context.Context, request *mcp.CallToolRequest, args DiffRunsRequest) (
+		result *mcp.CallToolResult, data DiffResult, err error)
+}
+
+type runComparer struct {
+	*gRPCRunner
+	store  RunStore
+	config DiffConfig
+}
+
+// NewRunComparer creates the comparer, the latency is compared only if the store is given
+func NewRunComparer(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, store RunStore, config DiffConfig) RunComparer {
+	return &runComparer{
+		gRPCRunner: &gRPCRunner{
+			runners:  runners,
+			pool:     pool,
+			sessions: sessions,
+		},
+		store:  store,
+		config: config,
+	}
+}
+
+func (c *runComparer) DiffRuns(ctx context.Context, request *mcp.CallToolRequest, args DiffRunsRequest) (
+	result *mcp.CallToolResult, data DiffResult, err error) {
+	if args.Suite == "" {
+		args.Suite = c.session(request).Suite
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = c.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+	ignore := newDiffIgnore(append(slices.Clone(c.config.IgnoreFields), args.IgnoreFields...),
+		append(slices.Clone(c.config.IgnoreHeaders), args.IgnoreHeaders...))
+
+	var pairs [][2]string
+	switch {
+	case args.BaseID != "" && args.TargetID != "":
+		pairs = append(pairs, [2]string{args.BaseID, args.TargetID})
+	case args.Suite == "":
+		err = errors.New("suite is required unless both baseID and targetID are given")
+		return
+	case args.Testcase != "":
+		var pair [2]string
+		if pair, err = latestRuns(ctx, runner, args.Suite, args.Testcase, args.BaseID, args.TargetID); err != nil {
+			return
+		}
+		pairs = append(pairs, pair)
+	default:
+		var suite *server.Suite
+		if suite, err = runner.ListTestCase(ctx, &server.TestSuiteIdentity{Name: args.Suite}); err != nil {
+			return
+		}
+		for _, testCase := range suite.Items {
+			if pair, pairErr := latestRuns(ctx, runner, args.Suite, testCase.Name, "", ""); pairErr == nil {
+				pairs = append(pairs, pair)
+			} else {
+				data.Skipped = append(data.Skipped, fmt.Sprintf("%s: %v", testCase.Name, pairErr))
+			}
+		}
+	}
+
+	for _, pair := range pairs {
+		var base, target *server.HistoryTestResult
+		if base, err = runner.GetHistoryTestCaseWithResult(ctx, &server.HistoryTestCase{ID: pair[0]}); err != nil {
+			err = fmt.Errorf("failed to get the historical run %q: %w", pair[0], err)
+			return
+		}
+		if target, err = runner.GetHistoryTestCaseWithResult(ctx, &server.HistoryTestCase{ID: pair[1]}); err != nil {
+			err = fmt.Errorf("failed to get the historical run %q: %w", pair[1], err)
+			return
+		}
+
+		diff := diffRuns(base, target, ignore)
+		if diff.Latency = c.compareLatency(diff.Base, diff.Target); diff.Latency != nil && diff.Latency.Regression {
+			diff.Regression = true
+		}
+		if diff.Regression {
+			data.Regressions++
+		}
+		data.Diffs = append(data.Diffs, diff)
+	}
+
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.Summary()},
+		},
+	}
+	return
+}
+
+// latestRuns returns the IDs of the base and target runs, the target is the latest one by default,
+// and the base is the one right before the target by default
+func latestRuns(ctx context.Context, runner server.RunnerClient, suite, testcase, baseID, targetID string) (pair [2]string, err error) {
+	var cases *server.HistoryTestCases
+	if cases, err = runner.GetTestCaseAllHistory(ctx, &server.TestCase{SuiteName: suite, Name: testcase}); err != nil {
+		return
+	}
+	items := cases.Data
+	slices.SortFunc(items, func(a, b *server.HistoryTestCase) int {
+		return b.CreateTime.AsTime().Compare(a.CreateTime.AsTime())
+	})
+
+	targetIndex := 0
+	if targetID != "" {
+		targetIndex = slices.IndexFunc(items, func(item *server.HistoryTestCase) bool {
+			return item.ID == targetID
+		})
+		if targetIndex < 0 {
+			err = fmt.Errorf("run %q is not found in the history of %q", targetID, testcase)
+			return
+		}
+	}
+	if len(items) == 0 {
+		err = fmt.Errorf("no run found")
+		return
+	} else if baseID == "" && targetIndex+1 >= len(items) {
+		err = fmt.Errorf("no run before the target one to compare with")
+		return
+	}
+
+	pair[1] = items[targetIndex].ID
+	if pair[0] = baseID; pair[0] == "" {
+		pair[0] = items[targetIndex+1].ID
+	}
+	return
+}
+
+func diffRuns(base, target *server.HistoryTestResult, ignore diffIgnore) (diff RunDiff) {
+	diff.Base, diff.Target = newHistoryRun(base), newHistoryRun(target)
+	diff.Suite, diff.Case = diff.Target.Suite, diff.Target.Case
+
+	if diff.Base.Status != diff.Target.Status {
+		diff.Status = &FieldChange{Path: "status", Kind: changeChanged, Base: diff.Base.Status, Target: diff.Target.Status}
+	}
+	if diff.Base.StatusCode != diff.Target.StatusCode {
+		diff.StatusCode = &FieldChange{Path: "statusCode", Kind: changeChanged, Base: diff.Base.StatusCode, Target: diff.Target.StatusCode}
+	}
+	diff.Regression = (diff.Base.Status == historyPassed && diff.Target.Status == historyFailed) ||
+		(isSuccessCode(diff.Base.StatusCode) && !isSuccessCode(diff.Target.StatusCode))
+
+	baseResult, targetResult := primaryResult(base), primaryResult(target)
+	diff.Headers = diffHeaders(baseResult.Header, targetResult.Header, ignore)
+	diff.Body = diffBody(baseResult.Body, targetResult.Body, ignore)
+	return
+}
+
+// compareLatency returns nil if neither run is recorded locally
+func (c *runComparer) compareLatency(base, target HistoryRun) (change *LatencyChange) {
+	baseDuration, targetDuration := c.runDuration(base), c.runDuration(target)
+	if baseDuration == 0 && targetDuration == 0 {
+		return
+	}
+	change = &LatencyChange{Base: baseDuration, Target: targetDuration}
+	if baseDuration > 0 && targetDuration > 0 {
+		change.Delta = targetDuration - baseDuration
+		change.Regression = c.config.LatencyThreshold > 0 && change.Delta >= minLatencyRegression &&
+			float64(change.Delta) > float64(baseDuration)*c.config.LatencyThreshold
+	}
+	return
+}
+
+// runDuration finds the local run record of the historical run by the test case and the time,
+// it is zero if the run is not made through this server
+func (c *runComparer) runDuration(run HistoryRun) (duration time.Duration) {
+	if c.store == nil || run.CreateTime.IsZero() || run.Case == "" {
+		return
+	}
+	query := RunQuery{
+		Suite:    run.Suite,
+		Testcase: run.Case,
+		Since:    (time.Since(run.CreateTime) + time.Hour).String(),
+	}
+	records, err := c.store.Query(query, 0)
+	if err != nil {
+		return
+	}
+	for _, record := range records {
+		start := record.Time.Add(-latencyMatchWindow)
+		end := record.Time.Add(record.Duration + latencyMatchWindow)
+		if record.Duration > 0 && !run.CreateTime.Before(start) && !run.CreateTime.After(end) {
+			duration = record.Duration
+			return
+		}
+	}
+	return
+}
+
+func isSuccessCode(code int32) bool {
+	return code >= 200 && code < 400
+}
+
+// primaryResult returns the result which has the response
+func primaryResult(reply *server.HistoryTestResult) (result *server.TestCaseResult) {
+	result = &server.TestCaseResult{}
+	for _, item := range reply.TestCaseResult {
+		if item.StatusCode != 0 || item.Body != "" {
+			result = item
+		}
+	}
+	return
+}
+
+func diffHeaders(base, target []*server.Pair, ignore diffIgnore) (changes []FieldChange) {
+	baseHeaders, targetHeaders := canonicalHeaders(base), canonicalHeaders(target)
+	var keys []string
+	for key := range baseHeaders {
+		keys = append(keys, key)
+	}
+	for key := range targetHeaders {
+		if _, ok := baseHeaders[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if ignore.headers[key] {
+			continue
+		}
+		baseValue, inBase := baseHeaders[key]
+		targetValue, inTarget := targetHeaders[key]
+		switch {
+		case !inBase:
+			changes = append(changes, FieldChange{Path: key, Kind: changeAdded, Target: targetValue})
+		case !inTarget:
+			changes = append(changes, FieldChange{Path: key, Kind: changeRemoved, Base: baseValue})
+		case baseValue != targetValue:
+			changes = append(changes, FieldChange{Path: key, Kind: changeChanged, Base: baseValue, Target: targetValue})
+		}
+	}
+	return
+}
+
+func canonicalHeaders(pairs []*server.Pair) map[string]string {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		headers[http.CanonicalHeaderKey(pair.Key)] = pair.Value
+	}
+	return headers
+}
+
+// diffBody compares the JSON bodies structurally, or compares them as text if any of them is not JSON
+func diffBody(base, target string, ignore diffIgnore) (changes []FieldChange) {
+	baseData, baseErr := decodeJSON(base)
+	targetData, targetErr := decodeJSON(target)
+	if baseErr != nil || targetErr != nil {
+		if base != target {
+			changes = append(changes, FieldChange{Path: "$", Kind: changeChanged,
+				Base: truncate(base), Target: truncate(target)})
+		}
+		return
+	}
+	diffJSON("", "", baseData, targetData, ignore, &changes)
+	return
+}
+
+func decodeJSON(text string) (data any, err error) {
+	decoder := json.NewDecoder(bytes.NewBufferString(text))
+	decoder.UseNumber()
+	err = decoder.Decode(&data)
+	return
+}
+
+func diffJSON(path, key string, base, target any, ignore diffIgnore, changes *[]FieldChange) {
+	if ignore.match(path, key) {
+		return
+	}
+
+	switch baseValue := base.(type) {
+	case map[string]any:
+		if targetValue, ok := target.(map[string]any); ok {
+			var keys []string
+			for k := range baseValue {
+				keys = append(keys, k)
+			}
+			for k := range targetValue {
+				if _, ok := baseValue[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			slices.Sort(keys)
+
+			for _, k := range keys {
+				childPath := joinPath(path, k)
+				baseChild, inBase := baseValue[k]
+				targetChild, inTarget := targetValue[k]
+				switch {
+				case ignore.match(childPath, k):
+				case !inBase:
+					*changes = append(*changes, FieldChange{Path: childPath, Kind: changeAdded, Target: targetChild})
+				case !inTarget:
+					*changes = append(*changes, FieldChange{Path: childPath, Kind: changeRemoved, Base: baseChild})
+				default:
+					diffJSON(childPath, k, baseChild, targetChild, ignore, changes)
+				}
+			}
+			return
+		}
+	case []any:
+		if targetValue, ok := target.([]any); ok {
+			for i := 0; i < max(len(baseValue), len(targetValue)); i++ {
+				childPath := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(baseValue):
+					*changes = append(*changes, FieldChange{Path: childPath, Kind: changeAdded, Target: targetValue[i]})
+				case i >= len(targetValue):
+					*changes = append(*changes, FieldChange{Path: childPath, Kind: changeRemoved, Base: baseValue[i]})
+				default:
+					diffJSON(childPath, "", baseValue[i], targetValue[i], ignore, changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(base, target) {
+		if path == "" {
+			path = "$"
+		}
+		*changes = append(*changes, FieldChange{Path: path, Kind: changeChanged, Base: base, Target: target})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// truncate cuts the long text on a rune boundary
+func truncate(text string) string {
+	if len(text) <= maxDiffValueLength {
+		return text
+	}
+	end := maxDiffValueLength
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end] + "..."
+}
+
+var arrayIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// diffIgnore matches the volatile fields and headers
+type diffIgnore struct {
+	fields  map[string]bool
+	paths   []string
+	headers map[string]bool
+}
+
+func newDiffIgnore(fields, headers []string) (ignore diffIgnore) {
+	ignore.fields = map[string]bool{}
+	ignore.headers = map[string]bool{}
+	for _, field := range fields {
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+		if strings.ContainsAny(field, ".[") {
+			ignore.paths = append(ignore.paths, field)
+		} else if field != "" {
+			ignore.fields[strings.ToLower(field)] = true
+		}
+	}
+	for _, header := range headers {
+		ignore.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	return
+}
+
+// match checks the field name at any depth, and the path in which the array indexes could be [*]
+func (i diffIgnore) match(path, key string) bool {
+	if key != "" && i.fields[strings.ToLower(key)] {
+		return true
+	}
+	wildcard := arrayIndexPattern.ReplaceAllString(path, "[*]")
+	for _, item := range i.paths {
+		if item == path || item == wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary renders the differences in a readable way
+func (r DiffResult) Summary() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d comparisons, %d regressions\n", len(r.Diffs), r.Regressions)
+	for _, diff := range r.Diffs {
+		fmt.Fprintf(&buf, "\n## %s/%s: %s (%s) -> %s (%s)", diff.Suite, diff.Case,
+			diff.Base.ID, diff.Base.CreateTime.Format("2006-01-02 15:04:05"),
+			diff.Target.ID, diff.Target.CreateTime.Format("2006-01-02 15:04:05"))
+		if diff.Regression {
+			buf.WriteString(" REGRESSION")
+		}
+		buf.WriteString("\n")
+
+		if diff.Latency != nil {
+			fmt.Fprintf(&buf, "- latency: %s\n", diff.Latency.describe())
+		}
+		if diff.Status == nil && diff.StatusCode == nil && len(diff.Headers) == 0 && len(diff.Body) == 0 {
+			buf.WriteString("no difference\n")
+			continue
+		}
+		if diff.Status != nil {
+			fmt.Fprintf(&buf, "- status: %v -> %v\n", diff.Status.Base, diff.Status.Target)
+		}
+		if diff.StatusCode != nil {
+			fmt.Fprintf(&buf, "- status code: %v -> %v\n", diff.StatusCode.Base, diff.StatusCode.Target)
+		}
+		if diff.Target.Error != "" {
+			fmt.Fprintf(&buf, "- error: %s\n", diff.Target.Error)
+		}
+		for _, change := range diff.Headers {
+			fmt.Fprintf(&buf, "- header %s %s\n", change.Path, change.describe())
+		}
+		for _, change := range diff.Body {
+			fmt.Fprintf(&buf, "- body %s %s\n", change.Path, change.describe())
+		}
+	}
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(&buf, "\nskipped:\n- %s\n", strings.Join(r.Skipped, "\n- "))
+	}
+	if len(r.Diffs) > 0 && !slices.ContainsFunc(r.Diffs, func(diff RunDiff) bool { return diff.Latency != nil }) {
+		buf.WriteString("\nlatency is not compared, since the runs are not recorded in the local run store\n")
+	}
+	return buf.String()
+}
+
+func (c LatencyChange) describe() string {
+	text := fmt.Sprintf("%s -> %s", formatLatency(c.Base), formatLatency(c.Target))
+	if c.Base > 0 && c.Target > 0 {
+		sign := "+"
+		if c.Delta < 0 {
+			sign = ""
+		}
+		text += fmt.Sprintf(" (%s%s)", sign, c.Delta.Round(time.Millisecond))
+	}
+	if c.Regression {
+		text += " slower than the threshold"
+	}
+	return text
+}
+
+func formatLatency(duration time.Duration) string {
+	if duration == 0 {
+		return "unknown"
+	}
+	return duration.Round(time.Millisecond).String()
+}
+
+func (c FieldChange) describe() string {
+	switch c.Kind {
+	case changeAdded:
+		return fmt.Sprintf("added: %s", objectToJSON(c.Target))
+	case changeRemoved:
+		return fmt.Sprintf("removed: %s", objectToJSON(c.Base))
+	default:
+		return fmt.Sprintf("changed: %s -> %s", objectToJSON(c.Base), objectToJSON(c.Target))
+	}
+}
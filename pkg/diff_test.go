@@ -0,0 +1,286 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDiffBody(t *testing.T) {
+	ignore := newDiffIgnore([]string{"ID", "$.data.items[*].updated", "meta.trace"}, nil)
+	tests := []struct {
+		name     string
+		base     string
+		target   string
+		expected []FieldChange
+	}{
+		{name: "same", base: `{"a":1,"b":[1,2]}`, target: `{"b":[1,2],"a":1}`},
+		{name: "changed", base: `{"a":1}`, target: `{"a":2}`,
+			expected: []FieldChange{{Path: "a", Kind: changeChanged, Base: json.Number("1"), Target: json.Number("2")}}},
+		{name: "added and removed", base: `{"a":1,"b":{"c":true}}`, target: `{"b":{"d":null},"e":"x"}`,
+			expected: []FieldChange{
+				{Path: "a", Kind: changeRemoved, Base: json.Number("1")},
+				{Path: "b.c", Kind: changeRemoved, Base: true},
+				{Path: "b.d", Kind: changeAdded},
+				{Path: "e", Kind: changeAdded, Target: "x"},
+			}},
+		{name: "array items", base: `[1,2]`, target: `[1,3,4]`,
+			expected: []FieldChange{
+				{Path: "[1]", Kind: changeChanged, Base: json.Number("2"), Target: json.Number("3")},
+				{Path: "[2]", Kind: changeAdded, Target: json.Number("4")},
+			}},
+		{name: "type changed", base: `{"a":[1]}`, target: `{"a":"1"}`,
+			expected: []FieldChange{{Path: "a", Kind: changeChanged, Base: []any{json.Number("1")}, Target: "1"}}},
+		{name: "root value", base: `1`, target: `2`,
+			expected: []FieldChange{{Path: "$", Kind: changeChanged, Base: json.Number("1"), Target: json.Number("2")}}},
+		{name: "ignored field at any depth", base: `{"id":1,"data":{"Id":2}}`, target: `{"id":3,"data":{"Id":4}}`},
+		{name: "ignored path", base: `{"data":{"items":[{"updated":1,"name":"a"}]},"meta":{"trace":"x"}}`,
+			target: `{"data":{"items":[{"updated":2,"name":"a"}]},"meta":{"trace":"y"}}`},
+		{name: "text", base: "ok", target: "failed",
+			expected: []FieldChange{{Path: "$", Kind: changeChanged, Base: "ok", Target: "failed"}}},
+		{name: "same text", base: "ok", target: "ok"},
+		{name: "long text", base: strings.Repeat("a", maxDiffValueLength+1), target: "{}",
+			expected: []FieldChange{{Path: "$", Kind: changeChanged, Base: strings.Repeat("a", maxDiffValueLength) + "...", Target: "{}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffBody(tt.base, tt.target, ignore)
+			if !equalChanges(changes, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+}
+
+func TestDiffHeaders(t *testing.T) {
+	ignore := newDiffIgnore(nil, []string{"date"})
+	base := []*server.Pair{{Key: "content-type", Value: "application/json"}, {Key: "X-Old", Value: "1"}, {Key: "Date", Value: "a"}}
+	target := []*server.Pair{{Key: "Content-Type", Value: "text/plain"}, {Key: "X-New", Value: "2"}, {Key: "Date", Value: "b"}}
+	expected := []FieldChange{
+		{Path: "Content-Type", Kind: changeChanged, Base: "application/json", Target: "text/plain"},
+		{Path: "X-New", Kind: changeAdded, Target: "2"},
+		{Path: "X-Old", Kind: changeRemoved, Base: "1"},
+	}
+	if changes := diffHeaders(base, target, ignore); !equalChanges(changes, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, changes)
+	}
+}
+
+func TestDiffRunsRegression(t *testing.T) {
+	tests := []struct {
+		name       string
+		base       *server.TestCaseResult
+		target     *server.TestCaseResult
+		regression bool
+		status     bool
+		statusCode bool
+	}{
+		{name: "same", base: &server.TestCaseResult{StatusCode: 200}, target: &server.TestCaseResult{StatusCode: 200}},
+		{name: "failed", base: &server.TestCaseResult{StatusCode: 200}, target: &server.TestCaseResult{StatusCode: 200, Error: "mismatch"},
+			regression: true, status: true},
+		{name: "server error", base: &server.TestCaseResult{StatusCode: 200}, target: &server.TestCaseResult{StatusCode: 500},
+			regression: true, statusCode: true},
+		{name: "recovered", base: &server.TestCaseResult{StatusCode: 500, Error: "mismatch"}, target: &server.TestCaseResult{StatusCode: 200},
+			status: true, statusCode: true},
+		{name: "redirect", base: &server.TestCaseResult{StatusCode: 200}, target: &server.TestCaseResult{StatusCode: 302},
+			statusCode: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := diffRuns(&server.HistoryTestResult{TestCaseResult: []*server.TestCaseResult{tt.base}},
+				&server.HistoryTestResult{TestCaseResult: []*server.TestCaseResult{tt.target}}, newDiffIgnore(nil, nil))
+			if diff.Regression != tt.regression || (diff.Status != nil) != tt.status || (diff.StatusCode != nil) != tt.statusCode {
+				t.Fatalf("unexpected diff %+v", diff)
+			}
+		})
+	}
+}
+
+func TestDiffRuns(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		args     DiffRunsRequest
+		diffs    [][2]string
+		skipped  int
+		expected []string
+		err      string
+	}{
+		{name: "latest two runs", args: DiffRunsRequest{Suite: "sample", Testcase: "a"}, diffs: [][2]string{{"a2", "a3"}},
+			expected: []string{"1 comparisons, 1 regressions", "REGRESSION", "- status code: 200 -> 500", `- body name changed: "a" -> "b"`}},
+		{name: "before the target", args: DiffRunsRequest{Suite: "sample", Testcase: "a", TargetID: "a2"}, diffs: [][2]string{{"a1", "a2"}},
+			expected: []string{"no difference"}},
+		{name: "given IDs", args: DiffRunsRequest{BaseID: "a1", TargetID: "a3", IgnoreFields: []string{"name"}}, diffs: [][2]string{{"a1", "a3"}}},
+		{name: "all the cases", args: DiffRunsRequest{Suite: "sample"}, diffs: [][2]string{{"a2", "a3"}}, skipped: 1,
+			expected: []string{"skipped:\n- b: no run before the target one to compare with"}},
+		{name: "the first run", args: DiffRunsRequest{Suite: "sample", Testcase: "a", TargetID: "a1"}, err: "no run before"},
+		{name: "unknown target", args: DiffRunsRequest{Suite: "sample", Testcase: "a", TargetID: "x"}, err: `run "x" is not found`},
+		{name: "no run", args: DiffRunsRequest{Suite: "sample", Testcase: "c"}, err: "no run found"},
+		{name: "unknown ID", args: DiffRunsRequest{BaseID: "x", TargetID: "a1"}, err: `failed to get the historical run "x"`},
+		{name: "no suite", args: DiffRunsRequest{Testcase: "a"}, err: "suite is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"}, &server.TestCase{Name: "a"}, &server.TestCase{Name: "b"})
+			addRunResult(fake, "sample", "a", "a1", now.Add(-3*time.Hour), &server.TestCaseResult{StatusCode: 200, Body: `{"name":"a"}`})
+			addRunResult(fake, "sample", "a", "a3", now, &server.TestCaseResult{StatusCode: 500, Body: `{"name":"b"}`})
+			addRunResult(fake, "sample", "a", "a2", now.Add(-time.Hour), &server.TestCaseResult{StatusCode: 200, Body: `{"name":"a"}`})
+			addRunResult(fake, "sample", "b", "b1", now, &server.TestCaseResult{StatusCode: 200})
+
+			comparer := NewRunComparer(runner.runners, runner.pool, runner.sessions, nil, NewDefaultConfig().Diff)
+			result, data, err := comparer.DiffRuns(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Diffs) != len(tt.diffs) || len(data.Skipped) != tt.skipped {
+				t.Fatalf("expected %d diffs and %d skipped, got %+v", len(tt.diffs), tt.skipped, data)
+			}
+			for i, pair := range tt.diffs {
+				if data.Diffs[i].Base.ID != pair[0] || data.Diffs[i].Target.ID != pair[1] {
+					t.Fatalf("expected runs %v, got %s and %s", pair, data.Diffs[i].Base.ID, data.Diffs[i].Target.ID)
+				}
+			}
+			text := result.Content[0].(*mcp.TextContent).Text
+			for _, line := range tt.expected {
+				if !strings.Contains(text, line) {
+					t.Fatalf("expected %q in %q", line, text)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffRunsLatency(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name       string
+		records    map[string]time.Duration
+		threshold  float64
+		latency    *LatencyChange
+		regression bool
+		expected   string
+	}{{
+		name:     "not recorded",
+		expected: "latency is not compared",
+	}, {
+		name:     "faster",
+		records:  map[string]time.Duration{"a1": 300 * time.Millisecond, "a2": 200 * time.Millisecond},
+		latency:  &LatencyChange{Base: 300 * time.Millisecond, Target: 200 * time.Millisecond, Delta: -100 * time.Millisecond},
+		expected: "- latency: 300ms -> 200ms (-100ms)",
+	}, {
+		name:       "slower",
+		records:    map[string]time.Duration{"a1": 200 * time.Millisecond, "a2": 500 * time.Millisecond},
+		latency:    &LatencyChange{Base: 200 * time.Millisecond, Target: 500 * time.Millisecond, Delta: 300 * time.Millisecond, Regression: true},
+		regression: true,
+		expected:   "- latency: 200ms -> 500ms (+300ms) slower than the threshold",
+	}, {
+		name:      "slower within the threshold",
+		records:   map[string]time.Duration{"a1": 200 * time.Millisecond, "a2": 500 * time.Millisecond},
+		latency:   &LatencyChange{Base: 200 * time.Millisecond, Target: 500 * time.Millisecond, Delta: 300 * time.Millisecond},
+		expected:  "- latency: 200ms -> 500ms (+300ms)\n",
+		threshold: 2,
+	}, {
+		name:     "too fast to be a regression",
+		records:  map[string]time.Duration{"a1": 10 * time.Millisecond, "a2": 50 * time.Millisecond},
+		latency:  &LatencyChange{Base: 10 * time.Millisecond, Target: 50 * time.Millisecond, Delta: 40 * time.Millisecond},
+		expected: "- latency: 10ms -> 50ms (+40ms)\n",
+	}, {
+		name:     "only the target",
+		records:  map[string]time.Duration{"a2": 500 * time.Millisecond},
+		latency:  &LatencyChange{Target: 500 * time.Millisecond},
+		expected: "- latency: unknown -> 500ms\n",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"}, &server.TestCase{Name: "a"})
+			created := map[string]time.Time{"a1": now.Add(-time.Hour), "a2": now.Add(-time.Minute)}
+			for id, at := range created {
+				addRunResult(fake, "sample", "a", id, at, &server.TestCaseResult{StatusCode: 200, Body: `{}`})
+			}
+
+			store, err := NewRunStore(StoreConfig{Path: filepath.Join(t.TempDir(), "runs.db")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			// the runs of another case and the runs at another time are not matched
+			records := []*RunRecord{
+				{Time: created["a1"].Add(-time.Minute), Tool: "run-test-case", Suite: "sample", Case: "a", Duration: time.Second},
+				{Time: created["a2"], Tool: "run-test-case", Suite: "sample", Case: "b", Duration: time.Second},
+			}
+			for id, duration := range tt.records {
+				records = append(records, &RunRecord{Time: created[id].Add(-duration / 2), Tool: "run-test-case",
+					Suite: "sample", Case: "a", Duration: duration})
+			}
+			for _, record := range records {
+				if err = store.Record(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			config := NewDefaultConfig().Diff
+			if tt.threshold > 0 {
+				config.LatencyThreshold = tt.threshold
+			}
+			comparer := NewRunComparer(runner.runners, runner.pool, runner.sessions, store, config)
+			result, data, err := comparer.DiffRuns(context.Background(), nil, DiffRunsRequest{Suite: "sample", Testcase: "a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			diff := data.Diffs[0]
+			if !reflect.DeepEqual(diff.Latency, tt.latency) || diff.Regression != tt.regression {
+				t.Fatalf("expected latency %+v and regression %v, got %+v and %v", tt.latency, tt.regression, diff.Latency, diff.Regression)
+			}
+			text := result.Content[0].(*mcp.TextContent).Text
+			if !strings.Contains(text, tt.expected) {
+				t.Fatalf("expected %q in %q", tt.expected, text)
+			}
+			if tt.latency != nil && strings.Contains(text, "latency is not compared") {
+				t.Fatalf("the note should not be printed: %q", text)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	text := strings.Repeat("a", maxDiffValueLength-1) + "你好"
+	actual := truncate(text)
+	if !utf8.ValidString(actual) || actual != strings.Repeat("a", maxDiffValueLength-1)+"..." {
+		t.Fatalf("unexpected text %q", actual)
+	}
+	if actual := truncate("short"); actual != "short" {
+		t.Fatalf("the short text should be kept, got %q", actual)
+	}
+}
+
+func addRunResult(fake *fakeRunner, suite, name, id string, created time.Time, result *server.TestCaseResult) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.histories = append(fake.histories, &server.HistoryTestResult{
+		Data:           &server.HistoryTestCase{ID: id, SuiteName: suite, CaseName: name, CreateTime: timestamppb.New(created)},
+		TestCaseResult: []*server.TestCaseResult{result},
+	})
+}
+
+func equalChanges(actual, expected []FieldChange) bool {
+	actualData, _ := json.Marshal(actual)
+	expectedData, _ := json.Marshal(expected)
+	return string(actualData) == string(expectedData)
+}
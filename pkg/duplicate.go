@@ -0,0 +1,324 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type CopyTestSuiteRequest struct {
+	Source string `json:"source,omitempty" jsonschema:"the name of the source test suite, the active suite of the session is used if it is empty"`
+	Target string `json:"target" jsonschema:"the name of the target test suite"`
+	Force  bool   `json:"force,omitempty" jsonschema:"overwrite the target test suite if it exists"`
+}
+
+type CopyTestCaseRequest struct {
+	SourceSuite string `json:"sourceSuite,omitempty" jsonschema:"the name of the source test suite, the active suite of the session is used if it is empty"`
+	SourceCase  string `json:"sourceCase" jsonschema:"the name of the source test case"`
+	TargetSuite string `json:"targetSuite,omitempty" jsonschema:"the name of the target test suite, default is the source suite"`
+	TargetCase  string `json:"targetCase" jsonschema:"the name of the target test case"`
+	Force       bool   `json:"force,omitempty" jsonschema:"overwrite the target test case if it exists"`
+}
+
+func (r *gRPCRunner) DuplicateTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CopyTestSuiteRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	var runner server.RunnerClient
+	var replace bool
+	if runner, replace, err = r.prepareSuiteCopy(ctx, request, &args); err != nil {
+		return
+	}
+
+	if replace {
+		err = replaceTestSuite(ctx, runner, args.Source, args.Target)
+	} else {
+		err = duplicateTestSuite(ctx, runner, args.Source, args.Target)
+	}
+	if err == nil {
+		result = textResult(fmt.Sprintf("duplicated test suite %q to %q", args.Source, args.Target))
+	}
+	return
+}
+
+func (r *gRPCRunner) RenameTestSuite(ctx context.Context, request *mcp.CallToolRequest, args CopyTestSuiteRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	var runner server.RunnerClient
+	var replace bool
+	if runner, replace, err = r.prepareSuiteCopy(ctx, request, &args); err != nil {
+		return
+	}
+
+	if replace {
+		if err = replaceTestSuite(ctx, runner, args.Source, args.Target); err == nil {
+			err = replyError(runner.DeleteTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Source}))
+		}
+	} else {
+		err = moveTestSuite(ctx, runner, args.Source, args.Target)
+	}
+	if err == nil {
+		result = textResult(fmt.Sprintf("renamed test suite %q to %q", args.Source, args.Target))
+	}
+	return
+}
+
+func (r *gRPCRunner) DuplicateTestCase(ctx context.Context, request *mcp.CallToolRequest, args CopyTestCaseRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	var runner server.RunnerClient
+	var replace bool
+	if runner, replace, err = r.prepareCaseCopy(ctx, request, &args); err != nil {
+		return
+	}
+
+	switch {
+	case replace:
+		err = replaceTestCase(ctx, runner, args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase)
+	case args.SourceCase != args.TargetCase:
+		// the native one requires a different case name
+		err = replyError(runner.DuplicateTestCase(ctx, &server.TestCaseDuplicate{
+			SourceSuiteName: args.SourceSuite,
+			SourceCaseName:  args.SourceCase,
+			TargetSuiteName: args.TargetSuite,
+			TargetCaseName:  args.TargetCase,
+		}))
+		if status.Code(err) == codes.Unimplemented {
+			err = copyTestCase(ctx, runner, args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase)
+		}
+	default:
+		err = copyTestCase(ctx, runner, args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase)
+	}
+	if err == nil {
+		result = textResult(fmt.Sprintf("duplicated test case %q/%q to %q/%q",
+			args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase))
+	}
+	return
+}
+
+func (r *gRPCRunner) RenameTestCase(ctx context.Context, request *mcp.CallToolRequest, args CopyTestCaseRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	if args.TargetSuite != "" && args.TargetSuite != args.SourceSuite {
+		err = fmt.Errorf("cannot rename a test case across suites, please move it with bulk-test-cases")
+		return
+	}
+
+	var runner server.RunnerClient
+	var replace bool
+	if runner, replace, err = r.prepareCaseCopy(ctx, request, &args); err != nil {
+		return
+	}
+
+	if replace {
+		if err = replaceTestCase(ctx, runner, args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase); err == nil {
+			err = deleteTestCase(ctx, runner, args.SourceSuite, args.SourceCase)
+		}
+	} else {
+		err = replyError(runner.RenameTestCase(ctx, &server.TestCaseDuplicate{
+			SourceSuiteName: args.SourceSuite,
+			SourceCaseName:  args.SourceCase,
+			TargetSuiteName: args.TargetSuite,
+			TargetCaseName:  args.TargetCase,
+		}))
+		if status.Code(err) == codes.Unimplemented {
+			if err = copyTestCase(ctx, runner, args.SourceSuite, args.SourceCase, args.TargetSuite, args.TargetCase); err == nil {
+				err = deleteTestCase(ctx, runner, args.SourceSuite, args.SourceCase)
+			}
+		}
+	}
+	if err == nil {
+		result = textResult(fmt.Sprintf("renamed test case %q to %q in suite %q", args.SourceCase, args.TargetCase, args.SourceSuite))
+	}
+	return
+}
+
+// prepareSuiteCopy fills the defaults, makes sure the source exists, and tells if the existing target is replaced.
+// The target is kept until the copy succeeds.
+func (r *gRPCRunner) prepareSuiteCopy(ctx context.Context, request *mcp.CallToolRequest, args *CopyTestSuiteRequest) (
+	runner server.RunnerClient, replace bool, err error) {
+	if args.Source == "" {
+		args.Source = r.session(request).Suite
+	}
+	if args.Source == "" || args.Target == "" {
+		err = fmt.Errorf("both source and target are required")
+		return
+	}
+	if args.Source == args.Target {
+		err = fmt.Errorf("the target should be different from the source")
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner = server.NewRunnerClient(conn)
+
+	if _, err = runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Source}); err != nil {
+		err = fmt.Errorf("failed to get the source test suite %q: %w", args.Source, err)
+		return
+	}
+	if replace, err = checkExists(runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Target})); err == nil && replace && !args.Force {
+		err = fmt.Errorf("test suite %q already exists, set force to overwrite it", args.Target)
+	}
+	return
+}
+
+// prepareCaseCopy fills the defaults, makes sure the source exists, and tells if the existing target is replaced.
+// The target is kept until the copy succeeds.
+func (r *gRPCRunner) prepareCaseCopy(ctx context.Context, request *mcp.CallToolRequest, args *CopyTestCaseRequest) (
+	runner server.RunnerClient, replace bool, err error) {
+	if args.SourceSuite == "" {
+		args.SourceSuite = r.session(request).Suite
+	}
+	if args.TargetSuite == "" {
+		args.TargetSuite = args.SourceSuite
+	}
+	if args.SourceSuite == "" || args.SourceCase == "" || args.TargetCase == "" {
+		err = fmt.Errorf("sourceSuite, sourceCase and targetCase are required")
+		return
+	}
+	if args.SourceSuite == args.TargetSuite && args.SourceCase == args.TargetCase {
+		err = fmt.Errorf("the target should be different from the source")
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner = server.NewRunnerClient(conn)
+
+	if _, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: args.SourceSuite, Testcase: args.SourceCase}); err != nil {
+		err = fmt.Errorf("failed to get the source test case %q in suite %q: %w", args.SourceCase, args.SourceSuite, err)
+		return
+	}
+	if replace, err = checkExists(runner.GetTestCase(ctx, &server.TestCaseIdentity{
+		Suite: args.TargetSuite, Testcase: args.TargetCase})); err == nil && replace && !args.Force {
+		err = fmt.Errorf("test case %q already exists in suite %q, set force to overwrite it", args.TargetCase, args.TargetSuite)
+	}
+	return
+}
+
+// replaceTestSuite copies the source to a temporary suite, the target is replaced only after the copy succeeds
+func replaceTestSuite(ctx context.Context, runner server.RunnerClient, source, target string) (err error) {
+	temp := fmt.Sprintf("%s-%d", target, time.Now().UnixNano())
+	if err = duplicateTestSuite(ctx, runner, source, temp); err != nil {
+		// clean up the partial copy, the target is untouched
+		_ = replyError(runner.DeleteTestSuite(ctx, &server.TestSuiteIdentity{Name: temp}))
+		return
+	}
+
+	if err = replyError(runner.DeleteTestSuite(ctx, &server.TestSuiteIdentity{Name: target})); err == nil {
+		err = moveTestSuite(ctx, runner, temp, target)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to replace test suite %q, the copy is kept as test suite %q: %w", target, temp, err)
+	}
+	return
+}
+
+// moveTestSuite renames the suite, or copies and deletes it if the runner cannot rename it
+func moveTestSuite(ctx context.Context, runner server.RunnerClient, source, target string) (err error) {
+	err = replyError(runner.RenameTestSuite(ctx, &server.TestSuiteDuplicate{
+		SourceSuiteName: source,
+		TargetSuiteName: target,
+	}))
+	if status.Code(err) == codes.Unimplemented {
+		if err = duplicateTestSuite(ctx, runner, source, target); err == nil {
+			err = replyError(runner.DeleteTestSuite(ctx, &server.TestSuiteIdentity{Name: source}))
+		}
+	}
+	return
+}
+
+// replaceTestCase overwrites the existing target with the source in place
+func replaceTestCase(ctx context.Context, runner server.RunnerClient, sourceSuite, sourceCase, targetSuite, targetCase string) (err error) {
+	var testCase *server.TestCase
+	if testCase, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: sourceSuite, Testcase: sourceCase}); err == nil {
+		testCase.Name = targetCase
+		testCase.SuiteName = targetSuite
+		err = replyError(runner.UpdateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: targetSuite, Data: testCase}))
+	}
+	return
+}
+
+// duplicateTestSuite copies the suite along with its params and spec, which are not copied by the native RPC
+func duplicateTestSuite(ctx context.Context, runner server.RunnerClient, source, target string) (err error) {
+	var suite *server.TestSuite
+	if suite, err = runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: source}); err != nil {
+		return
+	}
+
+	err = replyError(runner.DuplicateTestSuite(ctx, &server.TestSuiteDuplicate{
+		SourceSuiteName: source,
+		TargetSuiteName: target,
+	}))
+	if status.Code(err) == codes.Unimplemented {
+		err = copyTestSuite(ctx, runner, suite, target)
+	}
+	if err == nil {
+		suite.Name = target
+		err = replyError(runner.UpdateTestSuite(ctx, suite))
+	}
+	return
+}
+
+// copyTestSuite creates the target suite, and copies all the test cases one by one
+func copyTestSuite(ctx context.Context, runner server.RunnerClient, suite *server.TestSuite, target string) (err error) {
+	var kind string
+	if suite.Spec != nil {
+		kind = suite.Spec.Kind
+	}
+	if err = replyError(runner.CreateTestSuite(ctx, &server.TestSuiteIdentity{
+		Name: target, Api: suite.Api, Kind: kind})); err != nil {
+		return
+	}
+
+	var items *server.Suite
+	if items, err = runner.ListTestCase(ctx, &server.TestSuiteIdentity{Name: suite.Name}); err == nil {
+		for _, testCase := range items.Items {
+			if err = copyTestCase(ctx, runner, suite.Name, testCase.Name, target, testCase.Name); err != nil {
+				break
+			}
+		}
+	}
+	return
+}
+
+// checkExists tells if the object exists according to the error of getting it.
+// Only the error of the missing object means it doesn't exist, the other errors are returned.
+func checkExists[T any](_ T, err error) (exists bool, e error) {
+	switch {
+	case err == nil:
+		exists = true
+	case !isNotFound(err):
+		e = err
+	}
+	return
+}
+
+// notFoundPattern matches the errors of the runner loaders, such as "suite a not found" or "record not found"
+var notFoundPattern = regexp.MustCompile(`(?i)\bnot found\b`)
+
+// isNotFound tells if the error is about a missing object, the runner reports it without the NotFound code
+func isNotFound(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return true
+	case codes.Unknown:
+		return notFoundPattern.MatchString(status.Convert(err).Message())
+	}
+	return false
+}
+
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: text},
+		},
+	}
+}
@@ -0,0 +1,210 @@
+package pkg
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCopyTestSuite(t *testing.T) {
+	tests := []struct {
+		name   string
+		rename bool
+		args   CopyTestSuiteRequest
+		errors []string
+		err    string
+		// suites are the expected suites and their cases after the copy
+		suites map[string][]string
+	}{{
+		name:   "duplicate",
+		args:   CopyTestSuiteRequest{Source: "source", Target: "new"},
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"old"}, "new": {"a", "b"}},
+	}, {
+		name:   "rename",
+		rename: true,
+		args:   CopyTestSuiteRequest{Source: "source", Target: "new"},
+		suites: map[string][]string{"target": {"old"}, "new": {"a", "b"}},
+	}, {
+		name:   "existing target",
+		args:   CopyTestSuiteRequest{Source: "source", Target: "target"},
+		err:    "already exists",
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"old"}},
+	}, {
+		name:   "replace the target",
+		args:   CopyTestSuiteRequest{Source: "source", Target: "target", Force: true},
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"a", "b"}},
+	}, {
+		name:   "rename to replace the target",
+		rename: true,
+		args:   CopyTestSuiteRequest{Source: "source", Target: "target", Force: true},
+		suites: map[string][]string{"target": {"a", "b"}},
+	}, {
+		name:   "missing source keeps the target",
+		args:   CopyTestSuiteRequest{Source: "missing", Target: "target", Force: true},
+		err:    "failed to get the source test suite",
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"old"}},
+	}, {
+		name:   "failed copy keeps the target",
+		args:   CopyTestSuiteRequest{Source: "source", Target: "target", Force: true},
+		errors: []string{"CreateTestCase"},
+		err:    "failed",
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"old"}},
+	}, {
+		name:   "failed rename keeps the source and target",
+		rename: true,
+		args:   CopyTestSuiteRequest{Source: "source", Target: "target", Force: true},
+		errors: []string{"CreateTestCase"},
+		err:    "failed",
+		suites: map[string][]string{"source": {"a", "b"}, "target": {"old"}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "source", Param: []*server.Pair{{Key: "token", Value: "abc"}}},
+				&server.TestCase{Name: "a"}, &server.TestCase{Name: "b"})
+			fake.addSuite(&server.TestSuite{Name: "target"}, &server.TestCase{Name: "old"})
+			for _, method := range tt.errors {
+				fake.errors["/server.Runner/"+method] = status.Error(codes.Internal, "failed")
+			}
+
+			var err error
+			if tt.rename {
+				_, _, err = runner.RenameTestSuite(context.Background(), nil, tt.args)
+			} else {
+				_, _, err = runner.DuplicateTestSuite(context.Background(), nil, tt.args)
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+
+			if len(fake.suites) != len(tt.suites) {
+				t.Fatalf("expected suites %v, got %v", tt.suites, fake.suites)
+			}
+			for name, cases := range tt.suites {
+				if _, ok := fake.suites[name]; !ok {
+					t.Fatalf("expected suite %q, got %v", name, fake.suites)
+				}
+				if actual := fake.caseNames(name); !slices.Equal(actual, cases) {
+					t.Fatalf("expected cases %v of suite %q, got %v", cases, name, actual)
+				}
+			}
+			if suite := fake.suites[tt.args.Target]; err == nil && paramValue(suite, "token") != "abc" {
+				t.Fatalf("the params should be copied, got %v", suite)
+			}
+		})
+	}
+}
+
+func TestCopyTestCase(t *testing.T) {
+	tests := []struct {
+		name   string
+		rename bool
+		args   CopyTestCaseRequest
+		errors []string
+		err    string
+		// cases are the expected cases and their API after the copy
+		cases map[string]string
+	}{{
+		name:  "duplicate",
+		args:  CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "new"},
+		cases: map[string]string{"source": "/source", "target": "/target", "new": "/source"},
+	}, {
+		name:   "rename",
+		rename: true,
+		args:   CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "new"},
+		cases:  map[string]string{"target": "/target", "new": "/source"},
+	}, {
+		name:  "existing target",
+		args:  CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "target"},
+		err:   "already exists",
+		cases: map[string]string{"source": "/source", "target": "/target"},
+	}, {
+		name:  "replace the target",
+		args:  CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "target", Force: true},
+		cases: map[string]string{"source": "/source", "target": "/source"},
+	}, {
+		name:   "rename to replace the target",
+		rename: true,
+		args:   CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "target", Force: true},
+		cases:  map[string]string{"target": "/source"},
+	}, {
+		name:  "missing source keeps the target",
+		args:  CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "missing", TargetCase: "target", Force: true},
+		err:   "failed to get the source test case",
+		cases: map[string]string{"source": "/source", "target": "/target"},
+	}, {
+		name:   "failed copy keeps the target",
+		args:   CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "target", Force: true},
+		errors: []string{"UpdateTestCase"},
+		err:    "failed",
+		cases:  map[string]string{"source": "/source", "target": "/target"},
+	}, {
+		name:   "failed rename keeps the source",
+		rename: true,
+		args:   CopyTestCaseRequest{SourceSuite: "sample", SourceCase: "source", TargetCase: "new"},
+		errors: []string{"CreateTestCase"},
+		err:    "failed",
+		cases:  map[string]string{"source": "/source", "target": "/target"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"},
+				&server.TestCase{Name: "source", Request: &server.Request{Api: "/source"}},
+				&server.TestCase{Name: "target", Request: &server.Request{Api: "/target"}})
+			for _, method := range tt.errors {
+				fake.errors["/server.Runner/"+method] = status.Error(codes.Internal, "failed")
+			}
+
+			var err error
+			if tt.rename {
+				_, _, err = runner.RenameTestCase(context.Background(), nil, tt.args)
+			} else {
+				_, _, err = runner.DuplicateTestCase(context.Background(), nil, tt.args)
+			}
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+
+			if names := fake.caseNames("sample"); len(names) != len(tt.cases) {
+				t.Fatalf("expected cases %v, got %v", tt.cases, names)
+			}
+			for name, api := range tt.cases {
+				if testCase := fake.testCase("sample", name); testCase == nil || testCase.Request.Api != api {
+					t.Fatalf("expected case %q with API %q, got %v", name, api, testCase)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckExists(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		exists bool
+		failed bool
+	}{
+		{name: "exists", exists: true},
+		{name: "not found code", err: status.Error(codes.NotFound, "suite a is not found")},
+		{name: "missing suite of the runner", err: status.Error(codes.Unknown, "suite a not found")},
+		{name: "missing record of the runner", err: status.Error(codes.Unknown, "record not found")},
+		{name: "unknown error", err: status.Error(codes.Unknown, "failed to read the file"), failed: true},
+		{name: "internal error", err: status.Error(codes.Internal, "failed"), failed: true},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, "invalid name"), failed: true},
+		{name: "unavailable", err: status.Error(codes.Unavailable, "connection refused"), failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exists, err := checkExists(&server.TestSuite{}, tt.err)
+			if exists != tt.exists || (err != nil) != tt.failed {
+				t.Fatalf("expected exists %v and failed %v, got %v and %v", tt.exists, tt.failed, exists, err)
+			}
+		})
+	}
+}
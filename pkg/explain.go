@@ -0,0 +1,386 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const (
+	ExplainRerun = "rerun"
+	ExplainLast  = "last"
+
+	assertionStatus     = "status"
+	assertionHeader     = "header"
+	assertionBody       = "body"
+	assertionBodyField  = "bodyField"
+	assertionSchema     = "schema"
+	assertionVerify     = "verify"
+	assertionRender     = "render"
+	assertionConnection = "connection"
+	assertionNotFound   = "notFound"
+	assertionOther      = "other"
+)
+
+type ExplainFailureRequest struct {
+	Suite    string `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase string `json:"testcase" jsonschema:"the name of test case"`
+	Source   string `json:"source,omitempty" jsonschema:"rerun the test case, or load the last result from the history: rerun or last, default is rerun"`
+}
+
+// FailureDiagnosis explains why a test case failed
+type FailureDiagnosis struct {
+	Suite      string             `json:"suite"`
+	Case       string             `json:"case"`
+	Source     string             `json:"source"`
+	Passed     bool               `json:"passed"`
+	StatusCode int32              `json:"statusCode,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	Request    SentRequest        `json:"request"`
+	Failures   []AssertionFailure `json:"failures,omitempty"`
+	Causes     []string           `json:"causes,omitempty"`
+}
+
+// SentRequest is the request which was sent, it falls back to the request template if the rendered one is unknown
+type SentRequest struct {
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Rendered bool              `json:"rendered"`
+}
+
+// AssertionFailure is a failed assertion with the expected and actual values
+type AssertionFailure struct {
+	Kind     string `json:"kind"`
+	Target   string `json:"target,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (r *gRPCRunner) ExplainFailure(ctx context.Context, request *mcp.CallToolRequest, args ExplainFailureRequest) (
+	result *mcp.CallToolResult, data FailureDiagnosis, err error) {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	if args.Source == "" {
+		args.Source = ExplainRerun
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+
+	var testCase *server.TestCase
+	if testCase, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase}); err != nil {
+		err = fmt.Errorf("failed to get test case %q: %w", args.Testcase, err)
+		return
+	}
+	var suite *server.TestSuite
+	if suite, err = runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Suite}); err != nil {
+		err = fmt.Errorf("failed to get test suite %q: %w", args.Suite, err)
+		return
+	}
+
+	var caseResult *server.TestCaseResult
+	switch args.Source {
+	case ExplainRerun:
+		caseResult, err = runner.RunTestCase(ctx, &server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase})
+	case ExplainLast:
+		caseResult, err = lastResult(ctx, runner, args.Suite, args.Testcase)
+	default:
+		err = fmt.Errorf("not supported source %q, should be rerun or last", args.Source)
+	}
+	if err != nil {
+		return
+	}
+
+	data = diagnose(suite, testCase, caseResult)
+	data.Source = args.Source
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.String()},
+		},
+	}
+	return
+}
+
+// lastResult loads the latest result of the test case from the runner's history
+func lastResult(ctx context.Context, runner server.RunnerClient, suite, testcase string) (result *server.TestCaseResult, err error) {
+	var cases *server.HistoryTestCases
+	if cases, err = runner.GetTestCaseAllHistory(ctx, &server.TestCase{SuiteName: suite, Name: testcase}); err != nil {
+		return
+	}
+	if len(cases.Data) == 0 {
+		err = fmt.Errorf("no run of test case %q in the history, please rerun it", testcase)
+		return
+	}
+	latest := slices.MaxFunc(cases.Data, func(a, b *server.HistoryTestCase) int {
+		return a.CreateTime.AsTime().Compare(b.CreateTime.AsTime())
+	})
+
+	var reply *server.HistoryTestResult
+	if reply, err = runner.GetHistoryTestCaseWithResult(ctx, &server.HistoryTestCase{ID: latest.ID}); err == nil {
+		result = primaryResult(reply)
+		if result.Error == "" {
+			result.Error = reply.Error
+		}
+	}
+	return
+}
+
+func diagnose(suite *server.TestSuite, testCase *server.TestCase, caseResult *server.TestCaseResult) (data FailureDiagnosis) {
+	data = FailureDiagnosis{
+		Suite:      suite.Name,
+		Case:       testCase.Name,
+		Passed:     caseResult.Error == "",
+		StatusCode: caseResult.StatusCode,
+		Error:      caseResult.Error,
+		Request:    sentRequest(suite, testCase, caseResult.Output),
+	}
+	if data.Passed {
+		return
+	}
+
+	expect := testCase.Response
+	if expect == nil {
+		expect = &server.Response{}
+	}
+	for _, line := range splitErrors(caseResult.Error) {
+		data.Failures = append(data.Failures, parseFailure(line, expect, caseResult)...)
+	}
+	data.Causes = likelyCauses(data, suite)
+	return
+}
+
+var (
+	sentURLPattern     = regexp.MustCompile(`start to send request to (\S+) with method (\w+)`)
+	sentHeaderPattern  = regexp.MustCompile(`request header map\[(.*)\]`)
+	headerItemPattern  = regexp.MustCompile(`([\w-]+):\[([^\]]*)\]`)
+	statusPattern      = regexp.MustCompile(`case: .*, expect (\d+), actual (\d+)$`)
+	stringPattern      = regexp.MustCompile(`case: .*, expect (.*), actual (.*)$`)
+	fieldPattern       = regexp.MustCompile(`field\[(.*)\] expect value: '(.*)', actual: '(.*)'`)
+	missingPattern     = regexp.MustCompile(`not found field: (.*)`)
+	verifyPattern      = regexp.MustCompile(`failed to verify: ("(?:[^"\\]|\\.)*"), (.*)`)
+	connectionPatterns = []string{"connection refused", "no such host", "dial tcp", "i/o timeout",
+		"context deadline exceeded", "certificate", "tls:", "EOF", "connection reset"}
+)
+
+// sentRequest finds the rendered request in the runner's output
+func sentRequest(suite *server.TestSuite, testCase *server.TestCase, output string) (req SentRequest) {
+	if match := sentURLPattern.FindStringSubmatch(output); match != nil {
+		req.URL, req.Method, req.Rendered = match[1], match[2], true
+		if match := sentHeaderPattern.FindStringSubmatch(output); match != nil {
+			req.Headers = parseHeaderMap(match[1])
+		}
+		return
+	}
+
+	if testCase.Request != nil {
+		req.Method = testCase.Request.Method
+		req.URL = testCase.Request.Api
+		req.Headers = pairsToMap(testCase.Request.Header)
+	}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	if !strings.HasPrefix(req.URL, "http") && suite.Api != "" {
+		req.URL = strings.TrimSuffix(suite.Api, "/") + "/" + strings.TrimPrefix(req.URL, "/")
+	}
+	return
+}
+
+// parseHeaderMap parses the header in format of Go map, such as Accept:[*/*] Authorization:[Bearer xxx]
+func parseHeaderMap(text string) (headers map[string]string) {
+	headers = map[string]string{}
+	for _, match := range headerItemPattern.FindAllStringSubmatch(text, -1) {
+		headers[match[1]] = match[2]
+	}
+	return
+}
+
+// splitErrors splits the joined errors, the diff of the body takes multiple lines
+func splitErrors(text string) (items []string) {
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if len(items) > 0 && strings.Contains(items[len(items)-1], "got different response body") {
+			items[len(items)-1] += "\n" + line
+			continue
+		}
+		items = append(items, strings.TrimPrefix(trimmed, "error is: "))
+	}
+	return
+}
+
+func parseFailure(line string, expect *server.Response, caseResult *server.TestCaseResult) (failures []AssertionFailure) {
+	failure := AssertionFailure{Kind: assertionOther, Message: line}
+	switch {
+	case strings.Contains(line, "got different response body"):
+		failure.Kind = assertionBody
+		failure.Expected = excerpt(expect.Body)
+		failure.Actual = excerpt(caseResult.Body)
+	case strings.HasPrefix(line, "JSON schema validation failed"):
+		// validate it again to get the paths of the violations
+		if violations := schemaViolations(expect.Schema, caseResult.Body); len(violations) > 0 {
+			return violations
+		}
+		failure.Kind = assertionSchema
+	case fieldPattern.MatchString(line):
+		match := fieldPattern.FindStringSubmatch(line)
+		failure.Kind, failure.Target, failure.Expected, failure.Actual = assertionBodyField, match[1], match[2], match[3]
+	case missingPattern.MatchString(line):
+		failure.Kind, failure.Target = assertionBodyField, missingPattern.FindStringSubmatch(line)[1]
+		failure.Actual = "<missing>"
+		for _, pair := range expect.BodyFieldsExpect {
+			if pair.Key == failure.Target {
+				failure.Expected = pair.Value
+			}
+		}
+	case verifyPattern.MatchString(line):
+		match := verifyPattern.FindStringSubmatch(line)
+		failure.Kind, failure.Target = assertionVerify, match[1]
+		if expr, err := strconv.Unquote(match[1]); err == nil {
+			failure.Target = expr
+		}
+		failure.Expected, failure.Actual = "true", match[2]
+	case statusPattern.MatchString(line) && statusPattern.FindStringSubmatch(line)[1] == strconv.Itoa(int(expect.StatusCode)):
+		match := statusPattern.FindStringSubmatch(line)
+		failure.Kind, failure.Target, failure.Expected, failure.Actual = assertionStatus, "statusCode", match[1], match[2]
+	case stringPattern.MatchString(line):
+		match := stringPattern.FindStringSubmatch(line)
+		failure.Kind, failure.Expected, failure.Actual = assertionHeader, match[1], match[2]
+		// the header name is not in the message, find it by the expected value
+		for _, pair := range expect.Header {
+			if pair.Value == match[1] {
+				failure.Target = pair.Key
+			}
+		}
+	case strings.Contains(line, "failed to render") || strings.Contains(line, "template:"):
+		failure.Kind = assertionRender
+	case strings.HasPrefix(line, "not found suite") || strings.HasPrefix(line, "not found testcase"):
+		failure.Kind = assertionNotFound
+	case slices.ContainsFunc(connectionPatterns, func(pattern string) bool { return strings.Contains(line, pattern) }):
+		failure.Kind = assertionConnection
+	}
+	return append(failures, failure)
+}
+
+// schemaViolations validates the body against the schema, and returns every violation with its path
+func schemaViolations(schema, body string) (failures []AssertionFailure) {
+	if schema == "" || body == "" {
+		return
+	}
+	errs, err := validateJSONSchema(schema, body)
+	if err != nil {
+		return
+	}
+	for _, item := range errs {
+		failures = append(failures, AssertionFailure{
+			Kind:     assertionSchema,
+			Target:   item.Path,
+			Expected: item.Expected,
+			Actual:   item.Actual,
+			Message:  fmt.Sprintf("%s: %s", item.Path, item.Message),
+		})
+	}
+	return
+}
+
+// likelyCauses guesses the reasons of the failures
+func likelyCauses(data FailureDiagnosis, suite *server.TestSuite) (causes []string) {
+	kinds := map[string]bool{}
+	for _, failure := range data.Failures {
+		kinds[failure.Kind] = true
+	}
+	hasAuth := false
+	for key := range data.Request.Headers {
+		if strings.EqualFold(key, "Authorization") || strings.EqualFold(key, "X-Api-Key") || strings.EqualFold(key, "Cookie") {
+			hasAuth = true
+		}
+	}
+
+	switch code := data.StatusCode; {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		if hasAuth {
+			causes = append(causes, fmt.Sprintf("auth: got %d, the credential in the request is invalid, expired or lacks the permission", code))
+		} else {
+			causes = append(causes, fmt.Sprintf("auth: got %d, and there is no Authorization header in the request", code))
+		}
+	case code == http.StatusNotFound:
+		causes = append(causes, fmt.Sprintf("wrong base URL or path: got 404 from %s, the base API of the suite is %q", data.Request.URL, suite.Api))
+	case code == http.StatusMethodNotAllowed:
+		causes = append(causes, fmt.Sprintf("wrong method: %s is not allowed by %s", data.Request.Method, data.Request.URL))
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		causes = append(causes, "invalid request: the server rejected the request body or parameters")
+	case code >= http.StatusInternalServerError:
+		causes = append(causes, fmt.Sprintf("server error: got %d, the service under test failed", code))
+	}
+
+	if kinds[assertionConnection] {
+		causes = append(causes, fmt.Sprintf("wrong base URL or the service is down: cannot connect to %s", data.Request.URL))
+	}
+	if kinds[assertionRender] {
+		causes = append(causes, "template error: the request or the expectation could not be rendered")
+	}
+	if kinds[assertionNotFound] {
+		causes = append(causes, "the test suite or case does not exist in the runner")
+	}
+	if (kinds[assertionSchema] || kinds[assertionBodyField] || kinds[assertionBody]) && data.StatusCode >= 200 && data.StatusCode < 300 {
+		causes = append(causes, "schema drift: the request succeeded, but the response body changed, update the expectation if the change is intended")
+	}
+	if kinds[assertionVerify] {
+		causes = append(causes, "the verify expression is false or invalid, check it with the actual response body")
+	}
+	if len(causes) == 0 && kinds[assertionOther] {
+		causes = append(causes, "unknown: see the raw error")
+	}
+	return
+}
+
+// String renders the diagnosis in a readable way
+func (d FailureDiagnosis) String() string {
+	var buf strings.Builder
+	if d.Passed {
+		fmt.Fprintf(&buf, "test case %s/%s passed (%s), status code %d\n", d.Suite, d.Case, d.Source, d.StatusCode)
+		return buf.String()
+	}
+
+	fmt.Fprintf(&buf, "test case %s/%s failed (%s), status code %d\n\n", d.Suite, d.Case, d.Source, d.StatusCode)
+	rendered := "rendered"
+	if !d.Request.Rendered {
+		rendered = "template, the rendered one is unknown"
+	}
+	fmt.Fprintf(&buf, "request (%s): %s %s\n", rendered, d.Request.Method, d.Request.URL)
+
+	buf.WriteString("\nfailed assertions:\n")
+	for _, failure := range d.Failures {
+		fmt.Fprintf(&buf, "- [%s]", failure.Kind)
+		if failure.Target != "" {
+			fmt.Fprintf(&buf, " %s", failure.Target)
+		}
+		if failure.Expected != "" || failure.Actual != "" {
+			fmt.Fprintf(&buf, ": expected %q, actual %q", failure.Expected, failure.Actual)
+		} else {
+			fmt.Fprintf(&buf, ": %s", failure.Message)
+		}
+		buf.WriteString("\n")
+	}
+
+	if len(d.Causes) > 0 {
+		buf.WriteString("\nlikely causes:\n- " + strings.Join(d.Causes, "\n- ") + "\n")
+	}
+	return buf.String()
+}
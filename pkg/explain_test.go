@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestParseFailure(t *testing.T) {
+	expect := &server.Response{
+		StatusCode:       200,
+		Body:             `{"name":"a"}`,
+		Header:           []*server.Pair{{Key: "Content-Type", Value: "application/json"}},
+		BodyFieldsExpect: []*server.Pair{{Key: "data.name", Value: "atest"}},
+		Schema:           `{"type":"object","properties":{"id":{"type":"integer"}}}`,
+	}
+	result := &server.TestCaseResult{StatusCode: 500, Body: `{"id":"x"}`}
+	tests := []struct {
+		name     string
+		line     string
+		expected AssertionFailure
+	}{
+		{name: "status", line: "case: get, expect 200, actual 500",
+			expected: AssertionFailure{Kind: assertionStatus, Target: "statusCode", Expected: "200", Actual: "500"}},
+		{name: "header", line: "case: get, expect application/json, actual text/plain",
+			expected: AssertionFailure{Kind: assertionHeader, Target: "Content-Type", Expected: "application/json", Actual: "text/plain"}},
+		{name: "body", line: "got different response body, diff:\n-a\n+b",
+			expected: AssertionFailure{Kind: assertionBody, Expected: `{"name":"a"}`, Actual: `{"id":"x"}`}},
+		{name: "field", line: "field[data.name] expect value: 'atest', actual: 'other'",
+			expected: AssertionFailure{Kind: assertionBodyField, Target: "data.name", Expected: "atest", Actual: "other"}},
+		{name: "missing field", line: "not found field: data.name",
+			expected: AssertionFailure{Kind: assertionBodyField, Target: "data.name", Expected: "atest", Actual: "<missing>"}},
+		{name: "verify", line: `failed to verify: "len(data) > 0", got false`,
+			expected: AssertionFailure{Kind: assertionVerify, Target: "len(data) > 0", Expected: "true", Actual: "got false"}},
+		{name: "schema", line: "JSON schema validation failed",
+			expected: AssertionFailure{Kind: assertionSchema, Target: "id"}},
+		{name: "render", line: `template: api:1: function "nope" not defined`, expected: AssertionFailure{Kind: assertionRender}},
+		{name: "not found", line: "not found testcase get", expected: AssertionFailure{Kind: assertionNotFound}},
+		{name: "connection", line: "dial tcp 127.0.0.1:80: connect: connection refused", expected: AssertionFailure{Kind: assertionConnection}},
+		{name: "other", line: "something else", expected: AssertionFailure{Kind: assertionOther}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := parseFailure(tt.line, expect, result)
+			if len(failures) != 1 {
+				t.Fatalf("expected a failure, got %+v", failures)
+			}
+			failure := failures[0]
+			if failure.Kind != tt.expected.Kind || failure.Target != tt.expected.Target {
+				t.Fatalf("expected %+v, got %+v", tt.expected, failure)
+			}
+			if tt.expected.Kind != assertionSchema && (failure.Expected != tt.expected.Expected || failure.Actual != tt.expected.Actual) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, failure)
+			}
+		})
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	items := splitErrors("error is: case: get, expect 200, actual 500\n\ngot different response body, diff:\n-a\n+b")
+	if len(items) != 2 || items[0] != "case: get, expect 200, actual 500" || !strings.HasSuffix(items[1], "\n-a\n+b") {
+		t.Fatalf("unexpected items %q", items)
+	}
+}
+
+func TestSentRequest(t *testing.T) {
+	suite := &server.TestSuite{Api: "http://localhost:8080/"}
+	tests := []struct {
+		name     string
+		testCase *server.TestCase
+		output   string
+		expected SentRequest
+	}{{
+		name:     "rendered",
+		testCase: &server.TestCase{Request: &server.Request{Api: "/{{.id}}"}},
+		output:   "start to send request to http://localhost:8080/1 with method POST\nrequest header map[Accept:[*/*] X-Id:[1]]",
+		expected: SentRequest{Method: "POST", URL: "http://localhost:8080/1", Headers: map[string]string{"Accept": "*/*", "X-Id": "1"}, Rendered: true},
+	}, {
+		name:     "template",
+		testCase: &server.TestCase{Request: &server.Request{Api: "/users", Header: []*server.Pair{{Key: "Accept", Value: "*/*"}}}},
+		expected: SentRequest{Method: "GET", URL: "http://localhost:8080/users", Headers: map[string]string{"Accept": "*/*"}},
+	}, {
+		name:     "absolute URL",
+		testCase: &server.TestCase{Request: &server.Request{Api: "https://example.com", Method: "DELETE"}},
+		expected: SentRequest{Method: "DELETE", URL: "https://example.com"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := sentRequest(suite, tt.testCase, tt.output)
+			if req.Method != tt.expected.Method || req.URL != tt.expected.URL || req.Rendered != tt.expected.Rendered ||
+				len(req.Headers) != len(tt.expected.Headers) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, req)
+			}
+			for key, value := range tt.expected.Headers {
+				if req.Headers[key] != value {
+					t.Fatalf("expected header %s=%q, got %q", key, value, req.Headers[key])
+				}
+			}
+		})
+	}
+}
+
+func TestLikelyCauses(t *testing.T) {
+	suite := &server.TestSuite{Api: "http://localhost"}
+	tests := []struct {
+		name     string
+		code     int32
+		headers  map[string]string
+		kind     string
+		expected string
+	}{
+		{name: "unauthorized", code: 401, expected: "there is no Authorization header"},
+		{name: "invalid credential", code: 403, headers: map[string]string{"authorization": "x"}, expected: "invalid, expired or lacks the permission"},
+		{name: "not found", code: 404, expected: `wrong base URL or path: got 404 from /a, the base API of the suite is "http://localhost"`},
+		{name: "method", code: 405, expected: "wrong method: GET is not allowed"},
+		{name: "bad request", code: 422, expected: "invalid request"},
+		{name: "server error", code: 503, expected: "server error: got 503"},
+		{name: "connection", kind: assertionConnection, expected: "cannot connect to /a"},
+		{name: "render", kind: assertionRender, expected: "template error"},
+		{name: "missing", kind: assertionNotFound, expected: "does not exist in the runner"},
+		{name: "schema drift", code: 200, kind: assertionBodyField, expected: "schema drift"},
+		{name: "verify", code: 200, kind: assertionVerify, expected: "the verify expression is false"},
+		{name: "unknown", kind: assertionOther, expected: "unknown: see the raw error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := FailureDiagnosis{StatusCode: tt.code, Request: SentRequest{Method: "GET", URL: "/a", Headers: tt.headers}}
+			if tt.kind != "" {
+				data.Failures = []AssertionFailure{{Kind: tt.kind}}
+			}
+			causes := likelyCauses(data, suite)
+			if len(causes) == 0 || !strings.Contains(causes[0], tt.expected) {
+				t.Fatalf("expected cause %q, got %q", tt.expected, causes)
+			}
+		})
+	}
+}
+
+func TestExplainFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     ExplainFailureRequest
+		expected []string
+		err      string
+	}{
+		{name: "rerun", args: ExplainFailureRequest{Suite: "sample", Testcase: "a"},
+			expected: []string{"test case sample/a failed (rerun), status code 500", `- [status] statusCode: expected "200", actual "500"`,
+				"likely causes:\n- server error: got 500"}},
+		{name: "last", args: ExplainFailureRequest{Suite: "sample", Testcase: "a", Source: ExplainLast},
+			expected: []string{"failed (last), status code 404", "request (template, the rendered one is unknown): GET http://localhost/a"}},
+		{name: "passed", args: ExplainFailureRequest{Suite: "sample", Testcase: "b"}, expected: []string{"test case sample/b passed (rerun)"}},
+		{name: "no history", args: ExplainFailureRequest{Suite: "sample", Testcase: "b", Source: ExplainLast}, err: "no run of test case"},
+		{name: "unknown source", args: ExplainFailureRequest{Suite: "sample", Testcase: "a", Source: "guess"}, err: `not supported source "guess"`},
+		{name: "unknown case", args: ExplainFailureRequest{Suite: "sample", Testcase: "c"}, err: `failed to get test case "c"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample", Api: "http://localhost"},
+				&server.TestCase{Name: "a", Request: &server.Request{Api: "/a"}, Response: &server.Response{StatusCode: 200}},
+				&server.TestCase{Name: "b", Request: &server.Request{Api: "/b"}})
+			fake.results["a"] = &server.TestCaseResult{StatusCode: 500, Error: "case: a, expect 200, actual 500"}
+			addRunResult(fake, "sample", "a", "a1", time.Now().Add(-time.Hour), &server.TestCaseResult{StatusCode: 200})
+			addRunResult(fake, "sample", "a", "a2", time.Now(), &server.TestCaseResult{StatusCode: 404, Error: "case: a, expect 200, actual 404"})
+
+			result, data, err := runner.ExplainFailure(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := result.Content[0].(*mcp.TextContent).Text
+			if text != data.String() {
+				t.Fatalf("the result should be the diagnosis, got %q", text)
+			}
+			for _, line := range tt.expected {
+				if !strings.Contains(text, line) {
+					t.Fatalf("expected %q in %q", line, text)
+				}
+			}
+		})
+	}
+}
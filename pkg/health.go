@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/linuxsuren/api-testing/pkg/version"
+	"google.golang.org/grpc"
+)
+
+// BuildInfo is the version information of the MCP server
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns the build information which is set by the ldflags
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   version.GetVersion(),
+		Commit:    version.GetCommit(),
+		Date:      version.GetDate(),
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// VersionInfo contains the versions of the MCP server and the connected runner
+type VersionInfo struct {
+	Server      BuildInfo       `json:"server"`
+	Runner      *server.Version `json:"runner,omitempty"`
+	RunnerError string          `json:"runnerError,omitempty"`
+}
+
+// HealthServer serves the health, readiness and version endpoints for the orchestrators
+type HealthServer interface {
+	Register(mux *http.ServeMux)
+	RunnerVersion(ctx context.Context) (*server.Version, error)
+	VersionInfo(ctx context.Context) VersionInfo
+}
+
+type healthServer struct {
+	Address string
+	pool    ConnectionPool
+}
+
+const readinessTimeout = 3 * time.Second
+
+func NewHealthServer(address string, pool ConnectionPool) HealthServer {
+	return &healthServer{
+		Address: address,
+		pool:    pool,
+	}
+}
+
+func (h *healthServer) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.healthz)
+	mux.HandleFunc("/readyz", h.readyz)
+	mux.HandleFunc("/version", h.version)
+}
+
+// RunnerVersion asks the runner for its version, it's used to check if the runner is reachable
+func (h *healthServer) RunnerVersion(ctx context.Context) (ver *server.Version, err error) {
+	var conn *grpc.ClientConn
+	if conn, err = h.pool.Get(h.Address); err == nil {
+		ver, err = server.NewRunnerClient(conn).GetVersion(ctx, &server.Empty{})
+	}
+	return
+}
+
+func (h *healthServer) VersionInfo(ctx context.Context) (info VersionInfo) {
+	info.Server = GetBuildInfo()
+	var err error
+	if info.Runner, err = h.RunnerVersion(ctx); err != nil {
+		info.RunnerError = err.Error()
+	}
+	return
+}
+
+func (h *healthServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *healthServer) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	if ver, err := h.RunnerVersion(ctx); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+			"status": "runner unreachable",
+			"runner": h.Address,
+			"error":  err.Error(),
+		})
+	} else {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status":        "ok",
+			"runner":        h.Address,
+			"runnerVersion": ver.Version,
+		})
+	}
+}
+
+func (h *healthServer) version(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	writeJSON(w, http.StatusOK, h.VersionInfo(ctx))
+}
+
+func writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealthServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		failed   bool
+		code     int
+		expected []string
+	}{
+		{name: "healthz", path: "/healthz", code: http.StatusOK, expected: []string{`"status":"ok"`}},
+		{name: "healthz without runner", path: "/healthz", failed: true, code: http.StatusOK, expected: []string{`"status":"ok"`}},
+		{name: "readyz", path: "/readyz", code: http.StatusOK, expected: []string{`"runnerVersion":"v0.0.20"`}},
+		{name: "readyz without runner", path: "/readyz", failed: true, code: http.StatusServiceUnavailable,
+			expected: []string{`"status":"runner unreachable"`, `"runner":"` + fakeAddress + `"`, "the runner is down"}},
+		{name: "version", path: "/version", code: http.StatusOK, expected: []string{`"runner":{"version":"v0.0.20"`, `"goVersion":"go`}},
+		{name: "version without runner", path: "/version", failed: true, code: http.StatusOK,
+			expected: []string{`"runnerError":`, `"platform":"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			if tt.failed {
+				fake.errors["/server.Runner/GetVersion"] = status.Error(codes.Unavailable, "the runner is down")
+			}
+			mux := http.NewServeMux()
+			NewHealthServer(fakeAddress, runner.pool).Register(mux)
+
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if recorder.Code != tt.code || recorder.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("expected code %d, got %d", tt.code, recorder.Code)
+			}
+			if !json.Valid(recorder.Body.Bytes()) {
+				t.Fatalf("invalid JSON %s", recorder.Body)
+			}
+			for _, text := range tt.expected {
+				if !strings.Contains(recorder.Body.String(), text) {
+					t.Fatalf("expected %q in %s", text, recorder.Body)
+				}
+			}
+		})
+	}
+}
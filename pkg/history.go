@@ -0,0 +1,303 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 200
+	// historyConcurrency is the max number of the runs which are fetched concurrently
+	historyConcurrency = 8
+
+	historyPassed = "passed"
+	historyFailed = "failed"
+)
+
+type ListHistoryRequest struct {
+	Suite    string `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase string `json:"testcase,omitempty" jsonschema:"the name of test case, all the runs of the suite are listed if it is empty"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"the max number of the latest runs, default is 20"`
+	Offset   int    `json:"offset,omitempty" jsonschema:"the number of the latest runs to skip, it pages through the runs along with limit"`
+}
+
+type HistoryRunRequest struct {
+	ID string `json:"id" jsonschema:"the ID of the historical run"`
+}
+
+type HistoryCodeRequest struct {
+	ID        string `json:"id" jsonschema:"the ID of the historical run"`
+	Generator string `json:"generator,omitempty" jsonschema:"the code generator, such as curl, golang, python or java, default is curl"`
+}
+
+// HistoryRun is the summary of a historical run
+type HistoryRun struct {
+	ID         string    `json:"id"`
+	Suite      string    `json:"suite"`
+	Case       string    `json:"case"`
+	CreateTime time.Time `json:"createTime"`
+	Status     string    `json:"status"`
+	StatusCode int32     `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type HistoryList struct {
+	Runs []HistoryRun `json:"runs"`
+	// Total is the number of all the runs, including the ones which are not in the page
+	Total int `json:"total"`
+}
+
+// HistoryRunDetail contains the request and response of a historical run
+type HistoryRunDetail struct {
+	HistoryRun
+	Request  *server.Request          `json:"request,omitempty"`
+	Expect   *server.Response         `json:"expect,omitempty"`
+	Results  []*server.TestCaseResult `json:"results,omitempty"`
+	Message  string                   `json:"message,omitempty"`
+	Headers  map[string]string        `json:"headers,omitempty"`
+	Params   map[string]string        `json:"params,omitempty"`
+	SuiteAPI string                   `json:"suiteAPI,omitempty"`
+}
+
+type CodeGenerators struct {
+	Generators []string `json:"generators"`
+}
+
+// ListHistory lists the latest runs of a test case or a test suite, the latest one comes first
+func (r *gRPCRunner) ListHistory(ctx context.Context, request *mcp.CallToolRequest, args ListHistoryRequest) (
+	result *mcp.CallToolResult, data HistoryList, err error) {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	if args.Suite == "" {
+		err = errors.New("suite is required")
+		return
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	} else if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+
+	var items []*server.HistoryTestCase
+	if args.Testcase != "" {
+		if items, err = caseHistory(ctx, runner, args.Suite, args.Testcase); err != nil {
+			return
+		}
+	} else {
+		var suites *server.HistorySuites
+		if suites, err = runner.GetHistorySuites(ctx, &server.Empty{}); err != nil {
+			return
+		}
+		// there is no timestamp in the identities, the runs are listed per test case along with the timestamps
+		var cases []string
+		for _, identities := range suites.Data {
+			for _, item := range identities.Data {
+				if item.Suite == args.Suite && !slices.Contains(cases, item.Testcase) {
+					cases = append(cases, item.Testcase)
+				}
+			}
+		}
+		slices.Sort(cases)
+		for _, name := range cases {
+			var caseItems []*server.HistoryTestCase
+			if caseItems, err = caseHistory(ctx, runner, args.Suite, name); err != nil {
+				return
+			}
+			items = append(items, caseItems...)
+		}
+	}
+
+	// only the runs of the page are fetched with the results
+	slices.SortStableFunc(items, func(a, b *server.HistoryTestCase) int {
+		return b.CreateTime.AsTime().Compare(a.CreateTime.AsTime())
+	})
+	data.Total = len(items)
+	offset := min(max(args.Offset, 0), len(items))
+	if data.Runs, err = fetchHistoryRuns(ctx, runner, items[offset:min(offset+limit, len(items))]); err != nil {
+		return
+	}
+
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.Table()},
+		},
+	}
+	return
+}
+
+// GetHistoryRun returns the request and response of a historical run
+func (r *gRPCRunner) GetHistoryRun(ctx context.Context, request *mcp.CallToolRequest, args HistoryRunRequest) (
+	result *mcp.CallToolResult, data HistoryRunDetail, err error) {
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
+		var reply *server.HistoryTestResult
+		if reply, err = server.NewRunnerClient(conn).GetHistoryTestCaseWithResult(ctx, &server.HistoryTestCase{ID: args.ID}); err == nil {
+			data = HistoryRunDetail{
+				HistoryRun: newHistoryRun(reply),
+				Results:    reply.TestCaseResult,
+				Message:    reply.Message,
+			}
+			if testCase := reply.Data; testCase != nil {
+				data.Request = testCase.Request
+				data.Expect = testCase.Response
+				data.SuiteAPI = testCase.SuiteApi
+				data.Headers = pairsToMap(testCase.HistoryHeader)
+				data.Params = pairsToMap(testCase.SuiteParam)
+			}
+			result = &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: objectToJSON(data)},
+				},
+			}
+		}
+	}
+	return
+}
+
+// GenerateHistoryCode generates the code which reproduces a historical run
+func (r *gRPCRunner) GenerateHistoryCode(ctx context.Context, request *mcp.CallToolRequest, args HistoryCodeRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	if args.Generator == "" {
+		args.Generator = "curl"
+	}
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
+		var reply *server.CommonResult
+		if reply, err = server.NewRunnerClient(conn).HistoryGenerateCode(ctx, &server.CodeGenerateRequest{
+			ID:        args.ID,
+			Generator: args.Generator,
+		}); err == nil {
+			if !reply.Success {
+				err = fmt.Errorf("failed to generate %s code: %s", args.Generator, reply.Message)
+				return
+			}
+			result = &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: reply.Message},
+				},
+			}
+		}
+	}
+	return
+}
+
+func (r *gRPCRunner) ListCodeGenerators(ctx context.Context, request *mcp.CallToolRequest, args any) (
+	result *mcp.CallToolResult, data CodeGenerators, err error) {
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err == nil {
+		var reply *server.SimpleList
+		if reply, err = server.NewRunnerClient(conn).ListCodeGenerator(ctx, &server.Empty{}); err == nil {
+			for _, item := range reply.Data {
+				data.Generators = append(data.Generators, item.Key)
+			}
+			result = &mcp.CallToolResult{
+				Content: []mcp.Content{
+					&mcp.TextContent{Text: strings.Join(data.Generators, "\n")},
+				},
+			}
+		}
+	}
+	return
+}
+
+func caseHistory(ctx context.Context, runner server.RunnerClient, suite, name string) (items []*server.HistoryTestCase, err error) {
+	var cases *server.HistoryTestCases
+	if cases, err = runner.GetTestCaseAllHistory(ctx, &server.TestCase{SuiteName: suite, Name: name}); err == nil {
+		items = cases.Data
+	}
+	return
+}
+
+// fetchHistoryRuns gets the results of the runs with bounded concurrency, the order is kept
+func fetchHistoryRuns(ctx context.Context, runner server.RunnerClient, items []*server.HistoryTestCase) (runs []HistoryRun, err error) {
+	runs = make([]HistoryRun, len(items))
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, historyConcurrency)
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			reply, fetchErr := runner.GetHistoryTestCaseWithResult(ctx, &server.HistoryTestCase{ID: item.ID})
+			if fetchErr != nil {
+				errs[i] = fmt.Errorf("failed to get the historical run %q: %w", item.ID, fetchErr)
+				return
+			}
+			runs[i] = newHistoryRun(reply)
+		}()
+	}
+	wg.Wait()
+	err = errors.Join(errs...)
+	return
+}
+
+func newHistoryRun(reply *server.HistoryTestResult) (run HistoryRun) {
+	if reply.Data != nil {
+		run.ID = reply.Data.ID
+		run.Suite = reply.Data.SuiteName
+		run.Case = reply.Data.CaseName
+	}
+	if reply.CreateTime != nil {
+		run.CreateTime = reply.CreateTime.AsTime()
+	} else if reply.Data != nil && reply.Data.CreateTime != nil {
+		run.CreateTime = reply.Data.CreateTime.AsTime()
+	}
+
+	run.Status = historyPassed
+	run.Error = reply.Error
+	for _, item := range reply.TestCaseResult {
+		if item.StatusCode != 0 {
+			run.StatusCode = item.StatusCode
+		}
+		if run.Error == "" {
+			run.Error = item.Error
+		}
+	}
+	if run.Error != "" {
+		run.Status = historyFailed
+	}
+	return
+}
+
+func pairsToMap(pairs []*server.Pair) (data map[string]string) {
+	if len(pairs) > 0 {
+		data = make(map[string]string, len(pairs))
+		for _, pair := range pairs {
+			data[pair.Key] = pair.Value
+		}
+	}
+	return
+}
+
+// Table renders the runs as a Markdown table
+func (l HistoryList) Table() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d of %d runs\n\n| ID | Time | Suite | Case | Status | Code | Error |\n|---|---|---|---|---|---|---|\n", len(l.Runs), l.Total)
+	for _, run := range l.Runs {
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %d | %s |\n", run.ID, run.CreateTime.Format(time.RFC3339),
+			run.Suite, run.Case, run.Status, run.StatusCode, strings.ReplaceAll(run.Error, "|", "\\|"))
+	}
+	return buf.String()
+}
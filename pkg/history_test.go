@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestListHistory(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     ListHistoryRequest
+		expected []string
+		total    int
+	}{{
+		name:     "latest runs of the suite",
+		args:     ListHistoryRequest{Suite: "sample", Limit: 3},
+		expected: []string{"b-9", "a-9", "b-8"},
+		total:    20,
+	}, {
+		name:     "page of the suite",
+		args:     ListHistoryRequest{Suite: "sample", Limit: 3, Offset: 3},
+		expected: []string{"a-8", "b-7", "a-7"},
+		total:    20,
+	}, {
+		name:     "last page",
+		args:     ListHistoryRequest{Suite: "sample", Limit: 3, Offset: 18},
+		expected: []string{"b-0", "a-0"},
+		total:    20,
+	}, {
+		name:  "out of range",
+		args:  ListHistoryRequest{Suite: "sample", Offset: 30},
+		total: 20,
+	}, {
+		name:     "runs of the test case",
+		args:     ListHistoryRequest{Suite: "sample", Testcase: "a", Limit: 2},
+		expected: []string{"a-9", "a-8"},
+		total:    10,
+	}, {
+		name:     "other suite",
+		args:     ListHistoryRequest{Suite: "other"},
+		expected: []string{"c-0"},
+		total:    1,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			// the runs are not in the time order, a and b run alternately
+			for i := 9; i >= 0; i-- {
+				addHistory(fake, "sample", "a", fmt.Sprintf("a-%d", i), start.Add(time.Duration(2*i)*time.Minute))
+			}
+			for i := range 10 {
+				addHistory(fake, "sample", "b", fmt.Sprintf("b-%d", i), start.Add(time.Duration(2*i+1)*time.Minute))
+			}
+			addHistory(fake, "other", "c", "c-0", start)
+
+			_, data, err := runner.ListHistory(context.Background(), nil, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, run := range data.Runs {
+				ids = append(ids, run.ID)
+			}
+			if !slices.Equal(ids, tt.expected) || data.Total != tt.total {
+				t.Fatalf("expected %v of %d, got %v of %d", tt.expected, tt.total, ids, data.Total)
+			}
+			// only the runs of the page are fetched
+			if calls := fake.callsOf("GetHistoryTestCaseWithResult"); calls != len(tt.expected) {
+				t.Fatalf("expected %d fetched runs, got %d", len(tt.expected), calls)
+			}
+		})
+	}
+}
+
+func TestListHistoryConcurrency(t *testing.T) {
+	fake, runner := newFakeRunner(t)
+	for i := range maxHistoryLimit {
+		addHistory(fake, "sample", "a", fmt.Sprintf("a-%d", i), time.Unix(int64(i), 0))
+	}
+	fake.delay = time.Millisecond
+
+	_, data, err := runner.ListHistory(context.Background(), nil, ListHistoryRequest{Suite: "sample", Limit: maxHistoryLimit + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Runs) != maxHistoryLimit || data.Runs[0].ID != fmt.Sprintf("a-%d", maxHistoryLimit-1) {
+		t.Fatalf("unexpected runs %d, the first one is %v", len(data.Runs), data.Runs[0])
+	}
+	if fake.maxActive > historyConcurrency || fake.maxActive < 2 {
+		t.Fatalf("expected up to %d concurrent calls, got %d", historyConcurrency, fake.maxActive)
+	}
+	if table := data.Table(); !strings.HasPrefix(table, fmt.Sprintf("%d of %d runs", maxHistoryLimit, maxHistoryLimit)) {
+		t.Fatalf("unexpected table %q", table)
+	}
+}
+
+func TestNewHistoryRun(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		reply    *server.HistoryTestResult
+		expected HistoryRun
+	}{{
+		name: "passed",
+		reply: &server.HistoryTestResult{
+			Data:           &server.HistoryTestCase{ID: "1", SuiteName: "sample", CaseName: "a", CreateTime: timestamppb.New(created)},
+			TestCaseResult: []*server.TestCaseResult{{StatusCode: 200}},
+		},
+		expected: HistoryRun{ID: "1", Suite: "sample", Case: "a", CreateTime: created, Status: historyPassed, StatusCode: 200},
+	}, {
+		name: "failed case",
+		reply: &server.HistoryTestResult{
+			Data:           &server.HistoryTestCase{ID: "2"},
+			CreateTime:     timestamppb.New(created),
+			TestCaseResult: []*server.TestCaseResult{{StatusCode: 500, Error: "unexpected status code"}},
+		},
+		expected: HistoryRun{ID: "2", CreateTime: created, Status: historyFailed, StatusCode: 500, Error: "unexpected status code"},
+	}, {
+		name:     "failed run",
+		reply:    &server.HistoryTestResult{Error: "connection refused"},
+		expected: HistoryRun{Status: historyFailed, Error: "connection refused"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if run := newHistoryRun(tt.reply); run != tt.expected {
+				t.Fatalf("expected %+v, got %+v", tt.expected, run)
+			}
+		})
+	}
+}
+
+func addHistory(fake *fakeRunner, suite, name, id string, created time.Time) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.histories = append(fake.histories, &server.HistoryTestResult{
+		Data: &server.HistoryTestCase{ID: id, SuiteName: suite, CaseName: name, CreateTime: timestamppb.New(created)},
+	})
+}
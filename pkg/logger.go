@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// NewLogger creates the logger of the server process according to the config.
+// The writer should never be stdout in stdio mode, otherwise the logs break the MCP messages.
+func NewLogger(config LogConfig, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level: parseLogLevel(config.Level),
+	}
+
+	var handler slog.Handler
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(handler)
+}
+
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type loggerContextKey struct{}
+
+// WithLogger puts the logger into the context
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFrom returns the logger of the context, or the default logger
+func LoggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// NewToolLogger creates the logger of a tool call. The records go to the server logs, and are sent
+// to the client as MCP logging notifications as well if the level is not lower than the one set by the client,
+// the secrets are masked in the notifications.
+func NewToolLogger(base *slog.Logger, session *mcp.ServerSession, tool string, redactor *Redactor) *slog.Logger {
+	handler := base.Handler()
+	if session != nil {
+		handler = &fanoutHandler{handlers: []slog.Handler{
+			handler,
+			NewRedactHandler(mcp.NewLoggingHandler(session, &mcp.LoggingHandlerOptions{LoggerName: "atest-mcp-server"}), redactor),
+		}}
+	}
+	return slog.New(handler).With("tool", tool)
+}
+
+// fanoutHandler dispatches the records to all the enabled handlers
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithAttrs(attrs))
+	}
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, 0, len(h.handlers))
+	for _, handler := range h.handlers {
+		handlers = append(handlers, handler.WithGroup(name))
+	}
+	return &fanoutHandler{handlers: handlers}
+}
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   LogConfig
+		expected []string
+		hidden   string
+	}{
+		{name: "text", config: LogConfig{Level: "info", Format: "text"}, expected: []string{"level=INFO msg=info"}, hidden: "debug"},
+		{name: "json", config: LogConfig{Level: "debug", Format: "json"}, expected: []string{`"msg":"debug"`, `"msg":"info"`}},
+		{name: "warn", config: LogConfig{Level: "WARN"}, expected: []string{"msg=warn"}, hidden: "msg=info"},
+		{name: "error", config: LogConfig{Level: "error"}, expected: []string{"msg=error"}, hidden: "msg=warn"},
+		{name: "unknown level", config: LogConfig{Level: "trace"}, expected: []string{"msg=info"}, hidden: "msg=debug"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := NewLogger(tt.config, buf)
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			logger.Error("error")
+			for _, text := range tt.expected {
+				if !strings.Contains(buf.String(), text) {
+					t.Fatalf("expected %q in %q", text, buf.String())
+				}
+			}
+			if tt.hidden != "" && strings.Contains(buf.String(), tt.hidden) {
+				t.Fatalf("unexpected %q in %q", tt.hidden, buf.String())
+			}
+		})
+	}
+}
+
+func TestLoggerFrom(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if LoggerFrom(WithLogger(context.Background(), logger)) != logger {
+		t.Fatal("expected the logger of the context")
+	}
+	if LoggerFrom(context.Background()) != slog.Default() {
+		t.Fatal("expected the default logger")
+	}
+}
+
+func TestToolLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewToolLogger(slog.New(slog.NewTextHandler(buf, nil)), nil, "run", nil)
+	logger.Info("called")
+	if !strings.Contains(buf.String(), "msg=called tool=run") {
+		t.Fatalf("expected the tool attribute in %q", buf.String())
+	}
+}
+
+func TestToolLoggerNotifications(t *testing.T) {
+	messages := make(chan *mcp.LoggingMessageParams, 10)
+	s := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	serverSession, clientSession := connectSession(t, s, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, request *mcp.LoggingMessageRequest) {
+			messages <- request.Params
+		},
+	})
+
+	redactor := NewRedactor(RedactConfig{})
+	redactor.AddSecrets("s3cr3t-value")
+	buf := &bytes.Buffer{}
+	logger := NewToolLogger(slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		serverSession, "run", redactor)
+	// nothing is sent before the client sets the level
+	logger.Error("before the level")
+
+	tests := []struct {
+		level    mcp.LoggingLevel
+		expected []string
+	}{
+		{level: "debug", expected: []string{"debug:debug", "info:info", "warning:warn", "error:error"}},
+		{level: "warning", expected: []string{"warning:warn", "error:error"}},
+		{level: "error", expected: []string{"error:error"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.level), func(t *testing.T) {
+			if err := clientSession.SetLoggingLevel(context.Background(), &mcp.SetLoggingLevelParams{Level: tt.level}); err != nil {
+				t.Fatal(err)
+			}
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn", "token", "s3cr3t-value")
+			logger.Error("error")
+
+			var received []string
+			for range tt.expected {
+				select {
+				case message := <-messages:
+					data, _ := json.Marshal(message.Data)
+					var record struct {
+						Msg   string `json:"msg"`
+						Tool  string `json:"tool"`
+						Token string `json:"token"`
+					}
+					if err := json.Unmarshal(data, &record); err != nil {
+						t.Fatal(err)
+					}
+					if message.Logger != "atest-mcp-server" || record.Tool != "run" || strings.Contains(string(data), "s3cr3t-value") {
+						t.Fatalf("unexpected notification %+v: %s", message, data)
+					}
+					received = append(received, string(message.Level)+":"+record.Msg)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("expected notifications %v, got %v", tt.expected, received)
+				}
+			}
+			if !slices.Equal(received, tt.expected) {
+				t.Fatalf("expected notifications %v, got %v", tt.expected, received)
+			}
+		})
+	}
+
+	select {
+	case message := <-messages:
+		t.Fatalf("unexpected notification %+v", message)
+	case <-time.After(100 * time.Millisecond):
+	}
+	// all the records go to the server logs no matter the level of the client
+	if count := strings.Count(buf.String(), "tool=run"); count != 13 {
+		t.Fatalf("expected 13 records in the server logs, got %d: %s", count, buf)
+	}
+}
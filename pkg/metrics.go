@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const metricsNamespace = "atest_mcp"
+
+var (
+	toolCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tool_calls_total",
+		Help:      "The total number of the tool calls.",
+	}, []string{"tool"})
+	toolErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tool_errors_total",
+		Help:      "The total number of the failed tool calls by the gRPC code.",
+	}, []string{"tool", "code"})
+	toolDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "tool_call_duration_seconds",
+		Help:      "The latency of the tool calls.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"tool"})
+	toolInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "tool_calls_in_flight",
+		Help:      "The number of the tool calls being served.",
+	}, []string{"tool"})
+	runnerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "runner_request_duration_seconds",
+		Help:      "The latency of the gRPC requests to the runner.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"method", "code"})
+)
+
+// toolErrorCode is the code label of a tool call which returns an error result without an error
+const toolErrorCode = "ToolError"
+
+// MetricsHandler exposes the metrics in Prometheus format
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// observeToolCall records the metrics of a tool call, it returns a function to call when the tool call is done
+func observeToolCall(name string) func(isError bool, err error) {
+	start := time.Now()
+	toolCallsTotal.WithLabelValues(name).Inc()
+	toolInFlight.WithLabelValues(name).Inc()
+	return func(isError bool, err error) {
+		toolInFlight.WithLabelValues(name).Dec()
+		toolDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			toolErrorsTotal.WithLabelValues(name, errorCode(err)).Inc()
+		} else if isError {
+			toolErrorsTotal.WithLabelValues(name, toolErrorCode).Inc()
+		}
+	}
+}
+
+// errorCode returns the gRPC code of the error, the context errors are converted as well
+func errorCode(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Code().String()
+	}
+	return status.FromContextError(err).Code().String()
+}
+
+// NewMetricsInterceptor records the latency of the gRPC requests to the runner
+func NewMetricsInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		start := time.Now()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		runnerDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return
+	}
+}
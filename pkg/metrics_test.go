@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestObserveToolCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		isError bool
+		err     error
+		code    string
+	}{
+		{name: "passed"},
+		{name: "error result", isError: true, code: toolErrorCode},
+		{name: "gRPC error", err: status.Error(codes.NotFound, "not found"), code: "NotFound"},
+		{name: "timeout", err: context.DeadlineExceeded, code: "DeadlineExceeded"},
+		{name: "cancelled", err: context.Canceled, code: "Canceled"},
+		{name: "other error", err: errors.New("failed"), code: "Unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := "metrics-" + strings.ReplaceAll(tt.name, " ", "-")
+			done := observeToolCall(tool)
+			if inFlight := testutil.ToFloat64(toolInFlight.WithLabelValues(tool)); inFlight != 1 {
+				t.Fatalf("expected a call in flight, got %v", inFlight)
+			}
+			done(tt.isError, tt.err)
+
+			if calls := testutil.ToFloat64(toolCallsTotal.WithLabelValues(tool)); calls != 1 {
+				t.Fatalf("expected a call, got %v", calls)
+			}
+			if inFlight := testutil.ToFloat64(toolInFlight.WithLabelValues(tool)); inFlight != 0 {
+				t.Fatalf("expected no call in flight, got %v", inFlight)
+			}
+			if tt.code != "" {
+				if errs := testutil.ToFloat64(toolErrorsTotal.WithLabelValues(tool, tt.code)); errs != 1 {
+					t.Fatalf("expected an error of code %s, got %v", tt.code, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	fake, runner := newFakeRunner(t, grpc.WithUnaryInterceptor(NewMetricsInterceptor()))
+	fake.errors["/server.Runner/GetTestSuite"] = status.Error(codes.NotFound, "not found")
+	conn, err := runner.getConnection(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runnerClient := server.NewRunnerClient(conn)
+	_, _ = runnerClient.GetVersion(context.Background(), &server.Empty{})
+	_, _ = runnerClient.GetTestSuite(context.Background(), &server.TestSuiteIdentity{Name: "missing"})
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, text := range []string{
+		`atest_mcp_runner_request_duration_seconds_count{code="OK",method="/server.Runner/GetVersion"}`,
+		`atest_mcp_runner_request_duration_seconds_count{code="NotFound",method="/server.Runner/GetTestSuite"}`,
+	} {
+		if !strings.Contains(recorder.Body.String(), text) {
+			t.Fatalf("expected %q in the metrics", text)
+		}
+	}
+}
@@ -22,18 +22,20 @@ type MockServer interface {
 
 type remoteMockServer struct {
 	Address string
+	pool    ConnectionPool
 }
 
-func NewRemoteMockServer(address string) MockServer {
+func NewRemoteMockServer(address string, pool ConnectionPool) MockServer {
 	return &remoteMockServer{
 		Address: address,
+		pool:    pool,
 	}
 }
 
 func (r *remoteMockServer) Start(ctx context.Context, request *mcp.CallToolRequest, args MockStartRequest) (
 	result *mcp.CallToolResult, a any, err error) {
 	var conn *grpc.ClientConn
-	if conn, err = grpc.Dial(r.Address, grpc.WithInsecure()); err == nil {
+	if conn, err = r.pool.Get(r.Address); err == nil {
 		runner := server.NewMockClient(conn)
 
 		mockConfig := &server.MockConfig{
@@ -63,7 +65,7 @@ func (r *remoteMockServer) Start(ctx context.Context, request *mcp.CallToolReque
 func (r *remoteMockServer) GetConfig(ctx context.Context, request *mcp.CallToolRequest, args any) (
 	result *mcp.CallToolResult, a any, err error) {
 	var conn *grpc.ClientConn
-	if conn, err = grpc.Dial(r.Address, grpc.WithInsecure()); err == nil {
+	if conn, err = r.pool.Get(r.Address); err == nil {
 		runner := server.NewMockClient(conn)
 
 		var config *server.MockConfig
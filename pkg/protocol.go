@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+)
+
+const (
+	ProtocolHTTP    = "http"
+	ProtocolGRPC    = "grpc"
+	ProtocolGraphQL = "graphql"
+)
+
+var (
+	grpcServicePattern = regexp.MustCompile(`^\w+(\.\w+)*$`)
+	grpcMethodPattern  = regexp.MustCompile(`^\w+$`)
+	graphQLPattern     = regexp.MustCompile(`^\s*(query|mutation|subscription|fragment|\{)`)
+)
+
+// GRPCRequest is the request of a gRPC test case
+type GRPCRequest struct {
+	Service string `json:"service" jsonschema:"the full name of the gRPC service, such as server.Runner"`
+	Method  string `json:"method" jsonschema:"the name of the gRPC method, such as GetVersion"`
+	Message string `json:"message,omitempty" jsonschema:"the request message as JSON, or a JSON array of the messages for the client streaming"`
+}
+
+// GraphQLRequest is the request of a GraphQL test case
+type GraphQLRequest struct {
+	Query         string            `json:"query" jsonschema:"the GraphQL query or mutation"`
+	OperationName string            `json:"operationName,omitempty" jsonschema:"the name of the operation to execute"`
+	Variables     map[string]string `json:"variables,omitempty" jsonschema:"the variables of the query"`
+}
+
+// protocol returns the protocol of the test case
+func (args CreateTestCaseRequest) protocol() string {
+	switch {
+	case args.GRPC != nil:
+		return ProtocolGRPC
+	case args.GraphQL != nil:
+		return ProtocolGraphQL
+	default:
+		return ProtocolHTTP
+	}
+}
+
+// shapeRequest converts the protocol-specific request into the fields of the runner
+func (args CreateTestCaseRequest) shapeRequest(request *server.Request) {
+	switch {
+	case args.GRPC != nil:
+		request.Api = fmt.Sprintf("/%s/%s", args.GRPC.Service, args.GRPC.Method)
+		request.Method = ""
+		request.Body = args.GRPC.Message
+	case args.GraphQL != nil:
+		request.Method = http.MethodPost
+		if data, err := json.Marshal(args.GraphQL); err == nil {
+			request.Body = string(data)
+		}
+		if !hasHeader(request.Header, "Content-Type") {
+			request.Header = append(request.Header, &server.Pair{Key: "Content-Type", Value: "application/json"})
+		}
+	}
+}
+
+// validateProtocol checks the protocol-specific fields, the problems of the HTTP fields are returned by Validate
+func (args CreateTestCaseRequest) validateProtocol() (problems []string) {
+	switch args.protocol() {
+	case ProtocolGRPC:
+		if args.GraphQL != nil {
+			problems = append(problems, "grpc and graphql can not be used together")
+		}
+		if !grpcServicePattern.MatchString(args.GRPC.Service) {
+			problems = append(problems, fmt.Sprintf("grpc.service %q should be the full name of the service, such as server.Runner", args.GRPC.Service))
+		}
+		if !grpcMethodPattern.MatchString(args.GRPC.Method) {
+			problems = append(problems, fmt.Sprintf("grpc.method %q should be the name of the method, such as GetVersion", args.GRPC.Method))
+		}
+		if message := templatePattern.ReplaceAllString(args.GRPC.Message, "0"); message != "" && !json.Valid([]byte(message)) {
+			problems = append(problems, "grpc.message is not a valid JSON")
+		}
+		for _, field := range []struct {
+			name string
+			used bool
+		}{{"api", args.API != ""}, {"method", args.Method != ""}, {"body", args.Body != ""},
+			{"queryParams", len(args.QueryParams) > 0}, {"cookies", len(args.Cookies) > 0}, {"formParams", len(args.FormParams) > 0}} {
+			if field.used {
+				problems = append(problems, fmt.Sprintf("%s is not supported by gRPC test case, use grpc instead", field.name))
+			}
+		}
+		if err := validateTemplate("grpc.message", args.GRPC.Message); err != nil {
+			problems = append(problems, err.Error())
+		}
+	case ProtocolGraphQL:
+		if !graphQLPattern.MatchString(args.GraphQL.Query) {
+			problems = append(problems, "graphql.query should start with query, mutation, subscription or {")
+		} else if strings.Count(args.GraphQL.Query, "{") != strings.Count(args.GraphQL.Query, "}") {
+			problems = append(problems, "graphql.query has unbalanced braces")
+		}
+		if args.Method != "" && !strings.EqualFold(args.Method, http.MethodPost) {
+			problems = append(problems, "method of GraphQL test case should be POST")
+		}
+		if args.Body != "" || len(args.FormParams) > 0 {
+			problems = append(problems, "body and formParams are not supported by GraphQL test case, use graphql instead")
+		}
+	}
+	return
+}
+
+// suiteProtocol returns the protocol of the suite in the same way as the runner
+func suiteProtocol(suite *server.TestSuite) string {
+	spec := suite.GetSpec()
+	if spec.GetRpc() != nil {
+		return ProtocolGRPC
+	}
+	switch kind := strings.ToLower(spec.GetKind()); kind {
+	case "", "swagger", ProtocolHTTP:
+		return ProtocolHTTP
+	case "trpc":
+		return ProtocolGRPC
+	default:
+		return kind
+	}
+}
+
+// validateAgainstSuite checks if the test case matches the kind of the suite
+func (args CreateTestCaseRequest) validateAgainstSuite(suite *server.TestSuite) (problems []string) {
+	protocol, kind := args.protocol(), suiteProtocol(suite)
+	if protocol != kind {
+		problems = append(problems, fmt.Sprintf("the test case is %s, but the suite %q is %s", protocol, suite.Name, kind))
+		return
+	}
+	if rpc := suite.GetSpec().GetRpc(); protocol == ProtocolGRPC && rpc != nil &&
+		!rpc.ServerReflection && rpc.Protofile == "" && rpc.Protoset == "" && rpc.Raw == "" {
+		problems = append(problems, fmt.Sprintf("the suite %q has no proto file, protoset or server reflection, set spec.rpc by update-test-suite", suite.Name))
+	}
+	return
+}
+
+// validate checks the kind of the suite and its settings
+func (args CreateTestSuiteRequest) validate() error {
+	switch strings.ToLower(args.Kind) {
+	case "", ProtocolHTTP, "swagger", ProtocolGraphQL:
+		if args.RPC != nil {
+			return errors.New("rpc is only supported by the grpc suite")
+		}
+	case ProtocolGRPC, "trpc":
+		if strings.Contains(args.API, "://") {
+			return fmt.Errorf("api %q of the grpc suite should be host:port without the scheme", args.API)
+		}
+	default:
+		return fmt.Errorf("not supported kind %q, should be one of http, swagger, grpc, graphql", args.Kind)
+	}
+	return nil
+}
+
+// updateSuiteSpec merges the spec into the suite
+func updateSuiteSpec(ctx context.Context, runner server.RunnerClient, name string, spec *APISpec) (err error) {
+	var suite *server.TestSuite
+	if suite, err = runner.GetTestSuite(ctx, &server.TestSuiteIdentity{Name: name}); err == nil {
+		spec.mergeInto(suite)
+		err = replyError(runner.UpdateTestSuite(ctx, suite))
+	}
+	return
+}
+
+func hasHeader(pairs []*server.Pair, key string) bool {
+	for _, pair := range pairs {
+		if strings.EqualFold(pair.Key, key) {
+			return true
+		}
+	}
+	return false
+}
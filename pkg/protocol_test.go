@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+)
+
+func TestValidateProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     CreateTestCaseRequest
+		problems []string
+	}{
+		{name: "grpc", args: CreateTestCaseRequest{CaseName: "a", GRPC: &GRPCRequest{Service: "server.Runner", Method: "GetVersion",
+			Message: `{"name":"{{.name}}"}`}}},
+		{name: "invalid grpc", args: CreateTestCaseRequest{CaseName: "a", API: "/a", Method: "GET", Body: "{}",
+			GRPC:    &GRPCRequest{Service: "server/Runner", Method: "Get.Version", Message: "{"},
+			GraphQL: &GraphQLRequest{Query: "{ a }"}},
+			problems: []string{"grpc and graphql can not be used together", `grpc.service "server/Runner" should be the full name`,
+				`grpc.method "Get.Version" should be the name of the method`, "grpc.message is not a valid JSON",
+				"api is not supported by gRPC test case", "method is not supported by gRPC test case", "body is not supported by gRPC test case"}},
+		{name: "grpc message template", args: CreateTestCaseRequest{CaseName: "a", GRPC: &GRPCRequest{Service: "a.B", Method: "C",
+			Message: `{"id": {{.id}`}}, problems: []string{"grpc.message is not a valid JSON", "template: grpc.message:1: bad character"}},
+		{name: "graphql", args: CreateTestCaseRequest{CaseName: "a", GraphQL: &GraphQLRequest{Query: "query { users { id } }"}}},
+		{name: "graphql with API", args: CreateTestCaseRequest{CaseName: "a", API: "/graphql", Method: "post",
+			GraphQL: &GraphQLRequest{Query: "{ users { id } }"}}},
+		{name: "invalid graphql", args: CreateTestCaseRequest{CaseName: "a", API: "graphql", Method: "GET", Body: "{}",
+			GraphQL: &GraphQLRequest{Query: "select * from users"}},
+			problems: []string{`api "graphql" should be a path`, "graphql.query should start with query", "method of GraphQL test case should be POST",
+				"body and formParams are not supported by GraphQL test case"}},
+		{name: "unbalanced graphql", args: CreateTestCaseRequest{CaseName: "a", GraphQL: &GraphQLRequest{Query: "query { users { id }"}},
+			problems: []string{"graphql.query has unbalanced braces"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.args.Validate()
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("expected problems %q, got %q", tt.problems, problems)
+			}
+			for i, problem := range tt.problems {
+				if !strings.HasPrefix(problems[i], problem) {
+					t.Fatalf("expected problems %q, got %q", tt.problems, problems)
+				}
+			}
+		})
+	}
+}
+
+func TestShapeRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     CreateTestCaseRequest
+		header   []*server.Pair
+		expected *server.Request
+	}{{
+		name:     "http",
+		args:     CreateTestCaseRequest{API: "/a", Method: "PUT", Body: "{}"},
+		expected: &server.Request{Api: "/a", Method: "PUT", Body: "{}"},
+	}, {
+		name:     "grpc",
+		args:     CreateTestCaseRequest{Method: "GET", GRPC: &GRPCRequest{Service: "server.Runner", Method: "GetVersion", Message: "{}"}},
+		expected: &server.Request{Api: "/server.Runner/GetVersion", Body: "{}"},
+	}, {
+		name: "graphql",
+		args: CreateTestCaseRequest{API: "/graphql", GraphQL: &GraphQLRequest{Query: "{ a }", Variables: map[string]string{"id": "1"}}},
+		expected: &server.Request{Api: "/graphql", Method: "POST", Body: `{"query":"{ a }","variables":{"id":"1"}}`,
+			Header: []*server.Pair{{Key: "Content-Type", Value: "application/json"}}},
+	}, {
+		name:   "graphql with content type",
+		args:   CreateTestCaseRequest{GraphQL: &GraphQLRequest{Query: "{ a }"}},
+		header: []*server.Pair{{Key: "content-type", Value: "application/graphql+json"}},
+		expected: &server.Request{Method: "POST", Body: `{"query":"{ a }"}`,
+			Header: []*server.Pair{{Key: "content-type", Value: "application/graphql+json"}}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &server.Request{Api: tt.args.API, Method: tt.args.Method, Body: tt.args.Body, Header: tt.header}
+			tt.args.shapeRequest(request)
+			if request.Api != tt.expected.Api || request.Method != tt.expected.Method || request.Body != tt.expected.Body ||
+				len(request.Header) != len(tt.expected.Header) {
+				t.Fatalf("expected %v, got %v", tt.expected, request)
+			}
+			for _, pair := range tt.expected.Header {
+				if headerValue(request.Header, pair.Key) != pair.Value {
+					t.Fatalf("expected header %s=%q, got %v", pair.Key, pair.Value, request.Header)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAgainstSuite(t *testing.T) {
+	httpCase := CreateTestCaseRequest{CaseName: "a", API: "/a", Method: "GET"}
+	grpcCase := CreateTestCaseRequest{CaseName: "a", GRPC: &GRPCRequest{Service: "a.B", Method: "C"}}
+	graphQLCase := CreateTestCaseRequest{CaseName: "a", GraphQL: &GraphQLRequest{Query: "{ a }"}}
+	tests := []struct {
+		name    string
+		args    CreateTestCaseRequest
+		suite   *server.TestSuite
+		problem string
+	}{
+		{name: "http", args: httpCase, suite: &server.TestSuite{Name: "s"}},
+		{name: "swagger", args: httpCase, suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Kind: "swagger"}}},
+		{name: "http in grpc suite", args: httpCase, suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Kind: "grpc"}},
+			problem: `the test case is http, but the suite "s" is grpc`},
+		{name: "grpc with reflection", args: grpcCase,
+			suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Rpc: &server.RPC{ServerReflection: true}}}},
+		{name: "trpc", args: grpcCase, suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Kind: "trpc"}}},
+		{name: "grpc without proto", args: grpcCase, suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Rpc: &server.RPC{}}},
+			problem: `the suite "s" has no proto file, protoset or server reflection`},
+		{name: "graphql", args: graphQLCase, suite: &server.TestSuite{Name: "s", Spec: &server.APISpec{Kind: "GraphQL"}}},
+		{name: "graphql in http suite", args: graphQLCase, suite: &server.TestSuite{Name: "s"},
+			problem: `the test case is graphql, but the suite "s" is http`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.args.validateAgainstSuite(tt.suite)
+			if (tt.problem == "") != (len(problems) == 0) || (tt.problem != "" && !strings.HasPrefix(problems[0], tt.problem)) {
+				t.Fatalf("expected problem %q, got %q", tt.problem, problems)
+			}
+		})
+	}
+}
+
+func TestCreateTestSuiteRequestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		args CreateTestSuiteRequest
+		err  string
+	}{
+		{name: "default", args: CreateTestSuiteRequest{API: "http://localhost"}},
+		{name: "grpc", args: CreateTestSuiteRequest{Kind: "grpc", API: "localhost:7070", RPC: &RPCSpec{Protofile: "server.proto"}}},
+		{name: "grpc with scheme", args: CreateTestSuiteRequest{Kind: "grpc", API: "http://localhost:7070"},
+			err: `api "http://localhost:7070" of the grpc suite should be host:port without the scheme`},
+		{name: "rpc of http", args: CreateTestSuiteRequest{Kind: "http", RPC: &RPCSpec{}}, err: "rpc is only supported by the grpc suite"},
+		{name: "unknown kind", args: CreateTestSuiteRequest{Kind: "soap"}, err: `not supported kind "soap"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.args.validate()
+			if (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
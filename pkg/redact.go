@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const redactedValue = "******"
+
+var secretRefPattern = regexp.MustCompile(`^(\w+ )?\{\{\s*secretValue\s+\\?"[^"\\]+\\?"\s*\}\}$`)
+
+// minSecretLength avoids masking the short values which appear everywhere
+const minSecretLength = 4
+
+// RedactConfig is what to mask in the tool results and the logs
+type RedactConfig struct {
+	// Headers are the names of the sensitive headers whose values are masked
+	Headers []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+}
+
+// Redactor masks the secret values and the sensitive headers, it is safe for concurrent use
+type Redactor struct {
+	patterns []*regexp.Regexp
+
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// NewRedactor creates the redactor of the given headers
+func NewRedactor(config RedactConfig) *Redactor {
+	r := &Redactor{}
+	if len(config.Headers) == 0 {
+		return r
+	}
+
+	names := make([]string, 0, len(config.Headers))
+	for _, header := range config.Headers {
+		names = append(names, regexp.QuoteMeta(header))
+	}
+	name := "(?i:" + strings.Join(names, "|") + ")"
+	r.patterns = []*regexp.Regexp{
+		// JSON object: "Authorization": "Bearer xxx"
+		regexp.MustCompile(`("` + name + `"\s*:\s*")((?:[^"\\]|\\.)*)(")`),
+		// JSON object in a JSON string: \"Authorization\": \"Bearer xxx\"
+		regexp.MustCompile(`(\\"` + name + `\\"\s*:\s*\\")((?:[^"\\]|\\[^"])*)(\\")`),
+		// JSON or proto pair: "key": "Authorization", "value": "xxx" or key:"Authorization" value:"xxx"
+		regexp.MustCompile(`("?key"?\s*:\s*"` + name + `"\s*,?\s*"?value"?\s*:\s*")((?:[^"\\]|\\.)*)(")`),
+		// JSON pair in a JSON string
+		regexp.MustCompile(`(\\"key\\"\s*:\s*\\"` + name + `\\"\s*,\s*\\"value\\"\s*:\s*\\")((?:[^"\\]|\\[^"])*)(\\")`),
+		// Go map: map[Authorization:Bearer xxx Accept:*/*]
+		regexp.MustCompile(`([\[ ]` + name + `:)([^\]"]*?)(\s+[\w-]+:|\])`),
+		// HTTP header line: Authorization: Bearer xxx
+		regexp.MustCompile(`(?m)(^\s*` + name + `:\s*)(.+?)(\s*)$`),
+	}
+	return r
+}
+
+// AddSecrets remembers the secret values to mask
+func (r *Redactor) AddSecrets(values ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		if len(value) >= minSecretLength && !slices.Contains(r.secrets, value) {
+			r.secrets = append(r.secrets, value)
+		}
+	}
+	// the longer ones first, in case a secret contains another one
+	slices.SortFunc(r.secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+}
+
+// String masks the text
+func (r *Redactor) String(text string) string {
+	if r == nil || text == "" {
+		return text
+	}
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	r.mu.RUnlock()
+
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			groups := pattern.FindStringSubmatch(match)
+			// the references of the secrets are not sensitive
+			if secretRefPattern.MatchString(groups[2]) {
+				return match
+			}
+			return groups[1] + redactedValue + groups[3]
+		})
+	}
+	return text
+}
+
+// Error masks the error message, the original error is kept for errors.Is and errors.As
+func (r *Redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	if msg := r.String(err.Error()); msg != err.Error() {
+		return &redactedError{msg: msg, err: err}
+	}
+	return err
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Result masks the text and the embedded resources of the tool result
+func (r *Redactor) Result(result *mcp.CallToolResult) {
+	if r == nil || result == nil {
+		return
+	}
+	for _, content := range result.Content {
+		switch item := content.(type) {
+		case *mcp.TextContent:
+			item.Text = r.String(item.Text)
+		case *mcp.EmbeddedResource:
+			if item.Resource != nil {
+				item.Resource.Text = r.String(item.Resource.Text)
+			}
+		}
+	}
+}
+
+// RedactValue masks the structured output of a tool, the zero value is returned if it can't be masked
+func RedactValue[T any](r *Redactor, value T) (redacted T) {
+	if r == nil {
+		return value
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	text := r.String(string(data))
+	if text == string(data) {
+		return value
+	}
+	_ = json.Unmarshal([]byte(text), &redacted)
+	return
+}
+
+// NewRedactHandler masks the messages and the attributes of the log records
+func NewRedactHandler(handler slog.Handler, redactor *Redactor) slog.Handler {
+	if redactor == nil {
+		return handler
+	}
+	return &redactHandler{handler: handler, redactor: redactor}
+}
+
+type redactHandler struct {
+	handler  slog.Handler
+	redactor *Redactor
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.attr(attr))
+		return true
+	})
+	return h.handler.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, h.attr(attr))
+	}
+	return &redactHandler{handler: h.handler.WithAttrs(redacted), redactor: h.redactor}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{handler: h.handler.WithGroup(name), redactor: h.redactor}
+}
+
+func (h *redactHandler) attr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.String(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, 0, len(group))
+		for _, item := range group {
+			redacted = append(redacted, h.attr(item))
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.Any(attr.Key, h.redactor.Error(err))
+		}
+		text := fmt.Sprint(value.Any())
+		if redacted := h.redactor.String(text); redacted != text {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	return attr
+}
@@ -0,0 +1,135 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestRedactorString(t *testing.T) {
+	redactor := NewRedactor(RedactConfig{Headers: []string{"Authorization", "X-Api-Key"}})
+	redactor.AddSecrets("s3cr3t-value", "abc")
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "plain", text: "nothing to hide", expected: "nothing to hide"},
+		{name: "secret value", text: "token is s3cr3t-value.", expected: "token is ******."},
+		{name: "short secret is kept", text: "abc", expected: "abc"},
+		{name: "JSON object", text: `{"Authorization": "Bearer xyz", "Accept": "*/*"}`,
+			expected: `{"Authorization": "******", "Accept": "*/*"}`},
+		{name: "case insensitive", text: `{"x-api-key":"xyz"}`, expected: `{"x-api-key":"******"}`},
+		{name: "escaped JSON", text: `"{\"Authorization\":\"Bearer xyz\"}"`, expected: `"{\"Authorization\":\"******\"}"`},
+		{name: "JSON pair", text: `{"key":"Authorization","value":"Bearer xyz"}`, expected: `{"key":"Authorization","value":"******"}`},
+		{name: "proto pair", text: `key:"Authorization" value:"Bearer xyz"`, expected: `key:"Authorization" value:"******"`},
+		{name: "escaped JSON pair", text: `{\"key\":\"Authorization\",\"value\":\"Bearer xyz\"}`,
+			expected: `{\"key\":\"Authorization\",\"value\":\"******\"}`},
+		{name: "Go map", text: "map[Accept:*/* Authorization:Bearer xyz]", expected: "map[Accept:*/* Authorization:******]"},
+		{name: "header line", text: "GET /api\nAuthorization: Bearer xyz\nAccept: */*",
+			expected: "GET /api\nAuthorization: ******\nAccept: */*"},
+		{name: "secret reference", text: `{"Authorization":"Bearer {{secretValue \"token\"}}"}`,
+			expected: `{"Authorization":"Bearer {{secretValue \"token\"}}"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := redactor.String(tt.text); actual != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+
+	var nilRedactor *Redactor
+	if actual := nilRedactor.String("s3cr3t-value"); actual != "s3cr3t-value" {
+		t.Fatalf("the nil redactor should keep the text, got %q", actual)
+	}
+}
+
+func TestRedactorErrorAndResult(t *testing.T) {
+	redactor := NewRedactor(RedactConfig{})
+	redactor.AddSecrets("s3cr3t-value")
+
+	err := redactor.Error(fs.ErrNotExist)
+	if err != fs.ErrNotExist {
+		t.Fatalf("the error without secrets should be kept, got %v", err)
+	}
+	err = redactor.Error(errors.Join(fs.ErrNotExist, errors.New("token s3cr3t-value")))
+	if strings.Contains(err.Error(), "s3cr3t-value") || !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	result := &mcp.CallToolResult{Content: []mcp.Content{
+		&mcp.TextContent{Text: "s3cr3t-value"},
+		&mcp.EmbeddedResource{Resource: &mcp.ResourceContents{Text: "x s3cr3t-value"}},
+	}}
+	redactor.Result(result)
+	if text := result.Content[0].(*mcp.TextContent).Text; text != redactedValue {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if text := result.Content[1].(*mcp.EmbeddedResource).Resource.Text; text != "x "+redactedValue {
+		t.Fatalf("unexpected resource %q", text)
+	}
+
+	type value struct {
+		Token string `json:"token"`
+	}
+	if actual := RedactValue(redactor, value{Token: "s3cr3t-value"}); actual.Token != redactedValue {
+		t.Fatalf("unexpected value %+v", actual)
+	}
+	if actual := RedactValue(redactor, &value{Token: "public"}); actual.Token != "public" {
+		t.Fatalf("unexpected value %+v", actual)
+	}
+}
+
+func TestRunRecorderRedact(t *testing.T) {
+	fake, runner := newFakeRunner(t)
+	fake.addSuite(&server.TestSuite{Name: "sample"}, &server.TestCase{Name: "a", Request: &server.Request{
+		Api:    "/a",
+		Header: []*server.Pair{{Key: "Authorization", Value: "Bearer xyz"}, {Key: "Accept", Value: "*/*"}},
+	}})
+	store, err := NewRunStore(StoreConfig{Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	redactor := NewRedactor(RedactConfig{Headers: []string{"Authorization"}})
+	redactor.AddSecrets("s3cr3t-value")
+	recorder := NewRunRecorder(store, runner.runners, runner.pool, runner.sessions, redactor)
+	handler := RecordRun(recorder, "run", func(context.Context, *mcp.CallToolRequest, RunRequest) (*mcp.CallToolResult, any, error) {
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: "Authorization: Bearer xyz"}}},
+			map[string]string{"body": "s3cr3t-value"}, errors.New("failed with s3cr3t-value")
+	})
+	if _, _, err = handler(context.Background(), nil, RunRequest{SuiteName: "sample", CaseName: "a"}); err == nil {
+		t.Fatal("expected the error of the handler")
+	}
+
+	records, err := store.Query(RunQuery{}, 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected a record, got %v: %v", records, err)
+	}
+	record := records[0]
+	if record.Suite != "sample" || record.Case != "a" || record.Request == nil || len(record.Request.Header) != 2 {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	if value := headerValue(record.Request.Header, "Authorization"); value != redactedValue {
+		t.Fatalf("the header should be masked, got %q", value)
+	}
+	if value := headerValue(record.Request.Header, "Accept"); value != "*/*" {
+		t.Fatalf("the header should be kept, got %q", value)
+	}
+	data := string(record.Args) + string(record.Response) + record.Output + record.Error
+	if strings.Contains(data, "s3cr3t-value") || strings.Contains(data, "xyz") {
+		t.Fatalf("the record should be masked: %s", data)
+	}
+	if record.Time.After(time.Now()) {
+		t.Fatalf("unexpected time %v", record.Time)
+	}
+}
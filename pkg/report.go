@@ -0,0 +1,501 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const (
+	ReportJUnit    = "junit"
+	ReportHTML     = "html"
+	ReportMarkdown = "markdown"
+
+	caseStatusPassed = "passed"
+	caseStatusFailed = "failed"
+	caseStatusError  = "error"
+
+	maxExcerptLength      = 500
+	maxReportNameAttempts = 100
+)
+
+type RunTestSuiteRequest struct {
+	Suite   string   `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Formats []string `json:"formats,omitempty" jsonschema:"the report formats: junit, html or markdown, default is all of them"`
+	Write   bool     `json:"write,omitempty" jsonschema:"write the reports into the configured report directory"`
+}
+
+// SuiteReport is the result of running all the test cases of a suite
+type SuiteReport struct {
+	Suite     string        `json:"suite"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+	Total     int           `json:"total"`
+	Passed    int           `json:"passed"`
+	Failed    int           `json:"failed"`
+	Errors    int           `json:"errors"`
+	Cases     []CaseReport  `json:"cases"`
+	Files     []string      `json:"files,omitempty"`
+}
+
+// CaseReport is the result of a test case, the request and response are truncated
+type CaseReport struct {
+	Name       string        `json:"name"`
+	Status     string        `json:"status"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int32         `json:"statusCode,omitempty"`
+	Failure    string        `json:"failure,omitempty"`
+	Request    string        `json:"request,omitempty"`
+	Response   string        `json:"response,omitempty"`
+}
+
+// SuiteReporter runs the test suites and generates the reports
+type SuiteReporter interface {
+	RunTestSuite(ctx context.Context, request *mcp.CallToolRequest, args RunTestSuiteRequest) (
+		result *mcp.CallToolResult, data SuiteReport, err error)
+}
+
+type suiteReporter struct {
+	*gRPCRunner
+	config   ReportConfig
+	redactor *Redactor
+}
+
+func NewSuiteReporter(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, config ReportConfig,
+	redactor *Redactor) SuiteReporter {
+	return &suiteReporter{
+		gRPCRunner: &gRPCRunner{
+			runners:  runners,
+			pool:     pool,
+			sessions: sessions,
+		},
+		config:   config,
+		redactor: redactor,
+	}
+}
+
+// RunTestSuite runs the test cases one by one in order, since a case might depend on the previous ones
+func (r *suiteReporter) RunTestSuite(ctx context.Context, request *mcp.CallToolRequest, args RunTestSuiteRequest) (
+	result *mcp.CallToolResult, data SuiteReport, err error) {
+	if args.Suite == "" {
+		args.Suite = r.session(request).Suite
+	}
+	formats := args.Formats
+	if len(formats) == 0 {
+		formats = []string{ReportJUnit, ReportHTML, ReportMarkdown}
+	}
+	for _, format := range formats {
+		if _, ok := reportFormats[format]; !ok {
+			err = fmt.Errorf("not supported report format %q, should be one of junit, html, markdown", format)
+			return
+		}
+	}
+	if args.Write && r.config.Dir == "" {
+		err = errors.New("the report directory is not configured, please set report.dir in the config file")
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+
+	var suite *server.Suite
+	if suite, err = runner.ListTestCase(ctx, &server.TestSuiteIdentity{Name: args.Suite}); err != nil {
+		return
+	}
+
+	data = SuiteReport{Suite: args.Suite, Timestamp: time.Now()}
+	for _, testCase := range suite.Items {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		data.Cases = append(data.Cases, runCaseReport(ctx, runner, r.redactor, args.Suite, testCase))
+	}
+	data.summarize(time.Since(data.Timestamp))
+
+	reports := make(map[string][]byte, len(formats))
+	for _, format := range formats {
+		if reports[reportFormats[format].ext], err = data.Render(format); err != nil {
+			return
+		}
+	}
+	name := reportFileName(args.Suite, data.Timestamp)
+	if args.Write {
+		if name, data.Files, err = writeReports(r.config.Dir, name, reports); err != nil {
+			return
+		}
+	}
+
+	var content []mcp.Content
+	content = append(content, &mcp.TextContent{Text: data.Markdown()})
+	for _, format := range formats {
+		info := reportFormats[format]
+		content = append(content, &mcp.EmbeddedResource{
+			Resource: &mcp.ResourceContents{
+				URI:      "atest-mcp://reports/" + name + info.ext,
+				MIMEType: info.mimeType,
+				Text:     string(reports[info.ext]),
+			},
+		})
+	}
+	if len(data.Files) > 0 {
+		content = append(content, &mcp.TextContent{Text: "the reports are written to:\n" + strings.Join(data.Files, "\n")})
+	}
+	result = &mcp.CallToolResult{Content: content}
+	return
+}
+
+// runCaseReport masks the texts before truncating and escaping them, otherwise the credentials might not be matched
+func runCaseReport(ctx context.Context, runner server.RunnerClient, redactor *Redactor, suite string,
+	testCase *server.TestCase) (report CaseReport) {
+	report = CaseReport{Name: testCase.Name, Request: requestExcerpt(testCase.Request, redactor)}
+
+	start := time.Now()
+	reply, err := runner.RunTestCase(ctx, &server.TestCaseIdentity{Suite: suite, Testcase: testCase.Name})
+	report.Duration = time.Since(start)
+
+	switch {
+	case err != nil:
+		report.Status, report.Failure = caseStatusError, redactor.String(err.Error())
+	case reply.Error != "":
+		report.Status, report.Failure = caseStatusFailed, redactor.String(reply.Error)
+	default:
+		report.Status = caseStatusPassed
+	}
+	if reply != nil {
+		report.StatusCode = reply.StatusCode
+		report.Response = excerpt(redactor.String(reply.Body))
+	}
+	return
+}
+
+func (r *SuiteReport) summarize(duration time.Duration) {
+	r.Duration = duration
+	r.Total = len(r.Cases)
+	for _, item := range r.Cases {
+		switch item.Status {
+		case caseStatusPassed:
+			r.Passed++
+		case caseStatusFailed:
+			r.Failed++
+		default:
+			r.Errors++
+		}
+	}
+}
+
+func requestExcerpt(req *server.Request, redactor *Redactor) string {
+	if req == nil {
+		return ""
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	text := method + " " + req.Api
+	if req.Body != "" {
+		text += "\n\n" + req.Body
+	}
+	return excerpt(redactor.String(text))
+}
+
+// excerpt truncates the long text on a rune boundary
+func excerpt(text string) string {
+	if len(text) <= maxExcerptLength {
+		return text
+	}
+	end := maxExcerptLength
+	for end > 0 && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	return text[:end] + "..."
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func reportFileName(suite string, timestamp time.Time) string {
+	return unsafeFileChars.ReplaceAllString(suite, "_") + "-" + timestamp.Format("20060102-150405")
+}
+
+// writeReports writes the reports of all formats with the same name, a counter is appended to the name
+// if any of the files exists, then the runs in the same second don't overwrite each other
+func writeReports(dir, base string, reports map[string][]byte) (name string, files []string, err error) {
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return
+	}
+	for i := 1; i <= maxReportNameAttempts; i++ {
+		name = base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		if files, err = createReports(dir, name, reports); !errors.Is(err, fs.ErrExist) {
+			return
+		}
+	}
+	err = fmt.Errorf("too many reports named %s in %s", base, dir)
+	return
+}
+
+// createReports creates the files exclusively, the created ones are removed if any of them fails
+func createReports(dir, name string, reports map[string][]byte) (files []string, err error) {
+	for _, ext := range slices.Sorted(maps.Keys(reports)) {
+		path := filepath.Join(dir, name+ext)
+		if err = createFile(path, reports[ext]); err != nil {
+			break
+		}
+		files = append(files, path)
+	}
+	if err != nil {
+		for _, file := range files {
+			_ = os.Remove(file)
+		}
+		files = nil
+	}
+	return
+}
+
+func createFile(path string, data []byte) (err error) {
+	var file *os.File
+	if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644); err != nil {
+		return
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return
+	}
+	if err = file.Close(); err != nil {
+		_ = os.Remove(path)
+	}
+	return
+}
+
+type reportFormat struct {
+	ext      string
+	mimeType string
+}
+
+var reportFormats = map[string]reportFormat{
+	ReportJUnit:    {ext: ".xml", mimeType: "application/xml"},
+	ReportHTML:     {ext: ".html", mimeType: "text/html"},
+	ReportMarkdown: {ext: ".md", mimeType: "text/markdown"},
+}
+
+// Render renders the report in the given format
+func (r SuiteReport) Render(format string) (data []byte, err error) {
+	switch format {
+	case ReportJUnit:
+		data, err = r.JUnit()
+	case ReportHTML:
+		data, err = r.HTML()
+	case ReportMarkdown:
+		data = []byte(r.Markdown())
+	default:
+		err = fmt.Errorf("not supported report format %q", format)
+	}
+	return
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut *junitText    `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitText struct {
+	Text string `xml:",cdata"`
+}
+
+// JUnit renders the report as JUnit XML which is consumed by most of the CI systems
+func (r SuiteReport) JUnit() (data []byte, err error) {
+	suite := junitTestSuite{
+		Name:      r.Suite,
+		Tests:     r.Total,
+		Failures:  r.Failed,
+		Errors:    r.Errors,
+		Time:      junitSeconds(r.Duration),
+		Timestamp: r.Timestamp.Format("2006-01-02T15:04:05"),
+	}
+	for _, item := range r.Cases {
+		testCase := junitTestCase{
+			Name:      item.Name,
+			ClassName: r.Suite,
+			Time:      junitSeconds(item.Duration),
+		}
+		if exchange := item.exchange(); exchange != "" {
+			testCase.SystemOut = &junitText{Text: exchange}
+		}
+		switch item.Status {
+		case caseStatusFailed:
+			testCase.Failure = &junitFailure{Message: firstLine(item.Failure), Text: item.Failure}
+		case caseStatusError:
+			testCase.Error = &junitFailure{Message: firstLine(item.Failure), Text: item.Failure}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	if data, err = xml.MarshalIndent(junitTestSuites{
+		Name:     r.Suite,
+		Tests:    r.Total,
+		Failures: r.Failed,
+		Errors:   r.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  "); err == nil {
+		data = append([]byte(xml.Header), data...)
+	}
+	return
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
+
+// exchange is the request and response excerpts
+func (c CaseReport) exchange() string {
+	var parts []string
+	if c.Request != "" {
+		parts = append(parts, "Request:\n"+c.Request)
+	}
+	if c.StatusCode != 0 || c.Response != "" {
+		parts = append(parts, fmt.Sprintf("Response (%d):\n%s", c.StatusCode, c.Response))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Markdown renders the report as a Markdown summary and table
+func (r SuiteReport) Markdown() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "# Test suite %s\n\n%d cases: %d passed, %d failed, %d errors in %s, at %s\n\n",
+		r.Suite, r.Total, r.Passed, r.Failed, r.Errors, r.Duration.Round(time.Millisecond), r.Timestamp.Format(time.RFC3339))
+	buf.WriteString("| Case | Status | Code | Duration | Failure |\n|---|---|---|---|---|\n")
+	for _, item := range r.Cases {
+		fmt.Fprintf(&buf, "| %s | %s | %d | %s | %s |\n", item.Name, item.Status, item.StatusCode,
+			item.Duration.Round(time.Millisecond), markdownCell(firstLine(item.Failure)))
+	}
+
+	failures := slices.DeleteFunc(slices.Clone(r.Cases), func(item CaseReport) bool {
+		return item.Status == caseStatusPassed
+	})
+	for _, item := range failures {
+		text := strings.TrimSpace(item.Failure + "\n\n" + item.exchange())
+		fence := markdownFence(text)
+		fmt.Fprintf(&buf, "\n## %s\n\n%s\n%s\n%s\n", item.Name, fence, text, fence)
+	}
+	return buf.String()
+}
+
+// markdownFence is longer than the longest backtick run in the text, then the text can't close the code block
+func markdownFence(text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(duration time.Duration) string {
+		return duration.Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Test suite {{.Suite}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #d0d7de; padding: 6px 10px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+.passed { color: #1a7f37; } .failed { color: #cf222e; } .error { color: #9a6700; }
+pre { background: #f6f8fa; padding: 8px; white-space: pre-wrap; word-break: break-all; margin: 4px 0; }
+</style>
+</head>
+<body>
+<h1>Test suite {{.Suite}}</h1>
+<p>{{.Total}} cases: <span class="passed">{{.Passed}} passed</span>, <span class="failed">{{.Failed}} failed</span>, <span class="error">{{.Errors}} errors</span> in {{ms .Duration}}, at {{.Timestamp.Format "2006-01-02 15:04:05"}}</p>
+<table>
+<tr><th>Case</th><th>Status</th><th>Code</th><th>Duration</th><th>Details</th></tr>
+{{- range .Cases}}
+<tr>
+<td>{{.Name}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{if .StatusCode}}{{.StatusCode}}{{end}}</td>
+<td>{{ms .Duration}}</td>
+<td>{{if .Failure}}<pre>{{.Failure}}</pre>{{end}}{{if .Request}}<details><summary>Request</summary><pre>{{.Request}}</pre></details>{{end}}{{if .Response}}<details><summary>Response</summary><pre>{{.Response}}</pre></details>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// HTML renders the report as a self-contained HTML page
+func (r SuiteReport) HTML() (data []byte, err error) {
+	var buf bytes.Buffer
+	if err = htmlReport.Execute(&buf, r); err == nil {
+		data = buf.Bytes()
+	}
+	return
+}
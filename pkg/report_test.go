@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+)
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "short", text: "abc", expected: "abc"},
+		{name: "limit", text: strings.Repeat("a", maxExcerptLength), expected: strings.Repeat("a", maxExcerptLength)},
+		{name: "long", text: strings.Repeat("a", maxExcerptLength+1), expected: strings.Repeat("a", maxExcerptLength) + "..."},
+		{name: "rune on the boundary", text: strings.Repeat("a", maxExcerptLength-1) + "你好",
+			expected: strings.Repeat("a", maxExcerptLength-1) + "..."},
+		{name: "multibyte runes", text: strings.Repeat("你", maxExcerptLength),
+			expected: strings.Repeat("你", maxExcerptLength/3) + "..."},
+		{name: "emoji", text: "a" + strings.Repeat("😀", maxExcerptLength),
+			expected: "a" + strings.Repeat("😀", (maxExcerptLength-1)/4) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := excerpt(tt.text)
+			if actual != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, actual)
+			}
+			if !utf8.ValidString(actual) {
+				t.Fatalf("the excerpt should be valid UTF-8: %q", actual)
+			}
+		})
+	}
+}
+
+func TestRequestExcerpt(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *server.Request
+		expected string
+	}{
+		{name: "nil"},
+		{name: "default method", request: &server.Request{Api: "/api"}, expected: "GET /api"},
+		{name: "body", request: &server.Request{Api: "/api", Method: "POST", Body: `{"a":1}`}, expected: "POST /api\n\n{\"a\":1}"},
+		{name: "secret", request: &server.Request{Api: "/api", Method: "POST", Body: `{"token":"s3cr3t-value"}`},
+			expected: "POST /api\n\n{\"token\":\"******\"}"},
+	}
+	redactor := NewRedactor(RedactConfig{})
+	redactor.AddSecrets("s3cr3t-value")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := requestExcerpt(tt.request, redactor); actual != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSuiteReportRender(t *testing.T) {
+	report := SuiteReport{
+		Suite:     "sample",
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Cases: []CaseReport{
+			{Name: "a", Status: caseStatusPassed, StatusCode: 200, Request: "GET /a"},
+			{Name: "b", Status: caseStatusFailed, StatusCode: 500, Failure: "status mismatch\nexpected 200", Response: "<oops>"},
+			{Name: "c", Status: caseStatusError, Failure: "connection | refused"},
+		},
+	}
+	report.summarize(1500 * time.Millisecond)
+	if report.Total != 3 || report.Passed != 1 || report.Failed != 1 || report.Errors != 1 {
+		t.Fatalf("unexpected summary %+v", report)
+	}
+
+	tests := []struct {
+		format   string
+		expected []string
+	}{{
+		format: ReportJUnit,
+		expected: []string{`<testsuites name="sample" tests="3" failures="1" errors="1" time="1.500">`,
+			`<failure message="status mismatch">`, `<error message="connection | refused">`, "Response (500):\n<oops>"},
+	}, {
+		format: ReportMarkdown,
+		expected: []string{"3 cases: 1 passed, 1 failed, 1 errors in 1.5s", "| b | failed | 500 |",
+			`| c | error | 0 | 0s | connection \| refused |`, "## b\n\n```\nstatus mismatch"},
+	}, {
+		format:   ReportHTML,
+		expected: []string{"<title>Test suite sample</title>", "&lt;oops&gt;", `<td class="failed">failed</td>`},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := report.Render(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, text := range tt.expected {
+				if !strings.Contains(string(data), text) {
+					t.Fatalf("expected %q in %s", text, data)
+				}
+			}
+			if tt.format == ReportJUnit {
+				var suites junitTestSuites
+				if err = xml.Unmarshal(data, &suites); err != nil || len(suites.Suites[0].Cases) != 3 {
+					t.Fatalf("invalid JUnit report %v: %s", err, data)
+				}
+			}
+		})
+	}
+	if _, err := report.Render("pdf"); err == nil {
+		t.Fatal("expected an error of the unknown format")
+	}
+}
+
+func TestRunTestSuite(t *testing.T) {
+	tests := []struct {
+		name    string
+		dir     bool
+		args    RunTestSuiteRequest
+		files   int
+		content int
+		err     string
+	}{
+		{name: "all formats", args: RunTestSuiteRequest{Suite: "sample"}, content: 4},
+		{name: "write", dir: true, args: RunTestSuiteRequest{Suite: "sample", Formats: []string{ReportJUnit}, Write: true},
+			files: 1, content: 3},
+		{name: "write without directory", args: RunTestSuiteRequest{Suite: "sample", Write: true}, err: "not configured"},
+		{name: "unknown format", args: RunTestSuiteRequest{Suite: "sample", Formats: []string{"pdf"}}, err: "not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"},
+				&server.TestCase{Name: "a", Request: &server.Request{Api: "/a", Body: "s3cr3t-value"}},
+				&server.TestCase{Name: "b", Request: &server.Request{Api: "/b"}})
+			fake.results["a"] = &server.TestCaseResult{StatusCode: 200, Body: `{"Authorization":"Bearer xyz"}`}
+			fake.results["b"] = &server.TestCaseResult{StatusCode: 500, Error: "status mismatch"}
+
+			var config ReportConfig
+			if tt.dir {
+				config.Dir = t.TempDir()
+			}
+			redactor := NewRedactor(RedactConfig{Headers: []string{"Authorization"}})
+			redactor.AddSecrets("s3cr3t-value")
+			reporter := NewSuiteReporter(runner.runners, runner.pool, runner.sessions, config, redactor)
+			result, data, err := reporter.RunTestSuite(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.Total != 2 || data.Passed != 1 || data.Failed != 1 || data.Cases[1].Failure != "status mismatch" {
+				t.Fatalf("unexpected report %+v", data)
+			}
+			if len(result.Content) != tt.content || len(data.Files) != tt.files {
+				t.Fatalf("expected %d contents and %d files, got %d and %v", tt.content, tt.files, len(result.Content), data.Files)
+			}
+			for _, file := range data.Files {
+				content, err := os.ReadFile(file)
+				if err != nil || filepath.Dir(file) != config.Dir {
+					t.Fatalf("the report should be written into %s: %v", config.Dir, err)
+				}
+				if strings.Contains(string(content), "s3cr3t-value") || strings.Contains(string(content), "xyz") {
+					t.Fatalf("the report should be masked: %s", content)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownFence(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "plain", expected: "```"},
+		{text: "a `code` span", expected: "```"},
+		{text: "```json\n{}\n```", expected: "````"},
+		{text: "`````", expected: "``````"},
+	}
+	for _, tt := range tests {
+		if fence := markdownFence(tt.text); fence != tt.expected {
+			t.Fatalf("expected %q of %q, got %q", tt.expected, tt.text, fence)
+		}
+	}
+
+	report := SuiteReport{Suite: "sample", Cases: []CaseReport{
+		{Name: "a", Status: caseStatusFailed, Failure: "mismatch", Response: "```\n# not a heading\n```"},
+	}}
+	if markdown := report.Markdown(); !strings.Contains(markdown, "## a\n\n````\nmismatch") ||
+		!strings.HasSuffix(markdown, "```\n````\n") {
+		t.Fatalf("the response should be kept in the code block: %s", markdown)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	reports := map[string][]byte{".md": []byte("markdown"), ".xml": []byte("junit")}
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name, files, err := writeReports(dir, "sample", reports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(files, []string{filepath.Join(dir, name+".md"), filepath.Join(dir, name+".xml")}) {
+			t.Fatalf("unexpected files %v", files)
+		}
+		names = append(names, name)
+	}
+	if !slices.Equal(names, []string{"sample", "sample-2", "sample-3"}) {
+		t.Fatalf("the reports should not overwrite each other, got %v", names)
+	}
+
+	// the name is skipped if any format exists, and the created files are removed
+	if err := os.WriteFile(filepath.Join(dir, "other.xml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := writeReports(dir, "other", reports)
+	if err != nil || name != "other-2" {
+		t.Fatalf("unexpected name %q: %v", name, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "other.md")); !os.IsNotExist(err) {
+		t.Fatalf("the partial report should be removed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "sample.md")); string(data) != "markdown" {
+		t.Fatalf("unexpected report %q", data)
+	}
+}
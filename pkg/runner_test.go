@@ -0,0 +1,377 @@
+package pkg
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+const fakeAddress = "passthrough:///bufnet"
+
+// fakeRunner is an in-memory runner served over bufconn, the RPCs which are not implemented return Unimplemented
+type fakeRunner struct {
+	server.UnimplementedRunnerServer
+
+	mu        sync.Mutex
+	suites    map[string]*server.TestSuite
+	cases     map[string][]*server.TestCase
+	histories []*server.HistoryTestResult
+	tasks     []*server.TestTask
+	secrets   map[string]string
+	// results are the results of RunTestCase by the case name, the default one passes
+	results map[string]*server.TestCaseResult
+	// changes are the changes of the stores and the secrets, such as "delete-store git"
+	changes []string
+	calls   map[string]int
+	stores  []string
+	// active is the number of the calls in progress, maxActive is the peak of it
+	active, maxActive int
+	// delay slows down the calls
+	delay time.Duration
+	// unavailable is the number of the next calls which fail with Unavailable
+	unavailable int
+	// block makes the calls wait until they are cancelled
+	block bool
+	// errors are returned by the given methods, such as "/server.Runner/CreateTestCase"
+	errors map[string]error
+}
+
+// newFakeRunner starts the runner, the returned runner talks to it through the pool with the given options
+func newFakeRunner(t *testing.T, options ...grpc.DialOption) (*fakeRunner, *gRPCRunner) {
+	t.Helper()
+	fake := &fakeRunner{
+		suites:  map[string]*server.TestSuite{},
+		cases:   map[string][]*server.TestCase{},
+		secrets: map[string]string{},
+		results: map[string]*server.TestCaseResult{},
+		calls:   map[string]int{},
+		errors:  map[string]error{},
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.UnaryInterceptor(fake.intercept))
+	server.RegisterRunnerServer(s, fake)
+	go func() {
+		_ = s.Serve(listener)
+	}()
+
+	pool := NewConnectionPool(append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+	}, options...)...)
+	t.Cleanup(func() {
+		_ = pool.Close()
+		s.Stop()
+	})
+	return fake, &gRPCRunner{
+		runners:  []RunnerConfig{{Name: "fake", Address: fakeAddress}},
+		pool:     pool,
+		sessions: NewSessionStore(nil),
+	}
+}
+
+func (f *fakeRunner) intercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	f.mu.Lock()
+	f.calls[info.FullMethod]++
+	var store string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(server.HeaderKeyStoreName); len(values) > 0 {
+			store = values[0]
+		}
+	}
+	f.stores = append(f.stores, store)
+	block, delay, err := f.block, f.delay, f.errors[info.FullMethod]
+	if f.unavailable > 0 {
+		f.unavailable--
+		err = status.Error(codes.Unavailable, "the runner is restarting")
+	}
+	f.active++
+	f.maxActive = max(f.maxActive, f.active)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.active--
+		f.mu.Unlock()
+	}()
+	time.Sleep(delay)
+
+	if block {
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (f *fakeRunner) callsOf(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls["/server.Runner/"+method]
+}
+
+// addSuite saves the suite and its cases directly
+func (f *fakeRunner) addSuite(suite *server.TestSuite, cases ...*server.TestCase) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.suites[suite.Name] = suite
+	f.cases[suite.Name] = cases
+}
+
+func (f *fakeRunner) testCase(suite, name string) *server.TestCase {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range f.cases[suite] {
+		if item.Name == name {
+			return proto.Clone(item).(*server.TestCase)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRunner) caseNames(suite string) (names []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range f.cases[suite] {
+		names = append(names, item.Name)
+	}
+	return
+}
+
+func (f *fakeRunner) GetVersion(context.Context, *server.Empty) (*server.Version, error) {
+	return &server.Version{Version: "v0.0.20"}, nil
+}
+
+func (f *fakeRunner) GetSuites(context.Context, *server.Empty) (*server.Suites, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	suites := &server.Suites{Data: map[string]*server.Items{}}
+	for name := range f.suites {
+		items := &server.Items{}
+		for _, item := range f.cases[name] {
+			items.Data = append(items.Data, item.Name)
+		}
+		suites.Data[name] = items
+	}
+	return suites, nil
+}
+
+func (f *fakeRunner) CreateTestSuite(_ context.Context, in *server.TestSuiteIdentity) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.suites[in.Name]; ok {
+		return &server.HelloReply{Error: "suite " + in.Name + " already exists"}, nil
+	}
+	f.suites[in.Name] = &server.TestSuite{Name: in.Name, Api: in.Api, Spec: &server.APISpec{Kind: in.Kind}}
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) GetTestSuite(_ context.Context, in *server.TestSuiteIdentity) (*server.TestSuite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if suite, ok := f.suites[in.Name]; ok {
+		return proto.Clone(suite).(*server.TestSuite), nil
+	}
+	return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.Name)
+}
+
+func (f *fakeRunner) UpdateTestSuite(_ context.Context, in *server.TestSuite) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.suites[in.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.Name)
+	}
+	f.suites[in.Name] = proto.Clone(in).(*server.TestSuite)
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) DeleteTestSuite(_ context.Context, in *server.TestSuiteIdentity) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.suites[in.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.Name)
+	}
+	delete(f.suites, in.Name)
+	delete(f.cases, in.Name)
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) ListTestCase(_ context.Context, in *server.TestSuiteIdentity) (*server.Suite, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	suite, ok := f.suites[in.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.Name)
+	}
+	reply := &server.Suite{Name: suite.Name, Api: suite.Api}
+	for _, item := range f.cases[in.Name] {
+		reply.Items = append(reply.Items, proto.Clone(item).(*server.TestCase))
+	}
+	return reply, nil
+}
+
+func (f *fakeRunner) GetTestCase(_ context.Context, in *server.TestCaseIdentity) (*server.TestCase, error) {
+	if item := f.testCase(in.Suite, in.Testcase); item != nil {
+		return item, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "case %s is not found in suite %s", in.Testcase, in.Suite)
+}
+
+func (f *fakeRunner) CreateTestCase(_ context.Context, in *server.TestCaseWithSuite) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.suites[in.SuiteName]; !ok {
+		return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.SuiteName)
+	}
+	if slices.ContainsFunc(f.cases[in.SuiteName], func(item *server.TestCase) bool { return item.Name == in.Data.Name }) {
+		return &server.HelloReply{Error: "case " + in.Data.Name + " already exists"}, nil
+	}
+	f.cases[in.SuiteName] = append(f.cases[in.SuiteName], proto.Clone(in.Data).(*server.TestCase))
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) UpdateTestCase(_ context.Context, in *server.TestCaseWithSuite) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	index := slices.IndexFunc(f.cases[in.SuiteName], func(item *server.TestCase) bool { return item.Name == in.Data.Name })
+	if index < 0 {
+		return nil, status.Errorf(codes.NotFound, "case %s is not found in suite %s", in.Data.Name, in.SuiteName)
+	}
+	f.cases[in.SuiteName][index] = proto.Clone(in.Data).(*server.TestCase)
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) DeleteTestCase(_ context.Context, in *server.TestCaseIdentity) (*server.HelloReply, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cases := f.cases[in.Suite]
+	index := slices.IndexFunc(cases, func(item *server.TestCase) bool { return item.Name == in.Testcase })
+	if index < 0 {
+		return nil, status.Errorf(codes.NotFound, "case %s is not found in suite %s", in.Testcase, in.Suite)
+	}
+	f.cases[in.Suite] = slices.Delete(cases, index, index+1)
+	return &server.HelloReply{}, nil
+}
+
+func (f *fakeRunner) GetTestCaseAllHistory(_ context.Context, in *server.TestCase) (*server.HistoryTestCases, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := &server.HistoryTestCases{}
+	for _, item := range f.histories {
+		if item.Data.SuiteName == in.SuiteName && (in.Name == "" || item.Data.CaseName == in.Name) {
+			reply.Data = append(reply.Data, proto.Clone(item.Data).(*server.HistoryTestCase))
+		}
+	}
+	return reply, nil
+}
+
+func (f *fakeRunner) GetHistorySuites(context.Context, *server.Empty) (*server.HistorySuites, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := &server.HistorySuites{Data: map[string]*server.HistoryItems{}}
+	for _, item := range f.histories {
+		items, ok := reply.Data[item.Data.SuiteName]
+		if !ok {
+			items = &server.HistoryItems{}
+			reply.Data[item.Data.SuiteName] = items
+		}
+		items.Data = append(items.Data, &server.HistoryCaseIdentity{
+			ID: item.Data.ID, Suite: item.Data.SuiteName, Testcase: item.Data.CaseName})
+	}
+	return reply, nil
+}
+
+func (f *fakeRunner) GetHistoryTestCaseWithResult(_ context.Context, in *server.HistoryTestCase) (*server.HistoryTestResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range f.histories {
+		if item.Data.ID == in.ID {
+			return proto.Clone(item).(*server.HistoryTestResult), nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "history %s is not found", in.ID)
+}
+
+func (f *fakeRunner) GetTestSuiteYaml(_ context.Context, in *server.TestSuiteIdentity) (*server.YamlData, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.suites[in.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "suite %s is not found", in.Name)
+	}
+	return &server.YamlData{Data: []byte("name: " + in.Name)}, nil
+}
+
+func (f *fakeRunner) Run(_ context.Context, in *server.TestTask) (*server.TestResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks = append(f.tasks, proto.Clone(in).(*server.TestTask))
+	return &server.TestResult{TestCaseResult: []*server.TestCaseResult{{StatusCode: 200, Body: "{}"}}}, nil
+}
+
+func (f *fakeRunner) RunTestCase(_ context.Context, in *server.TestCaseIdentity) (*server.TestCaseResult, error) {
+	if f.testCase(in.Suite, in.Testcase) == nil {
+		return nil, status.Errorf(codes.NotFound, "case %s is not found in suite %s", in.Testcase, in.Suite)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if result, ok := f.results[in.Testcase]; ok {
+		return proto.Clone(result).(*server.TestCaseResult), nil
+	}
+	return &server.TestCaseResult{StatusCode: 200, Body: "{}"}, nil
+}
+
+func (f *fakeRunner) GetSecrets(context.Context, *server.Empty) (*server.Secrets, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := &server.Secrets{}
+	for name, value := range f.secrets {
+		reply.Data = append(reply.Data, &server.Secret{Name: name, Value: value})
+	}
+	return reply, nil
+}
+
+func (f *fakeRunner) CreateSecret(_ context.Context, in *server.Secret) (*server.CommonResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.secrets[in.Name]; ok {
+		return &server.CommonResult{Message: "secret " + in.Name + " already exists"}, nil
+	}
+	f.secrets[in.Name] = in.Value
+	f.changes = append(f.changes, "create-secret "+in.Name)
+	return &server.CommonResult{Success: true}, nil
+}
+
+func (f *fakeRunner) UpdateSecret(_ context.Context, in *server.Secret) (*server.CommonResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.secrets[in.Name]; !ok {
+		return &server.CommonResult{Message: "secret " + in.Name + " is not found"}, nil
+	}
+	f.secrets[in.Name] = in.Value
+	f.changes = append(f.changes, "update-secret "+in.Name)
+	return &server.CommonResult{Success: true}, nil
+}
+
+func (f *fakeRunner) DeleteSecret(_ context.Context, in *server.Secret) (*server.CommonResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.secrets[in.Name]; !ok {
+		return &server.CommonResult{Message: "secret " + in.Name + " is not found"}, nil
+	}
+	delete(f.secrets, in.Name)
+	f.changes = append(f.changes, "delete-secret "+in.Name)
+	return &server.CommonResult{Success: true}, nil
+}
@@ -0,0 +1,320 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/xeipuuv/gojsonschema"
+	"google.golang.org/grpc"
+)
+
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// InferSchema infers the JSON schema from the decoded JSON samples.
+// The fields which are missing in some samples are optional, and the string format is kept if all the samples match it.
+func InferSchema(samples ...any) map[string]any {
+	node := &schemaNode{}
+	for _, sample := range samples {
+		node.add(sample)
+	}
+	return node.build()
+}
+
+// schemaNode collects the samples at a path
+type schemaNode struct {
+	types      map[string]bool
+	count      int
+	objects    int
+	properties map[string]*schemaNode
+	items      *schemaNode
+	strings    int
+	formats    map[string]int
+}
+
+func (n *schemaNode) add(value any) {
+	if n.types == nil {
+		n.types = map[string]bool{}
+	}
+	n.count++
+
+	switch val := value.(type) {
+	case map[string]any:
+		n.types["object"] = true
+		n.objects++
+		if n.properties == nil {
+			n.properties = map[string]*schemaNode{}
+		}
+		for key, item := range val {
+			if n.properties[key] == nil {
+				n.properties[key] = &schemaNode{}
+			}
+			n.properties[key].add(item)
+		}
+	case []any:
+		n.types["array"] = true
+		if n.items == nil {
+			n.items = &schemaNode{}
+		}
+		for _, item := range val {
+			n.items.add(item)
+		}
+	case string:
+		n.types["string"] = true
+		n.strings++
+		if n.formats == nil {
+			n.formats = map[string]int{}
+		}
+		n.formats[detectFormat(val)]++
+	case json.Number:
+		if strings.ContainsAny(val.String(), ".eE") {
+			n.types["number"] = true
+		} else {
+			n.types["integer"] = true
+		}
+	case float64:
+		if val == float64(int64(val)) {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+	case bool:
+		n.types["boolean"] = true
+	case nil:
+		n.types["null"] = true
+	}
+}
+
+func (n *schemaNode) build() (schema map[string]any) {
+	schema = map[string]any{}
+	if n.types["number"] {
+		delete(n.types, "integer")
+	}
+	var types []string
+	for item := range n.types {
+		types = append(types, item)
+	}
+	slices.Sort(types)
+	switch len(types) {
+	case 0:
+	case 1:
+		schema["type"] = types[0]
+	default:
+		schema["type"] = types
+	}
+
+	if n.types["object"] {
+		properties := map[string]any{}
+		var required []string
+		for key, property := range n.properties {
+			properties[key] = property.build()
+			if property.count >= n.objects {
+				required = append(required, key)
+			}
+		}
+		schema["properties"] = properties
+		if len(required) > 0 {
+			slices.Sort(required)
+			schema["required"] = required
+		}
+	}
+	if n.types["array"] && n.items != nil && len(n.items.types) > 0 {
+		schema["items"] = n.items.build()
+	}
+	if n.types["string"] && len(n.formats) == 1 {
+		for format, count := range n.formats {
+			if format != "" && count == n.strings {
+				schema["format"] = format
+			}
+		}
+	}
+	return
+}
+
+func detectFormat(value string) string {
+	if _, err := time.Parse(time.RFC3339, value); err == nil {
+		return "date-time"
+	}
+	if _, err := time.Parse(time.DateOnly, value); err == nil {
+		return "date"
+	}
+	if uuidPattern.MatchString(value) {
+		return "uuid"
+	}
+	if emailPattern.MatchString(value) {
+		return "email"
+	}
+	if u, err := url.Parse(value); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return "uri"
+	}
+	return ""
+}
+
+// SchemaError is a violation of the JSON schema
+type SchemaError struct {
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// ValidateSchema checks if the schema is a valid JSON schema
+func ValidateSchema(schema string) (err error) {
+	if schema == "" {
+		return
+	}
+	if !json.Valid([]byte(schema)) {
+		err = errors.New("invalid JSON schema: not a JSON document")
+		return
+	}
+	if _, err = gojsonschema.NewSchema(gojsonschema.NewStringLoader(schema)); err != nil {
+		err = fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return
+}
+
+// validateJSONSchema validates the body against the schema, and returns every violation with its path
+func validateJSONSchema(schema, body string) (errs []SchemaError, err error) {
+	var result *gojsonschema.Result
+	if result, err = gojsonschema.Validate(gojsonschema.NewStringLoader(schema), gojsonschema.NewStringLoader(body)); err != nil {
+		return
+	}
+	for _, item := range result.Errors() {
+		schemaErr := SchemaError{
+			Path:    item.Field(),
+			Message: item.Description(),
+		}
+		if expected, ok := item.Details()["expected"]; ok {
+			schemaErr.Expected = fmt.Sprint(expected)
+		}
+		if given, ok := item.Details()["given"]; ok {
+			schemaErr.Actual = fmt.Sprint(given)
+		}
+		errs = append(errs, schemaErr)
+	}
+	return
+}
+
+type InferSchemaRequest struct {
+	Samples []string `json:"samples" jsonschema:"the JSON samples of the response body, more samples give more accurate optional fields and formats"`
+}
+
+// InferredSchema is the schema inferred from the samples
+type InferredSchema struct {
+	Schema string `json:"schema"`
+}
+
+// InferSchemaFromSamples infers the JSON schema which can be used as the expectSchema of a test case
+func InferSchemaFromSamples(ctx context.Context, request *mcp.CallToolRequest, args InferSchemaRequest) (
+	result *mcp.CallToolResult, data InferredSchema, err error) {
+	if len(args.Samples) == 0 {
+		err = errors.New("samples are required")
+		return
+	}
+	samples := make([]any, 0, len(args.Samples))
+	for i, item := range args.Samples {
+		var sample any
+		if sample, err = decodeJSON(item); err != nil {
+			err = fmt.Errorf("sample %d is not a valid JSON: %w", i+1, err)
+			return
+		}
+		samples = append(samples, sample)
+	}
+
+	var schema []byte
+	if schema, err = json.MarshalIndent(InferSchema(samples...), "", "  "); err == nil {
+		data.Schema = string(schema)
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: data.Schema},
+			},
+		}
+	}
+	return
+}
+
+type ValidateResponseRequest struct {
+	Suite    string `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase string `json:"testcase,omitempty" jsonschema:"the name of test case which has the expectSchema"`
+	Body     string `json:"body" jsonschema:"the JSON payload to validate"`
+	Schema   string `json:"schema,omitempty" jsonschema:"the JSON schema to use instead of the one of the test case"`
+}
+
+// ValidationResult is the result of validating a payload against a schema
+type ValidationResult struct {
+	Valid  bool          `json:"valid"`
+	Errors []SchemaError `json:"errors,omitempty"`
+}
+
+// String renders the result in a readable way
+func (v ValidationResult) String() string {
+	if v.Valid {
+		return "the payload matches the schema"
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "the payload does not match the schema, %d error(s):\n", len(v.Errors))
+	for _, item := range v.Errors {
+		fmt.Fprintf(&buf, "- %s: %s", item.Path, item.Message)
+		if item.Expected != "" || item.Actual != "" {
+			fmt.Fprintf(&buf, " (expected: %s, actual: %s)", item.Expected, item.Actual)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func (r *gRPCRunner) ValidateResponse(ctx context.Context, request *mcp.CallToolRequest, args ValidateResponseRequest) (
+	result *mcp.CallToolResult, data ValidationResult, err error) {
+	schema := args.Schema
+	if schema == "" {
+		if args.Suite == "" {
+			args.Suite = r.session(request).Suite
+		}
+		if args.Suite == "" || args.Testcase == "" {
+			err = errors.New("schema, or suite and testcase are required")
+			return
+		}
+
+		var conn grpc.ClientConnInterface
+		if conn, err = r.getConnection(request); err != nil {
+			return
+		}
+		var testCase *server.TestCase
+		if testCase, err = server.NewRunnerClient(conn).GetTestCase(ctx,
+			&server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase}); err != nil {
+			return
+		}
+		if testCase.Response != nil {
+			schema = testCase.Response.Schema
+		}
+		if schema == "" {
+			err = fmt.Errorf("test case %q has no expectSchema", args.Testcase)
+			return
+		}
+	}
+	if err = ValidateSchema(schema); err != nil {
+		return
+	}
+	if !json.Valid([]byte(args.Body)) {
+		err = errors.New("body is not a valid JSON")
+		return
+	}
+
+	if data.Errors, err = validateJSONSchema(schema, args.Body); err == nil {
+		data.Valid = len(data.Errors) == 0
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: data.String()},
+			},
+		}
+	}
+	return
+}
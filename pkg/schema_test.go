@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestInferSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []string
+		expected string
+	}{
+		{name: "scalars", samples: []string{`{"a":1,"b":1.5,"c":true,"d":null,"e":"x"}`},
+			expected: `{"properties":{"a":{"type":"integer"},"b":{"type":"number"},"c":{"type":"boolean"},"d":{"type":"null"},"e":{"type":"string"}},"required":["a","b","c","d","e"],"type":"object"}`},
+		{name: "optional fields", samples: []string{`{"a":1,"b":2}`, `{"a":3}`},
+			expected: `{"properties":{"a":{"type":"integer"},"b":{"type":"integer"}},"required":["a"],"type":"object"}`},
+		{name: "integer and number", samples: []string{`1`, `1.5`}, expected: `{"type":"number"}`},
+		{name: "multiple types", samples: []string{`"a"`, `null`}, expected: `{"type":["null","string"]}`},
+		{name: "array items", samples: []string{`[{"id":1},{"id":2,"name":"a"}]`},
+			expected: `{"items":{"properties":{"id":{"type":"integer"},"name":{"type":"string"}},"required":["id"],"type":"object"},"type":"array"}`},
+		{name: "empty array", samples: []string{`[]`}, expected: `{"type":"array"}`},
+		{name: "date-time", samples: []string{`"2025-01-01T00:00:00Z"`}, expected: `{"format":"date-time","type":"string"}`},
+		{name: "date", samples: []string{`"2025-01-01"`}, expected: `{"format":"date","type":"string"}`},
+		{name: "uuid", samples: []string{`"0b8f3b56-6c53-4d2e-9a5e-0a8b0b8f3b56"`}, expected: `{"format":"uuid","type":"string"}`},
+		{name: "email", samples: []string{`"a@example.com"`}, expected: `{"format":"email","type":"string"}`},
+		{name: "uri", samples: []string{`"https://example.com/a"`}, expected: `{"format":"uri","type":"string"}`},
+		{name: "mixed formats", samples: []string{`"a@example.com"`, `"https://example.com"`}, expected: `{"type":"string"}`},
+		{name: "not all match the format", samples: []string{`"a@example.com"`, `"a"`}, expected: `{"type":"string"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var samples []any
+			for _, item := range tt.samples {
+				sample, err := decodeJSON(item)
+				if err != nil {
+					t.Fatal(err)
+				}
+				samples = append(samples, sample)
+			}
+			schema, _ := json.Marshal(InferSchema(samples...))
+			if string(schema) != tt.expected {
+				t.Fatalf("expected %s, got %s", tt.expected, schema)
+			}
+			for _, item := range tt.samples {
+				if errs, err := validateJSONSchema(string(schema), item); err != nil || len(errs) > 0 {
+					t.Fatalf("the sample %s should match the schema: %v %v", item, errs, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{name: "empty"},
+		{name: "valid", schema: `{"type":"object"}`},
+		{name: "not JSON", schema: `type: object`, err: "not a JSON document"},
+		{name: "invalid type", schema: `{"type":"text"}`, err: "invalid JSON schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSchema(tt.schema)
+			if (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestInferSchemaFromSamples(t *testing.T) {
+	if _, _, err := InferSchemaFromSamples(context.Background(), nil, InferSchemaRequest{}); err == nil {
+		t.Fatal("expected the error of no sample")
+	}
+	if _, _, err := InferSchemaFromSamples(context.Background(), nil, InferSchemaRequest{Samples: []string{`{}`, `{`}}); err == nil ||
+		!strings.Contains(err.Error(), "sample 2 is not a valid JSON") {
+		t.Fatalf("expected the error of the invalid sample, got %v", err)
+	}
+	result, data, err := InferSchemaFromSamples(context.Background(), nil, InferSchemaRequest{Samples: []string{`{"a":1}`}})
+	if err != nil || ValidateSchema(data.Schema) != nil || result.Content[0].(*mcp.TextContent).Text != data.Schema {
+		t.Fatalf("unexpected schema %q: %v", data.Schema, err)
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	schema := `{"type":"object","properties":{"id":{"type":"integer"}},"required":["id"]}`
+	tests := []struct {
+		name     string
+		args     ValidateResponseRequest
+		valid    bool
+		expected string
+		err      string
+	}{
+		{name: "valid", args: ValidateResponseRequest{Schema: schema, Body: `{"id":1}`}, valid: true, expected: "the payload matches the schema"},
+		{name: "invalid", args: ValidateResponseRequest{Schema: schema, Body: `{"id":"1"}`},
+			expected: "1 error(s):\n- id: Invalid type. Expected: integer, given: string (expected: integer, actual: string)"},
+		{name: "schema of the case", args: ValidateResponseRequest{Suite: "sample", Testcase: "a", Body: `{}`},
+			expected: "- (root): id is required"},
+		{name: "case without schema", args: ValidateResponseRequest{Suite: "sample", Testcase: "b", Body: `{}`}, err: `test case "b" has no expectSchema`},
+		{name: "no schema", args: ValidateResponseRequest{Body: `{}`}, err: "schema, or suite and testcase are required"},
+		{name: "invalid schema", args: ValidateResponseRequest{Schema: `{`, Body: `{}`}, err: "invalid JSON schema"},
+		{name: "invalid body", args: ValidateResponseRequest{Schema: schema, Body: `{`}, err: "body is not a valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"},
+				&server.TestCase{Name: "a", Response: &server.Response{Schema: schema}}, &server.TestCase{Name: "b"})
+
+			result, data, err := runner.ValidateResponse(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text := result.Content[0].(*mcp.TextContent).Text; data.Valid != tt.valid || !strings.Contains(text, tt.expected) {
+				t.Fatalf("expected valid %v with %q, got %q", tt.valid, tt.expected, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+type SecretRequest struct {
+	Name        string `json:"name" jsonschema:"the name of secret, the test cases reference it by {{secretValue \"name\"}} or secretHeaders"`
+	Value       string `json:"value,omitempty" jsonschema:"the value of secret, it is never returned"`
+	Description string `json:"description,omitempty" jsonschema:"the description of secret"`
+}
+
+// SecretInfo is a secret without its value
+type SecretInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type SecretList struct {
+	Secrets []SecretInfo `json:"secrets"`
+}
+
+// SecretManager provides the CRUD of the runner secrets, the values are masked in all the outputs
+type SecretManager interface {
+	ListSecrets(ctx context.Context, request *mcp.CallToolRequest, args any) (
+		result *mcp.CallToolResult, data SecretList, err error)
+	CreateSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	UpdateSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	DeleteSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+		result *mcp.CallToolResult, a any, err error)
+	// LoadSecrets gives the existing secrets of all the runners to the redactor
+	LoadSecrets(ctx context.Context) error
+}
+
+type secretManager struct {
+	*gRPCRunner
+	redactor *Redactor
+}
+
+// NewSecretManager creates the manager, the secret values are given to the redactor
+func NewSecretManager(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, redactor *Redactor) SecretManager {
+	return &secretManager{
+		gRPCRunner: &gRPCRunner{
+			runners:  runners,
+			pool:     pool,
+			sessions: sessions,
+		},
+		redactor: redactor,
+	}
+}
+
+func (s *secretManager) ListSecrets(ctx context.Context, request *mcp.CallToolRequest, args any) (
+	result *mcp.CallToolResult, data SecretList, err error) {
+	var conn grpc.ClientConnInterface
+	if conn, err = s.getConnection(request); err != nil {
+		return
+	}
+	var reply *server.Secrets
+	if reply, err = server.NewRunnerClient(conn).GetSecrets(ctx, &server.Empty{}); err != nil {
+		return
+	}
+
+	data.Secrets = make([]SecretInfo, 0, len(reply.Data))
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d secret(s):\n", len(reply.Data))
+	for _, item := range reply.Data {
+		s.redactor.AddSecrets(item.Value)
+		data.Secrets = append(data.Secrets, SecretInfo{Name: item.Name, Description: item.Description})
+		fmt.Fprintf(&buf, "- %s", item.Name)
+		if item.Description != "" {
+			fmt.Fprintf(&buf, ": %s", item.Description)
+		}
+		buf.WriteString("\n")
+	}
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: buf.String()},
+		},
+	}
+	return
+}
+
+func (s *secretManager) LoadSecrets(ctx context.Context) error {
+	var errs []error
+	for _, runner := range s.runners {
+		conn, err := s.pool.Get(runner.Address)
+		var reply *server.Secrets
+		if err == nil {
+			reply, err = server.NewRunnerClient(conn).GetSecrets(ctx, &server.Empty{})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load the secrets of runner %q: %w", runner.Name, err))
+			continue
+		}
+		for _, item := range reply.Data {
+			s.redactor.AddSecrets(item.Value)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *secretManager) CreateSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	return s.saveSecret(ctx, request, args, "created")
+}
+
+func (s *secretManager) UpdateSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	return s.saveSecret(ctx, request, args, "updated")
+}
+
+func (s *secretManager) saveSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest, action string) (
+	result *mcp.CallToolResult, a any, err error) {
+	if args.Name == "" || args.Value == "" {
+		err = errors.New("name and value are required")
+		return
+	}
+	// mask the value before it could appear in any output
+	s.redactor.AddSecrets(args.Value)
+
+	var conn grpc.ClientConnInterface
+	if conn, err = s.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+	secret := &server.Secret{Name: args.Name, Value: args.Value, Description: args.Description}
+
+	var reply *server.CommonResult
+	if action == "created" {
+		reply, err = runner.CreateSecret(ctx, secret)
+	} else {
+		reply, err = runner.UpdateSecret(ctx, secret)
+	}
+	if err = commonResultError(reply, err); err == nil {
+		result = textResult(fmt.Sprintf("secret %q is %s, reference it by {{secretValue %q}}", args.Name, action, args.Name))
+	}
+	return
+}
+
+func (s *secretManager) DeleteSecret(ctx context.Context, request *mcp.CallToolRequest, args SecretRequest) (
+	result *mcp.CallToolResult, a any, err error) {
+	if args.Name == "" {
+		err = errors.New("name is required")
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = s.getConnection(request); err != nil {
+		return
+	}
+	if err = commonResultError(server.NewRunnerClient(conn).DeleteSecret(ctx, &server.Secret{Name: args.Name})); err == nil {
+		result = textResult(fmt.Sprintf("secret %q is deleted", args.Name))
+	}
+	return
+}
+
+// secretRef is the template which reads the secret in the runner
+func secretRef(name string) string {
+	return fmt.Sprintf("{{secretValue %q}}", name)
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSecretManager(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(manager SecretManager) (*mcp.CallToolResult, error)
+		expected string
+		changes  []string
+		masked   string
+		err      string
+	}{{
+		name: "create",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.CreateSecret(context.Background(), nil, SecretRequest{Name: "new", Value: "new-value"})
+			return
+		},
+		expected: `secret "new" is created, reference it by {{secretValue "new"}}`,
+		changes:  []string{"create-secret new"},
+		masked:   "new-value",
+	}, {
+		name: "create an existing one",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.CreateSecret(context.Background(), nil, SecretRequest{Name: "token", Value: "new-value"})
+			return
+		},
+		err: "secret token already exists",
+	}, {
+		name: "update",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.UpdateSecret(context.Background(), nil, SecretRequest{Name: "token", Value: "new-value"})
+			return
+		},
+		expected: `secret "token" is updated`,
+		changes:  []string{"update-secret token"},
+		masked:   "new-value",
+	}, {
+		name: "update without value",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.UpdateSecret(context.Background(), nil, SecretRequest{Name: "token"})
+			return
+		},
+		err: "name and value are required",
+	}, {
+		name: "delete",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.DeleteSecret(context.Background(), nil, SecretRequest{Name: "token"})
+			return
+		},
+		expected: `secret "token" is deleted`,
+		changes:  []string{"delete-secret token"},
+	}, {
+		name: "delete a missing one",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.DeleteSecret(context.Background(), nil, SecretRequest{Name: "missing"})
+			return
+		},
+		err: "secret missing is not found",
+	}, {
+		name: "list",
+		call: func(manager SecretManager) (result *mcp.CallToolResult, err error) {
+			result, _, err = manager.ListSecrets(context.Background(), nil, nil)
+			return
+		},
+		expected: "1 secret(s):\n- token\n",
+		masked:   "s3cr3t-value",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.secrets["token"] = "s3cr3t-value"
+			redactor := NewRedactor(RedactConfig{})
+			manager := NewSecretManager(runner.runners, runner.pool, runner.sessions, redactor)
+
+			result, err := tt.call(manager)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if text := result.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, tt.expected) {
+				t.Fatalf("expected %q, got %q", tt.expected, text)
+			}
+			if !slices.Equal(fake.changes, tt.changes) {
+				t.Fatalf("expected changes %q, got %q", tt.changes, fake.changes)
+			}
+			// the values are masked once they are seen
+			if tt.masked != "" && redactor.String(tt.masked) != redactedValue {
+				t.Fatalf("the secret %q should be masked", tt.masked)
+			}
+		})
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	tests := []struct {
+		name        string
+		unavailable int
+		err         string
+	}{
+		{name: "all the runners"},
+		{name: "a runner is unavailable", unavailable: 1, err: `runner "a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.secrets["token"] = "s3cr3t-value"
+			fake.unavailable = tt.unavailable
+
+			redactor := NewRedactor(RedactConfig{})
+			runners := []RunnerConfig{{Name: "a", Address: fakeAddress}, {Name: "b", Address: fakeAddress}}
+			err := NewSecretManager(runners, runner.pool, runner.sessions, redactor).LoadSecrets(context.Background())
+			if (tt.err == "") != (err == nil) || (err != nil && !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("expected error %q, got %v", tt.err, err)
+			}
+			if calls := fake.callsOf("GetSecrets"); calls != len(runners) {
+				t.Fatalf("expected the secrets of %d runners, got %d calls", len(runners), calls)
+			}
+			if actual := redactor.String("s3cr3t-value"); actual != redactedValue {
+				t.Fatalf("the secret should be masked, got %q", actual)
+			}
+		})
+	}
+}
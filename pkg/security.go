@@ -0,0 +1,183 @@
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+var loopbackHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// IsLoopback checks if the bind address only listens on the loopback interface
+func IsLoopback(bind string) bool {
+	if bind == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(bind)
+	return ip != nil && ip.IsLoopback()
+}
+
+// allowedHosts returns the hosts which are accepted in the Host header, nil means all hosts are accepted.
+// Unless they are configured, only the loopback hosts are accepted by the loopback bind address,
+// the domain names are rejected which prevents the DNS rebinding attack.
+// The other bind addresses are reached via the domain names of the load balancers and ingresses,
+// so all hosts are accepted unless they are configured.
+func (c TransportConfig) allowedHosts() []string {
+	switch {
+	case len(c.AllowedHosts) > 0:
+		return c.AllowedHosts
+	case IsLoopback(c.Bind):
+		return c.localHosts()
+	}
+	return nil
+}
+
+// localHosts returns the loopback hosts and the addresses of the bind interface
+func (c TransportConfig) localHosts() (hosts []string) {
+	hosts = slices.Clone(loopbackHosts)
+	ip := net.ParseIP(c.Bind)
+	switch {
+	case c.Bind == "" || ip != nil && ip.IsUnspecified():
+		// all interfaces are bound
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if prefix, ok := addr.(*net.IPNet); ok {
+					hosts = append(hosts, prefix.IP.String())
+				}
+			}
+		}
+	case !slices.Contains(hosts, c.Bind):
+		hosts = append(hosts, c.Bind)
+	}
+	return
+}
+
+// NewSecurityHandler validates the Host and Origin headers, and handles the CORS requests
+func NewSecurityHandler(handler http.Handler, config TransportConfig) http.Handler {
+	allowedHosts := config.allowedHosts()
+	localHosts := config.localHosts()
+	allowedOrigins := config.CORS.AllowedOrigins
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowedHosts != nil && !matchHost(r.Host, allowedHosts) {
+			http.Error(w, fmt.Sprintf("host %q is not allowed", r.Host), http.StatusForbidden)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			if !isOriginAllowed(origin, localHosts, allowedOrigins) {
+				http.Error(w, fmt.Sprintf("origin %q is not allowed", origin), http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id, Mcp-Protocol-Version")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers",
+					"Authorization, Content-Type, Accept, Last-Event-ID, Mcp-Session-Id, Mcp-Protocol-Version")
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// isOriginAllowed accepts the configured CORS origins, and the origins of the local hosts.
+// The allowed hosts are not used here, so "*" of them does not accept all origins.
+func isOriginAllowed(origin string, localHosts, allowedOrigins []string) bool {
+	for _, item := range allowedOrigins {
+		if item == "*" || strings.EqualFold(item, origin) {
+			return true
+		}
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return matchHost(u.Host, localHosts)
+}
+
+// matchHost compares the host without the port, "*" matches all hosts
+func matchHost(host string, allowed []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	for _, item := range allowed {
+		if item == "*" || strings.EqualFold(item, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewTLSConfig loads the certificate files, or generates a self-signed certificate for local development
+func NewTLSConfig(config TLSConfig, bind string) (tlsConfig *tls.Config, err error) {
+	var cert tls.Certificate
+	if config.SelfSigned {
+		cert, err = generateSelfSignedCert(bind)
+	} else {
+		cert, err = tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	}
+	if err == nil {
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+	return
+}
+
+func generateSelfSignedCert(bind string) (cert tls.Certificate, err error) {
+	var key *ecdsa.PrivateKey
+	if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return
+	}
+
+	var serial *big.Int
+	if serial, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); err != nil {
+		return
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"atest-mcp-server self-signed"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if ip := net.ParseIP(bind); ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if bind != "" && ip == nil && bind != "localhost" {
+		template.DNSNames = append(template.DNSNames, bind)
+	}
+
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err == nil {
+		cert = tls.Certificate{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}
+	}
+	return
+}
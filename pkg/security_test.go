@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   TransportConfig
+		allowed  []string
+		rejected []string
+	}{{
+		name:     "loopback",
+		config:   TransportConfig{Bind: "127.0.0.1"},
+		allowed:  []string{"localhost", "127.0.0.1", "::1"},
+		rejected: []string{"attacker.example.com", "192.168.1.10", ""},
+	}, {
+		name:     "localhost",
+		config:   TransportConfig{Bind: "localhost"},
+		allowed:  []string{"localhost:7845", "[::1]:7845"},
+		rejected: []string{"attacker.example.com"},
+	}, {
+		name:     "configured",
+		config:   TransportConfig{Bind: "192.168.1.10", AllowedHosts: []string{"mcp.example.com"}},
+		allowed:  []string{"MCP.example.com"},
+		rejected: []string{"localhost", "192.168.1.10"},
+	}, {
+		name:    "any",
+		config:  TransportConfig{Bind: "127.0.0.1", AllowedHosts: []string{"*"}},
+		allowed: []string{"attacker.example.com"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := tt.config.allowedHosts()
+			if hosts == nil {
+				t.Fatal("the hosts should be checked")
+			}
+			for _, host := range tt.allowed {
+				if !matchHost(host, hosts) {
+					t.Errorf("host %q should be allowed by %v", host, hosts)
+				}
+			}
+			for _, host := range tt.rejected {
+				if matchHost(host, hosts) {
+					t.Errorf("host %q should be rejected by %v", host, hosts)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalHosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   TransportConfig
+		allowed  []string
+		rejected []string
+	}{{
+		name:     "all interfaces",
+		allowed:  []string{"localhost", "127.0.0.1", "::1"},
+		rejected: []string{"attacker.example.com", ""},
+	}, {
+		name:     "unspecified address",
+		config:   TransportConfig{Bind: "0.0.0.0"},
+		allowed:  []string{"localhost", "127.0.0.1"},
+		rejected: []string{"attacker.example.com"},
+	}, {
+		name:     "bind address",
+		config:   TransportConfig{Bind: "192.168.1.10"},
+		allowed:  []string{"localhost", "192.168.1.10"},
+		rejected: []string{"attacker.example.com", "192.168.1.11"},
+	}, {
+		name:     "configured hosts are not local",
+		config:   TransportConfig{Bind: "127.0.0.1", AllowedHosts: []string{"*"}},
+		allowed:  []string{"localhost"},
+		rejected: []string{"attacker.example.com"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if hosts := tt.config.allowedHosts(); !IsLoopback(tt.config.Bind) && hosts != nil {
+				t.Fatalf("all hosts should be accepted by the non-loopback bind, got %v", hosts)
+			}
+			hosts := tt.config.localHosts()
+			for _, host := range tt.allowed {
+				if !matchHost(host, hosts) {
+					t.Errorf("host %q should be local in %v", host, hosts)
+				}
+			}
+			for _, host := range tt.rejected {
+				if matchHost(host, hosts) {
+					t.Errorf("host %q should not be local in %v", host, hosts)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHandler(t *testing.T) {
+	loopback := TransportConfig{Bind: "127.0.0.1"}
+	tests := []struct {
+		name   string
+		config TransportConfig
+		method string
+		host   string
+		origin string
+		status int
+		cors   bool
+	}{
+		{name: "loopback host", config: loopback, host: "localhost:7845", status: http.StatusOK},
+		{name: "IPv6 loopback host", config: loopback, host: "[::1]:7845", status: http.StatusOK},
+		{name: "rebinding host", config: loopback, host: "attacker.example.com:7845", status: http.StatusForbidden},
+		{name: "DNS host of all interfaces", host: "mcp.example.com", status: http.StatusOK},
+		{name: "DNS host of the bind address", config: TransportConfig{Bind: "10.0.0.1"}, host: "mcp-server.default.svc:7845",
+			status: http.StatusOK},
+		{name: "not configured host", config: TransportConfig{AllowedHosts: []string{"mcp.example.com"}},
+			host: "other.example.com", status: http.StatusForbidden},
+		{name: "any host does not allow the origin", config: TransportConfig{AllowedHosts: []string{"*"}},
+			host: "mcp.example.com", origin: "http://attacker.example.com", status: http.StatusForbidden},
+		{name: "any host with the local origin", config: TransportConfig{AllowedHosts: []string{"*"}},
+			host: "localhost:7845", origin: "http://localhost:3000", status: http.StatusOK, cors: true},
+		{name: "same host origin", host: "localhost:7845", origin: "http://localhost:7845", status: http.StatusOK, cors: true},
+		{name: "foreign origin", host: "localhost:7845", origin: "http://attacker.example.com", status: http.StatusForbidden},
+		{name: "configured origin", config: TransportConfig{CORS: CORSConfig{AllowedOrigins: []string{"http://app.example.com"}}},
+			host: "localhost:7845", origin: "http://app.example.com", status: http.StatusOK, cors: true},
+		{name: "preflight", config: TransportConfig{CORS: CORSConfig{AllowedOrigins: []string{"*"}}}, method: http.MethodOptions,
+			host: "localhost:7845", origin: "http://app.example.com", status: http.StatusNoContent, cors: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewSecurityHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}), tt.config)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			request := httptest.NewRequest(method, "/mcp", nil)
+			request.Host = tt.host
+			if tt.origin != "" {
+				request.Header.Set("Origin", tt.origin)
+			}
+			if method == http.MethodOptions {
+				request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, recorder.Code, recorder.Body)
+			}
+			if cors := tt.origin != "" && recorder.Header().Get("Access-Control-Allow-Origin") == tt.origin; cors != tt.cors {
+				t.Fatalf("expected CORS %v, got headers %v", tt.cors, recorder.Header())
+			}
+		})
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for bind, expected := range map[string]bool{
+		"localhost": true, "127.0.0.1": true, "::1": true, "": false, "0.0.0.0": false, "192.168.1.10": false,
+	} {
+		if IsLoopback(bind) != expected {
+			t.Errorf("expected IsLoopback(%q) to be %v", bind, expected)
+		}
+	}
+	if !slices.Contains(TransportConfig{Bind: "127.0.0.1"}.allowedHosts(), "localhost") {
+		t.Fatal("the loopback hosts should be allowed by default")
+	}
+}
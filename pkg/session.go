@@ -0,0 +1,229 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"sync"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+// SessionState holds the defaults of the tool calls in a MCP session
+type SessionState struct {
+	Suite   string            `json:"suite,omitempty" jsonschema:"the active test suite"`
+	Runner  string            `json:"runner,omitempty" jsonschema:"the name of the active runner"`
+	Store   string            `json:"store,omitempty" jsonschema:"the store of the test suites, the local store of the runner is used if it is empty"`
+	API     string            `json:"api,omitempty" jsonschema:"the base API of the test suite"`
+	Headers map[string]string `json:"headers,omitempty" jsonschema:"the default HTTP request headers of the new test cases"`
+}
+
+// SessionStore keeps the state of the MCP sessions, the state is dropped once the session is gone
+type SessionStore interface {
+	Get(session *mcp.ServerSession) SessionState
+	Set(session *mcp.ServerSession, state SessionState)
+	// ID identifies the session, the transports without session ID such as stdio and SSE get a generated one
+	ID(session *mcp.ServerSession) string
+}
+
+// the states are keyed by the session itself, the session ID is empty for stdio and SSE
+type sessionStore struct {
+	mu       sync.RWMutex
+	states   map[*mcp.ServerSession]SessionState
+	ids      map[*mcp.ServerSession]string
+	next     int
+	sessions func() iter.Seq[*mcp.ServerSession]
+}
+
+// NewSessionStore creates a store, the sessions function returns the alive sessions
+func NewSessionStore(sessions func() iter.Seq[*mcp.ServerSession]) SessionStore {
+	return &sessionStore{
+		states:   map[*mcp.ServerSession]SessionState{},
+		ids:      map[*mcp.ServerSession]string{},
+		sessions: sessions,
+	}
+}
+
+func (s *sessionStore) Get(session *mcp.ServerSession) SessionState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.states[session]
+}
+
+func (s *sessionStore) Set(session *mcp.ServerSession, state SessionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[session] = state
+	s.prune()
+}
+
+func (s *sessionStore) ID(session *mcp.ServerSession) string {
+	if session == nil {
+		return ""
+	}
+	if id := session.ID(); id != "" {
+		return id
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.ids[session]
+	if !ok {
+		s.next++
+		id = fmt.Sprintf("local-%d", s.next)
+		s.ids[session] = id
+		s.prune()
+	}
+	return id
+}
+
+// prune drops the gone sessions, the state without session is kept
+func (s *sessionStore) prune() {
+	if s.sessions == nil {
+		return
+	}
+	alive := map[*mcp.ServerSession]bool{nil: true}
+	for item := range s.sessions() {
+		alive[item] = true
+	}
+	for session := range s.states {
+		if !alive[session] {
+			delete(s.states, session)
+		}
+	}
+	for session := range s.ids {
+		if !alive[session] {
+			delete(s.ids, session)
+		}
+	}
+}
+
+// sessionOf returns the session of the tool call
+func sessionOf(request *mcp.CallToolRequest) *mcp.ServerSession {
+	if request == nil {
+		return nil
+	}
+	return request.Session
+}
+
+type UseSuiteRequest struct {
+	Suite   string            `json:"suite" jsonschema:"the name of test suite to use in the following tool calls"`
+	Runner  string            `json:"runner,omitempty" jsonschema:"the name of the runner, the default runner is used if it's empty"`
+	Store   string            `json:"store,omitempty" jsonschema:"the store of the test suite, the store of the session is kept if it's empty"`
+	API     string            `json:"api,omitempty" jsonschema:"the base API, such as http://localhost:8080/"`
+	Headers map[string]string `json:"headers,omitempty" jsonschema:"the default HTTP request headers of the new test cases"`
+}
+
+type SessionInfo struct {
+	SessionID string            `json:"sessionID"`
+	State     SessionState      `json:"state"`
+	Runners   map[string]string `json:"runners"`
+}
+
+// SessionManager provides the tools to manage the session-scoped defaults
+type SessionManager interface {
+	UseSuite(ctx context.Context, request *mcp.CallToolRequest, args UseSuiteRequest) (
+		result *mcp.CallToolResult, state SessionState, err error)
+	SessionInfo(ctx context.Context, request *mcp.CallToolRequest, args any) (
+		result *mcp.CallToolResult, info SessionInfo, err error)
+}
+
+type sessionManager struct {
+	runners  []RunnerConfig
+	pool     ConnectionPool
+	sessions SessionStore
+}
+
+func NewSessionManager(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore) SessionManager {
+	return &sessionManager{
+		runners:  runners,
+		pool:     pool,
+		sessions: sessions,
+	}
+}
+
+func (m *sessionManager) UseSuite(ctx context.Context, request *mcp.CallToolRequest, args UseSuiteRequest) (
+	result *mcp.CallToolResult, state SessionState, err error) {
+	address, ok := runnerAddress(m.runners, args.Runner)
+	if !ok {
+		err = fmt.Errorf("runner %q is not found", args.Runner)
+		return
+	}
+
+	store := args.Store
+	if store == "" {
+		store = m.sessions.Get(sessionOf(request)).Store
+	} else if store == localStore {
+		store = ""
+	}
+
+	// make sure the suite exists in the runner
+	var conn *grpc.ClientConn
+	if conn, err = m.pool.Get(address); err == nil {
+		var suite *server.TestSuite
+		if suite, err = server.NewRunnerClient(withStore(conn, store)).GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Suite}); err != nil {
+			err = fmt.Errorf("failed to get test suite %q: %w", args.Suite, err)
+			return
+		}
+
+		state = SessionState{
+			Suite:   args.Suite,
+			Runner:  args.Runner,
+			Store:   store,
+			API:     args.API,
+			Headers: args.Headers,
+		}
+		if state.API == "" {
+			state.API = suite.Api
+		}
+		m.sessions.Set(sessionOf(request), state)
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: fmt.Sprintf("using test suite %q, it's the default suite of the following tool calls", args.Suite)},
+			},
+		}
+	}
+	return
+}
+
+func (m *sessionManager) SessionInfo(ctx context.Context, request *mcp.CallToolRequest, args any) (
+	result *mcp.CallToolResult, info SessionInfo, err error) {
+	session := sessionOf(request)
+	info = SessionInfo{
+		SessionID: m.sessions.ID(session),
+		State:     m.sessions.Get(session),
+		Runners:   map[string]string{},
+	}
+	for _, runner := range m.runners {
+		info.Runners[runner.Name] = runner.Address
+	}
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: objectToJSON(info)},
+		},
+	}
+	return
+}
+
+// runnerAddress finds the address of the runner by name, the first runner is the default one
+func runnerAddress(runners []RunnerConfig, name string) (address string, ok bool) {
+	for i, runner := range runners {
+		if (name == "" && i == 0) || runner.Name == name {
+			return runner.Address, true
+		}
+	}
+	return
+}
+
+// mergeHeaders returns the default headers overridden by the given headers
+func mergeHeaders(defaults, headers map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return headers
+	}
+	merged := maps.Clone(defaults)
+	maps.Copy(merged, headers)
+	return merged
+}
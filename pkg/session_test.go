@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectSession connects a client to the server in memory
+func connectSession(t *testing.T, s *mcp.Server, options *mcp.ClientOptions) (*mcp.ServerSession, *mcp.ClientSession) {
+	t.Helper()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	serverSession, err := s.Connect(context.Background(), serverTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSession, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, options).Connect(context.Background(), clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = clientSession.Close()
+	})
+	return serverSession, clientSession
+}
+
+func TestSessionStore(t *testing.T) {
+	s := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	first, _ := connectSession(t, s, nil)
+	second, secondClient := connectSession(t, s, nil)
+	store := NewSessionStore(s.Sessions)
+
+	// the in-memory sessions have no ID, just like stdio and SSE
+	if first.ID() != "" {
+		t.Fatalf("expected an empty session ID, got %q", first.ID())
+	}
+	store.Set(first, SessionState{Suite: "first"})
+	store.Set(second, SessionState{Suite: "second"})
+	store.Set(nil, SessionState{Suite: "none"})
+
+	tests := []struct {
+		name    string
+		session *mcp.ServerSession
+		suite   string
+	}{
+		{name: "first", session: first, suite: "first"},
+		{name: "second", session: second, suite: "second"},
+		{name: "no session", session: nil, suite: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if suite := store.Get(tt.session).Suite; suite != tt.suite {
+				t.Fatalf("expected %q, got %q", tt.suite, suite)
+			}
+		})
+	}
+
+	firstID, secondID := store.ID(first), store.ID(second)
+	if firstID == "" || firstID == secondID || store.ID(first) != firstID {
+		t.Fatalf("expected stable and distinct IDs, got %q and %q", firstID, secondID)
+	}
+	if id := store.ID(nil); id != "" {
+		t.Fatalf("expected no ID without session, got %q", id)
+	}
+
+	// the state of the gone session is dropped
+	_ = secondClient.Close()
+	_ = second.Wait()
+	store.Set(first, SessionState{Suite: "updated"})
+	if state := store.Get(second); state.Suite != "" {
+		t.Fatalf("expected the state to be dropped, got %+v", state)
+	}
+	if state := store.Get(nil); state.Suite != "none" {
+		t.Fatalf("expected the state without session to be kept, got %+v", state)
+	}
+}
+
+func TestRunUsesSessionSuite(t *testing.T) {
+	fake, runner := newFakeRunner(t)
+	fake.addSuite(&server.TestSuite{Name: "sample"})
+
+	if _, _, err := runner.Run(context.Background(), nil, RunRequest{CaseName: "get"}); err == nil {
+		t.Fatal("expected an error without suite")
+	}
+
+	runner.sessions.Set(nil, SessionState{Suite: "sample"})
+	if _, _, err := runner.Run(context.Background(), nil, RunRequest{CaseName: "get"}); err != nil {
+		t.Fatal(err)
+	}
+	task := fake.tasks[len(fake.tasks)-1]
+	if task.Kind != "testcaseInSuite" || task.CaseName != "get" || task.Data != "name: sample" {
+		t.Fatalf("unexpected task %v", task)
+	}
+}
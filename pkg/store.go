@@ -0,0 +1,494 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	runsBucket          = "runs"
+	defaultRunsLimit    = 20
+	maxExportLimit      = 1000
+	runRequestTimeout   = 3 * time.Second
+	runStatusPassed     = "passed"
+	runStatusFailed     = "failed"
+	runsExportURI       = "atest-mcp://runs.jsonl"
+	runsExportMediaType = "application/jsonl"
+)
+
+// RunRecord is a run made through the MCP server
+type RunRecord struct {
+	ID         string          `json:"id"`
+	Time       time.Time       `json:"time"`
+	Tool       string          `json:"tool"`
+	Session    string          `json:"session,omitempty"`
+	Runner     string          `json:"runner,omitempty"`
+	Suite      string          `json:"suite,omitempty"`
+	Case       string          `json:"case,omitempty"`
+	Status     string          `json:"status"`
+	StatusCode int             `json:"statusCode,omitempty"`
+	Duration   time.Duration   `json:"duration"`
+	Args       json.RawMessage `json:"args,omitempty"`
+	Request    *server.Request `json:"request,omitempty"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Output     string          `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// RunQuery filters the run records, the empty fields match all
+type RunQuery struct {
+	Suite    string `json:"suite,omitempty" jsonschema:"the name of test suite"`
+	Testcase string `json:"testcase,omitempty" jsonschema:"the name of test case"`
+	Tool     string `json:"tool,omitempty" jsonschema:"the tool which made the run, such as run or run-test-case"`
+	Session  string `json:"session,omitempty" jsonschema:"the MCP session ID of the caller"`
+	Status   string `json:"status,omitempty" jsonschema:"passed or failed"`
+	Since    string `json:"since,omitempty" jsonschema:"only the runs in this period, such as 30m or 24h"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"the max number of the latest records, default is 20, or 1000 when exporting which is also the max of exporting"`
+}
+
+// RunStore keeps the runs made through the MCP server in an embedded bbolt file
+type RunStore interface {
+	Record(record *RunRecord) error
+	Get(id string) (*RunRecord, error)
+	// Query returns the matched records, the latest one comes first
+	Query(query RunQuery, limit int) ([]RunRecord, error)
+	Close() error
+}
+
+type boltRunStore struct {
+	db     *bolt.DB
+	config StoreConfig
+}
+
+// NewRunStore opens the store file, it's created if not exists
+func NewRunStore(config StoreConfig) (store RunStore, err error) {
+	path := config.Path
+	if path == "" {
+		if path, err = DefaultStorePath(); err != nil {
+			return
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return
+	}
+
+	var db *bolt.DB
+	// the file is locked by another process if it doesn't open in time
+	if db, err = bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second}); err != nil {
+		err = fmt.Errorf("failed to open the run store %q: %w", path, err)
+		return
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(runsBucket))
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return
+	}
+	store = &boltRunStore{db: db, config: config}
+	return
+}
+
+// DefaultStorePath is the store file in the user config directory
+func DefaultStorePath() (path string, err error) {
+	var dir string
+	if dir, err = os.UserConfigDir(); err == nil {
+		path = filepath.Join(dir, "atest-mcp-server", "runs.db")
+	}
+	return
+}
+
+// Record saves the record, and drops the records which are out of the retention limits
+func (s *boltRunStore) Record(record *RunRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket([]byte(runsBucket))
+
+		var seq uint64
+		if seq, err = bucket.NextSequence(); err != nil {
+			return
+		}
+		record.ID = strconv.FormatUint(seq, 10)
+
+		var data []byte
+		if data, err = json.Marshal(record); err != nil {
+			return
+		}
+		if err = bucket.Put(runKey(seq), data); err != nil {
+			return
+		}
+		return s.prune(bucket, seq)
+	})
+}
+
+// prune drops the oldest records. The keys are the sequences in the order of the time, and only the oldest ones are dropped,
+// so the number of the records is told by the first and the last keys without counting them.
+func (s *boltRunStore) prune(bucket *bolt.Bucket, last uint64) (err error) {
+	var expired time.Time
+	if s.config.MaxAge > 0 {
+		expired = time.Now().Add(-s.config.MaxAge)
+	}
+
+	cursor := bucket.Cursor()
+	key, value := cursor.First()
+	excess := 0
+	if s.config.MaxRecords > 0 && key != nil {
+		excess = int(last-binary.BigEndian.Uint64(key)+1) - s.config.MaxRecords
+	}
+
+	// the cursor skips items if deleting during the iteration
+	var keys [][]byte
+	for ; key != nil; key, value = cursor.Next() {
+		if excess <= 0 {
+			var record RunRecord
+			if expired.IsZero() || json.Unmarshal(value, &record) != nil || !record.Time.Before(expired) {
+				break
+			}
+		}
+		keys = append(keys, key)
+		excess--
+	}
+	for _, key := range keys {
+		if err = bucket.Delete(key); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *boltRunStore) Get(id string) (record *RunRecord, err error) {
+	var seq uint64
+	if seq, err = strconv.ParseUint(id, 10, 64); err != nil {
+		err = fmt.Errorf("invalid run record ID %q", id)
+		return
+	}
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(runsBucket)).Get(runKey(seq))
+		if data == nil {
+			return fmt.Errorf("run record %q is not found", id)
+		}
+		record = &RunRecord{}
+		return json.Unmarshal(data, record)
+	})
+	return
+}
+
+func (s *boltRunStore) Query(query RunQuery, limit int) (records []RunRecord, err error) {
+	var since time.Time
+	if query.Since != "" {
+		var period time.Duration
+		if period, err = time.ParseDuration(query.Since); err != nil {
+			err = fmt.Errorf("since: %q is not a duration", query.Since)
+			return
+		}
+		since = time.Now().Add(-period)
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket([]byte(runsBucket)).Cursor()
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			var record RunRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			if !since.IsZero() && record.Time.Before(since) {
+				break
+			}
+			if query.match(record) {
+				records = append(records, record)
+				if limit > 0 && len(records) >= limit {
+					break
+				}
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (s *boltRunStore) Close() error {
+	return s.db.Close()
+}
+
+func (q RunQuery) match(record RunRecord) bool {
+	return (q.Suite == "" || q.Suite == record.Suite) &&
+		(q.Testcase == "" || q.Testcase == record.Case) &&
+		(q.Tool == "" || q.Tool == record.Tool) &&
+		(q.Session == "" || q.Session == record.Session) &&
+		(q.Status == "" || q.Status == record.Status)
+}
+
+func runKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// RunRecorder records the runs into the store
+type RunRecorder struct {
+	store    RunStore
+	runners  []RunnerConfig
+	pool     ConnectionPool
+	sessions SessionStore
+	redactor *Redactor
+}
+
+func NewRunRecorder(store RunStore, runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, redactor *Redactor) *RunRecorder {
+	return &RunRecorder{
+		store:    store,
+		runners:  runners,
+		pool:     pool,
+		sessions: sessions,
+		redactor: redactor,
+	}
+}
+
+// RecordRun wraps the tool handler to record every call of it
+func RecordRun[In, Out any](recorder *RunRecorder, tool string, handler mcp.ToolHandlerFor[In, Out]) mcp.ToolHandlerFor[In, Out] {
+	return func(ctx context.Context, request *mcp.CallToolRequest, args In) (result *mcp.CallToolResult, out Out, err error) {
+		start := time.Now()
+		result, out, err = handler(ctx, request, args)
+		recorder.record(ctx, request, tool, args, out, result, err, time.Since(start))
+		return
+	}
+}
+
+func (r *RunRecorder) record(ctx context.Context, request *mcp.CallToolRequest, tool string, args, out any,
+	result *mcp.CallToolResult, err error, duration time.Duration) {
+	session := sessionOf(request)
+	state := r.sessions.Get(session)
+	record := &RunRecord{
+		Time:     time.Now().Add(-duration),
+		Tool:     tool,
+		Session:  r.sessions.ID(session),
+		Runner:   state.Runner,
+		Duration: duration,
+		Status:   runStatusPassed,
+	}
+
+	if data, marshalErr := json.Marshal(args); marshalErr == nil {
+		record.Args = data
+		var names struct {
+			Suite     string `json:"suite"`
+			SuiteName string `json:"suiteName"`
+			Testcase  string `json:"testcase"`
+			CaseName  string `json:"caseName"`
+		}
+		_ = json.Unmarshal(data, &names)
+		record.Suite = firstNonEmpty(names.Suite, names.SuiteName, state.Suite)
+		record.Case = firstNonEmpty(names.Testcase, names.CaseName)
+	}
+
+	if out != nil {
+		if data, marshalErr := json.Marshal(out); marshalErr == nil && !bytes.Equal(data, []byte("null")) {
+			record.Response = data
+			if record.Error, record.StatusCode = resultError(data); record.Error != "" {
+				record.Status = runStatusFailed
+			}
+		}
+	}
+	if result != nil {
+		var texts []string
+		for _, content := range result.Content {
+			if text, ok := content.(*mcp.TextContent); ok {
+				texts = append(texts, text.Text)
+			}
+		}
+		record.Output = strings.Join(texts, "\n")
+		if result.IsError {
+			record.Status = runStatusFailed
+		}
+	}
+	if err != nil {
+		record.Status, record.Error = runStatusFailed, err.Error()
+	}
+
+	// the recording should not be affected by the cancellation of the tool call
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), runRequestTimeout)
+	defer cancel()
+	if record.Suite != "" && record.Case != "" {
+		record.Request = r.testCaseRequest(recordCtx, state, record.Suite, record.Case)
+	}
+	if recordErr := r.store.Record(r.redact(record)); recordErr != nil {
+		LoggerFrom(ctx).WarnContext(ctx, "failed to record the run", "error", recordErr)
+	}
+}
+
+// redact masks the credentials before persisting, the raw data is dropped if it can't be masked.
+// The texts are masked on their own since the header lines are not matched once they are encoded in JSON.
+func (r *RunRecorder) redact(record *RunRecord) *RunRecord {
+	record.Output, record.Error = r.redactor.String(record.Output), r.redactor.String(record.Error)
+	if redacted := RedactValue(r.redactor, record); redacted != nil {
+		return redacted
+	}
+	record.Args, record.Request, record.Response = nil, nil, nil
+	return record
+}
+
+// testCaseRequest gets the request of the test case, it's best effort
+func (r *RunRecorder) testCaseRequest(ctx context.Context, state SessionState, suite, name string) (req *server.Request) {
+	if address, ok := runnerAddress(r.runners, state.Runner); ok {
+		if conn, err := r.pool.Get(address); err == nil {
+			var testCase *server.TestCase
+			if testCase, err = server.NewRunnerClient(withStore(conn, state.Store)).GetTestCase(ctx, &server.TestCaseIdentity{Suite: suite, Testcase: name}); err == nil {
+				req = testCase.Request
+			}
+		}
+	}
+	return
+}
+
+// resultError finds the error and the status code from the test case results
+func resultError(data []byte) (errMsg string, statusCode int) {
+	type caseResult struct {
+		StatusCode int    `json:"statusCode"`
+		Error      string `json:"error"`
+	}
+	var results []caseResult
+	var single caseResult
+	if json.Unmarshal(data, &results) != nil {
+		if json.Unmarshal(data, &single) != nil {
+			return
+		}
+		results = append(results, single)
+	}
+	for _, item := range results {
+		if item.StatusCode != 0 {
+			statusCode = item.StatusCode
+		}
+		if errMsg == "" {
+			errMsg = item.Error
+		}
+	}
+	return
+}
+
+func firstNonEmpty(items ...string) string {
+	for _, item := range items {
+		if item != "" {
+			return item
+		}
+	}
+	return ""
+}
+
+type RunRecordRequest struct {
+	ID string `json:"id" jsonschema:"the ID of the run record"`
+}
+
+type RunRecords struct {
+	Records []RunRecord `json:"records"`
+}
+
+// RunRecordManager provides the tools to query and export the run records
+type RunRecordManager interface {
+	QueryRuns(ctx context.Context, request *mcp.CallToolRequest, args RunQuery) (
+		result *mcp.CallToolResult, data RunRecords, err error)
+	GetRunRecord(ctx context.Context, request *mcp.CallToolRequest, args RunRecordRequest) (
+		result *mcp.CallToolResult, data RunRecord, err error)
+	ExportRuns(ctx context.Context, request *mcp.CallToolRequest, args RunQuery) (
+		result *mcp.CallToolResult, a any, err error)
+}
+
+type runRecordManager struct {
+	store RunStore
+}
+
+func NewRunRecordManager(store RunStore) RunRecordManager {
+	return &runRecordManager{store: store}
+}
+
+func (m *runRecordManager) QueryRuns(ctx context.Context, request *mcp.CallToolRequest, args RunQuery) (
+	result *mcp.CallToolResult, data RunRecords, err error) {
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultRunsLimit
+	}
+	if data.Records, err = m.store.Query(args, limit); err == nil {
+		// the details are available via get-run-record
+		for i := range data.Records {
+			data.Records[i].Args = nil
+			data.Records[i].Request = nil
+			data.Records[i].Response = nil
+			data.Records[i].Output = ""
+		}
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: data.Table()},
+			},
+		}
+	}
+	return
+}
+
+func (m *runRecordManager) GetRunRecord(ctx context.Context, request *mcp.CallToolRequest, args RunRecordRequest) (
+	result *mcp.CallToolResult, data RunRecord, err error) {
+	var record *RunRecord
+	if record, err = m.store.Get(args.ID); err == nil {
+		data = *record
+		result = &mcp.CallToolResult{
+			Content: []mcp.Content{
+				&mcp.TextContent{Text: objectToJSON(data)},
+			},
+		}
+	}
+	return
+}
+
+// ExportRuns returns the matched records as JSON Lines, the oldest one comes first
+func (m *runRecordManager) ExportRuns(ctx context.Context, request *mcp.CallToolRequest, args RunQuery) (
+	result *mcp.CallToolResult, a any, err error) {
+	limit := args.Limit
+	if limit <= 0 || limit > maxExportLimit {
+		limit = maxExportLimit
+	}
+
+	var records []RunRecord
+	if records, err = m.store.Query(args, limit); err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := len(records) - 1; i >= 0; i-- {
+		if err = encoder.Encode(records[i]); err != nil {
+			return
+		}
+	}
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("exported %d run records", len(records))},
+			&mcp.EmbeddedResource{
+				Resource: &mcp.ResourceContents{
+					URI:      runsExportURI,
+					MIMEType: runsExportMediaType,
+					Text:     buf.String(),
+				},
+			},
+		},
+	}
+	return
+}
+
+// Table renders the records as a Markdown table
+func (r RunRecords) Table() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d runs\n\n| ID | Time | Tool | Suite | Case | Status | Code | Duration | Error |\n|---|---|---|---|---|---|---|---|---|\n", len(r.Records))
+	for _, record := range r.Records {
+		fmt.Fprintf(&buf, "| %s | %s | %s | %s | %s | %s | %d | %s | %s |\n", record.ID, record.Time.Format(time.RFC3339),
+			record.Tool, record.Suite, record.Case, record.Status, record.StatusCode, record.Duration.Round(time.Millisecond),
+			strings.ReplaceAll(record.Error, "|", "\\|"))
+	}
+	return buf.String()
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestRunStorePrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		config StoreConfig
+		// ages are the ages of the records in the order of recording
+		ages     []time.Duration
+		expected []string
+	}{{
+		name:     "unlimited",
+		ages:     []time.Duration{0, 0, 0},
+		expected: []string{"3", "2", "1"},
+	}, {
+		name:     "max records",
+		config:   StoreConfig{MaxRecords: 2},
+		ages:     []time.Duration{0, 0, 0, 0, 0},
+		expected: []string{"5", "4"},
+	}, {
+		name:     "max records includes the new one",
+		config:   StoreConfig{MaxRecords: 1},
+		ages:     []time.Duration{0, 0},
+		expected: []string{"2"},
+	}, {
+		name:     "max age",
+		config:   StoreConfig{MaxAge: time.Hour},
+		ages:     []time.Duration{3 * time.Hour, 2 * time.Hour, 0, 0},
+		expected: []string{"4", "3"},
+	}, {
+		name:     "max records and age",
+		config:   StoreConfig{MaxRecords: 3, MaxAge: time.Hour},
+		ages:     []time.Duration{2 * time.Hour, 0, 0, 0, 0},
+		expected: []string{"5", "4", "3"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Path = filepath.Join(t.TempDir(), "runs.db")
+			store, err := NewRunStore(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			for i, age := range tt.ages {
+				record := &RunRecord{Time: now.Add(-age), Tool: "run", Case: strconv.Itoa(i)}
+				if err = store.Record(record); err != nil {
+					t.Fatal(err)
+				}
+				if record.ID != strconv.Itoa(i+1) {
+					t.Fatalf("expected ID %d, got %q", i+1, record.ID)
+				}
+			}
+
+			records, err := store.Query(RunQuery{}, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.ID)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestRunStoreQuery(t *testing.T) {
+	store, err := NewRunStore(StoreConfig{Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now()
+	for _, record := range []*RunRecord{
+		{Time: now.Add(-2 * time.Hour), Tool: "run", Suite: "sample", Case: "a", Status: runStatusPassed},
+		{Time: now.Add(-time.Minute), Tool: "run", Suite: "sample", Case: "b", Status: runStatusFailed, Session: "s1"},
+		{Time: now, Tool: "run-test-suite", Suite: "other", Status: runStatusPassed, Session: "s2"},
+	} {
+		if err = store.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    RunQuery
+		limit    int
+		expected []string
+		err      bool
+	}{
+		{name: "all", expected: []string{"3", "2", "1"}},
+		{name: "limit", limit: 2, expected: []string{"3", "2"}},
+		{name: "suite", query: RunQuery{Suite: "sample"}, expected: []string{"2", "1"}},
+		{name: "testcase", query: RunQuery{Suite: "sample", Testcase: "a"}, expected: []string{"1"}},
+		{name: "tool", query: RunQuery{Tool: "run-test-suite"}, expected: []string{"3"}},
+		{name: "session", query: RunQuery{Session: "s1"}, expected: []string{"2"}},
+		{name: "status", query: RunQuery{Status: runStatusPassed}, expected: []string{"3", "1"}},
+		{name: "since", query: RunQuery{Since: "1h"}, expected: []string{"3", "2"}},
+		{name: "invalid since", query: RunQuery{Since: "yesterday"}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := store.Query(tt.query, tt.limit)
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.ID)
+			}
+			if !slices.Equal(ids, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+
+	if record, err := store.Get("2"); err != nil || record.Case != "b" {
+		t.Fatalf("unexpected record %v: %v", record, err)
+	}
+	for _, id := range []string{"4", "abc"} {
+		if _, err := store.Get(id); err == nil {
+			t.Fatalf("expected an error of record %q", id)
+		}
+	}
+}
+
+// limitRunStore records the limit of the queries
+type limitRunStore struct {
+	RunStore
+	limits []int
+}
+
+func (s *limitRunStore) Query(query RunQuery, limit int) ([]RunRecord, error) {
+	s.limits = append(s.limits, limit)
+	return []RunRecord{{ID: "2"}, {ID: "1"}}, nil
+}
+
+func TestExportRunsLimit(t *testing.T) {
+	store := &limitRunStore{}
+	manager := NewRunRecordManager(store)
+	for _, limit := range []int{0, -1, 10, maxExportLimit, maxExportLimit + 1} {
+		result, _, err := manager.ExportRuns(context.Background(), nil, RunQuery{Limit: limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text := result.Content[1].(*mcp.EmbeddedResource).Resource.Text; !strings.HasPrefix(text, `{"id":"1",`) || strings.Count(text, "\n") != 2 {
+			t.Fatalf("unexpected export %q, the oldest one should come first", text)
+		}
+	}
+	if expected := []int{maxExportLimit, maxExportLimit, 10, maxExportLimit, maxExportLimit}; !slices.Equal(store.limits, expected) {
+		t.Fatalf("expected limits %v, got %v", expected, store.limits)
+	}
+}
@@ -0,0 +1,272 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const maxSuggestedVerify = 10
+
+// stableHeaders are the response headers which don't change between runs
+var stableHeaders = []string{"Content-Type", "Content-Encoding", "Content-Language", "Content-Disposition",
+	"Cache-Control", "Access-Control-Allow-Origin", "X-Content-Type-Options"}
+
+var (
+	uuidPattern      = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}`)
+	tokenPattern     = regexp.MustCompile(`^[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}$`)
+	identPattern     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type SuggestAssertionsRequest struct {
+	Suite    string          `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase string          `json:"testcase" jsonschema:"the name of test case"`
+	Response *SampleResponse `json:"response,omitempty" jsonschema:"the response to learn from, the test case is executed if it is empty"`
+	Apply    bool            `json:"apply,omitempty" jsonschema:"apply the suggestions to the test case, the existing expectations are kept"`
+}
+
+// SampleResponse is a response given by the caller
+type SampleResponse struct {
+	StatusCode int32             `json:"statusCode" jsonschema:"the HTTP status code"`
+	Headers    map[string]string `json:"headers,omitempty" jsonschema:"the HTTP response headers"`
+	Body       string            `json:"body,omitempty" jsonschema:"the HTTP response body"`
+}
+
+// AssertionSuggestion is the proposed expectations of a test case
+type AssertionSuggestion struct {
+	Suite         string            `json:"suite"`
+	Case          string            `json:"case"`
+	ExpectStatus  int32             `json:"expectStatus"`
+	ExpectHeaders map[string]string `json:"expectHeaders,omitempty"`
+	ExpectSchema  string            `json:"expectSchema,omitempty"`
+	ExpectVerify  []string          `json:"expectVerify,omitempty"`
+	Applied       bool              `json:"applied"`
+	Kept          []string          `json:"kept,omitempty"`
+}
+
+// AssertionSuggester proposes the assertions from a live response
+type AssertionSuggester interface {
+	SuggestAssertions(ctx context.Context, request *mcp.CallToolRequest, args SuggestAssertionsRequest) (
+		result *mcp.CallToolResult, data AssertionSuggestion, err error)
+}
+
+type assertionSuggester struct {
+	*gRPCRunner
+	config DiffConfig
+}
+
+// NewAssertionSuggester creates the suggester, the volatile fields of the diff config are excluded from the suggestions
+func NewAssertionSuggester(runners []RunnerConfig, pool ConnectionPool, sessions SessionStore, config DiffConfig) AssertionSuggester {
+	return &assertionSuggester{
+		gRPCRunner: &gRPCRunner{
+			runners:  runners,
+			pool:     pool,
+			sessions: sessions,
+		},
+		config: config,
+	}
+}
+
+func (s *assertionSuggester) SuggestAssertions(ctx context.Context, request *mcp.CallToolRequest, args SuggestAssertionsRequest) (
+	result *mcp.CallToolResult, data AssertionSuggestion, err error) {
+	if args.Suite == "" {
+		args.Suite = s.session(request).Suite
+	}
+	if args.Suite == "" || args.Testcase == "" {
+		err = errors.New("suite and testcase are required")
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = s.getConnection(request); err != nil {
+		return
+	}
+	runner := server.NewRunnerClient(conn)
+
+	response := args.Response
+	if response == nil {
+		var reply *server.TestCaseResult
+		if reply, err = runner.RunTestCase(ctx, &server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase}); err != nil {
+			return
+		}
+		if reply.StatusCode == 0 {
+			err = fmt.Errorf("no response of test case %q: %s", args.Testcase, reply.Error)
+			return
+		}
+		response = &SampleResponse{
+			StatusCode: reply.StatusCode,
+			Headers:    pairsToMap(reply.Header),
+			Body:       reply.Body,
+		}
+	}
+
+	data = suggestAssertions(response, newDiffIgnore(s.config.IgnoreFields, s.config.IgnoreHeaders))
+	data.Suite, data.Case = args.Suite, args.Testcase
+
+	if args.Apply {
+		var testCase *server.TestCase
+		if testCase, err = runner.GetTestCase(ctx, &server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase}); err != nil {
+			return
+		}
+		data.Kept = data.mergeInto(testCase)
+		testCase.SuiteName = args.Suite
+		if err = replyError(runner.UpdateTestCase(ctx, &server.TestCaseWithSuite{SuiteName: args.Suite, Data: testCase})); err != nil {
+			return
+		}
+		data.Applied = true
+	}
+
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.String()},
+		},
+	}
+	return
+}
+
+func suggestAssertions(response *SampleResponse, ignore diffIgnore) (data AssertionSuggestion) {
+	data.ExpectStatus = response.StatusCode
+
+	for key, value := range response.Headers {
+		key = http.CanonicalHeaderKey(key)
+		if slices.Contains(stableHeaders, key) && !ignore.headers[key] {
+			if data.ExpectHeaders == nil {
+				data.ExpectHeaders = map[string]string{}
+			}
+			data.ExpectHeaders[key] = value
+		}
+	}
+
+	body, err := decodeJSON(response.Body)
+	if err != nil || response.Body == "" {
+		return
+	}
+	if schema, err := json.Marshal(InferSchema(body)); err == nil {
+		data.ExpectSchema = string(schema)
+	}
+	suggestVerify("data", "", "", body, ignore, &data.ExpectVerify)
+	return
+}
+
+// suggestVerify proposes the verify expressions of the top fields, the volatile values are excluded
+func suggestVerify(expr, path, key string, value any, ignore diffIgnore, verify *[]string) {
+	if len(*verify) >= maxSuggestedVerify || (path != "" && ignore.match(path, key)) {
+		return
+	}
+
+	switch val := value.(type) {
+	case map[string]any:
+		// the nested objects are covered by the schema
+		if strings.Count(path, ".") >= 1 {
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			suggestVerify(fieldExpr(expr, k), joinPath(path, k), k, val[k], ignore, verify)
+		}
+	case []any:
+		if len(val) > 0 {
+			*verify = append(*verify, fmt.Sprintf("len(%s) > 0", expr))
+		}
+	case string:
+		if val != "" && !isVolatileValue(val) && len(val) <= 100 {
+			*verify = append(*verify, fmt.Sprintf("%s == %s", expr, strconv.Quote(val)))
+		}
+	case json.Number, bool:
+		*verify = append(*verify, fmt.Sprintf("%s == %v", expr, val))
+	}
+}
+
+func fieldExpr(expr, key string) string {
+	if identPattern.MatchString(key) {
+		return expr + "." + key
+	}
+	return fmt.Sprintf("%s[%s]", expr, strconv.Quote(key))
+}
+
+// isVolatileValue checks if the value looks like a generated one, such as UUID, timestamp or token
+func isVolatileValue(value string) bool {
+	return uuidPattern.MatchString(value) || timestampPattern.MatchString(value) || tokenPattern.MatchString(value)
+}
+
+// mergeInto applies the suggestions to the test case without overwriting the existing expectations,
+// it returns the kept ones
+func (a AssertionSuggestion) mergeInto(testCase *server.TestCase) (kept []string) {
+	if testCase.Response == nil {
+		testCase.Response = &server.Response{}
+	}
+	expect := testCase.Response
+
+	if expect.StatusCode == 0 {
+		expect.StatusCode = a.ExpectStatus
+	} else if expect.StatusCode != a.ExpectStatus {
+		kept = append(kept, fmt.Sprintf("expectStatus %d", expect.StatusCode))
+	}
+
+	keys := make([]string, 0, len(a.ExpectHeaders))
+	for key := range a.ExpectHeaders {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		index := slices.IndexFunc(expect.Header, func(pair *server.Pair) bool {
+			return strings.EqualFold(pair.Key, key)
+		})
+		if index < 0 {
+			expect.Header = append(expect.Header, &server.Pair{Key: key, Value: a.ExpectHeaders[key]})
+		} else if expect.Header[index].Value != a.ExpectHeaders[key] {
+			kept = append(kept, fmt.Sprintf("expectHeaders %s", key))
+		}
+	}
+
+	if expect.Schema == "" {
+		expect.Schema = a.ExpectSchema
+	} else if a.ExpectSchema != "" {
+		kept = append(kept, "expectSchema")
+	}
+
+	for _, item := range a.ExpectVerify {
+		if !slices.Contains(expect.Verify, item) {
+			expect.Verify = append(expect.Verify, item)
+		}
+	}
+	return
+}
+
+// String renders the suggestions in a readable way
+func (a AssertionSuggestion) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "suggested assertions of %s/%s:\n\nexpectStatus: %d\n", a.Suite, a.Case, a.ExpectStatus)
+	if len(a.ExpectHeaders) > 0 {
+		fmt.Fprintf(&buf, "expectHeaders: %s\n", objectToJSON(a.ExpectHeaders))
+	}
+	if a.ExpectSchema != "" {
+		fmt.Fprintf(&buf, "expectSchema: %s\n", a.ExpectSchema)
+	}
+	if len(a.ExpectVerify) > 0 {
+		fmt.Fprintf(&buf, "expectVerify:\n- %s\n", strings.Join(a.ExpectVerify, "\n- "))
+	}
+	if a.Applied {
+		buf.WriteString("\nthe suggestions are applied to the test case")
+		if len(a.Kept) > 0 {
+			fmt.Fprintf(&buf, ", the existing ones are kept: %s", strings.Join(a.Kept, ", "))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
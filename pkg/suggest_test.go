@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSuggestAssertions(t *testing.T) {
+	ignore := newDiffIgnore(NewDefaultConfig().Diff.IgnoreFields, NewDefaultConfig().Diff.IgnoreHeaders)
+	tests := []struct {
+		name     string
+		response SampleResponse
+		headers  map[string]string
+		schema   bool
+		verify   []string
+	}{{
+		name: "stable headers only",
+		response: SampleResponse{StatusCode: 200, Headers: map[string]string{"content-type": "application/json",
+			"Date": "today", "X-Request-Id": "1", "Cache-Control": "no-cache"}},
+		headers: map[string]string{"Content-Type": "application/json", "Cache-Control": "no-cache"},
+	}, {
+		name: "fields",
+		response: SampleResponse{StatusCode: 200, Body: `{"name":"atest","count":2,"enabled":true,"tags":["a"],"empty":[],
+			"id":"1","uuid":"0b8f3b56-6c53-4d2e-9a5e-0a8b0b8f3b56","created":"2025-01-01T00:00:00Z","blank":"",
+			"user-name":"a","nested":{"deep":{"x":1},"y":"z"},"nil":null}`},
+		schema: true,
+		verify: []string{`data.count == 2`, `data.enabled == true`, `data.name == "atest"`, `data.nested.y == "z"`,
+			`len(data.tags) > 0`, `data["user-name"] == "a"`},
+	}, {
+		name:     "array",
+		response: SampleResponse{StatusCode: 200, Body: `[{"name":"a"}]`},
+		schema:   true,
+		verify:   []string{"len(data) > 0"},
+	}, {
+		name:     "not JSON",
+		response: SampleResponse{StatusCode: 500, Body: "internal error"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := suggestAssertions(&tt.response, ignore)
+			if data.ExpectStatus != tt.response.StatusCode || len(data.ExpectHeaders) != len(tt.headers) {
+				t.Fatalf("unexpected suggestion %+v", data)
+			}
+			for key, value := range tt.headers {
+				if data.ExpectHeaders[key] != value {
+					t.Fatalf("expected header %s=%q, got %v", key, value, data.ExpectHeaders)
+				}
+			}
+			if (data.ExpectSchema != "") != tt.schema || (tt.schema && ValidateSchema(data.ExpectSchema) != nil) {
+				t.Fatalf("unexpected schema %q", data.ExpectSchema)
+			}
+			if !slices.Equal(data.ExpectVerify, tt.verify) {
+				t.Fatalf("expected verify %q, got %q", tt.verify, data.ExpectVerify)
+			}
+			verified := verifyExpressions(data.ExpectVerify, &tt.response)
+			if verified.Failed != 0 {
+				t.Fatalf("the suggestions should pass with the response: %s", verified)
+			}
+		})
+	}
+
+	var fields []string
+	for i := 0; i < maxSuggestedVerify+5; i++ {
+		fields = append(fields, `"f`+strings.Repeat("x", i)+`":1`)
+	}
+	data := suggestAssertions(&SampleResponse{StatusCode: 200, Body: "{" + strings.Join(fields, ",") + "}"}, ignore)
+	if len(data.ExpectVerify) != maxSuggestedVerify {
+		t.Fatalf("expected %d verify expressions, got %d", maxSuggestedVerify, len(data.ExpectVerify))
+	}
+}
+
+func TestAssertionSuggestionMergeInto(t *testing.T) {
+	suggestion := AssertionSuggestion{
+		ExpectStatus:  200,
+		ExpectHeaders: map[string]string{"Content-Type": "application/json", "Cache-Control": "no-cache"},
+		ExpectSchema:  `{"type":"object"}`,
+		ExpectVerify:  []string{`data.name == "a"`, "len(data.tags) > 0"},
+	}
+	tests := []struct {
+		name     string
+		expect   *server.Response
+		expected *server.Response
+		kept     []string
+	}{{
+		name: "empty",
+		expected: &server.Response{StatusCode: 200, Schema: `{"type":"object"}`,
+			Header: []*server.Pair{{Key: "Cache-Control", Value: "no-cache"}, {Key: "Content-Type", Value: "application/json"}},
+			Verify: []string{`data.name == "a"`, "len(data.tags) > 0"}},
+	}, {
+		name: "existing ones are kept",
+		expect: &server.Response{StatusCode: 201, Schema: `{"type":"array"}`,
+			Header: []*server.Pair{{Key: "content-type", Value: "text/plain"}}, Verify: []string{`data.name == "a"`}},
+		expected: &server.Response{StatusCode: 201, Schema: `{"type":"array"}`,
+			Header: []*server.Pair{{Key: "content-type", Value: "text/plain"}, {Key: "Cache-Control", Value: "no-cache"}},
+			Verify: []string{`data.name == "a"`, "len(data.tags) > 0"}},
+		kept: []string{"expectStatus 201", "expectHeaders Content-Type", "expectSchema"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testCase := &server.TestCase{Response: tt.expect}
+			kept := suggestion.mergeInto(testCase)
+			if !slices.Equal(kept, tt.kept) {
+				t.Fatalf("expected kept %q, got %q", tt.kept, kept)
+			}
+			actual, _ := json.Marshal(testCase.Response)
+			expected, _ := json.Marshal(tt.expected)
+			if string(actual) != string(expected) {
+				t.Fatalf("expected %s, got %s", expected, actual)
+			}
+		})
+	}
+}
+
+func TestSuggestAssertionsTool(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     SuggestAssertionsRequest
+		applied  bool
+		expected []string
+		err      string
+	}{
+		{name: "run the case", args: SuggestAssertionsRequest{Suite: "sample", Testcase: "a"},
+			expected: []string{"suggested assertions of sample/a", "expectStatus: 200", `data.name == "live"`}},
+		{name: "given response", args: SuggestAssertionsRequest{Suite: "sample", Testcase: "a",
+			Response: &SampleResponse{StatusCode: 201, Body: `{"name":"given"}`}},
+			expected: []string{"expectStatus: 201", `data.name == "given"`}},
+		{name: "apply", args: SuggestAssertionsRequest{Suite: "sample", Testcase: "a", Apply: true}, applied: true,
+			expected: []string{"the suggestions are applied to the test case, the existing ones are kept: expectStatus 204"}},
+		{name: "no response", args: SuggestAssertionsRequest{Suite: "sample", Testcase: "b"}, err: `no response of test case "b": refused`},
+		{name: "no testcase", args: SuggestAssertionsRequest{Suite: "sample"}, err: "suite and testcase are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample"},
+				&server.TestCase{Name: "a", Request: &server.Request{Api: "/a"}, Response: &server.Response{StatusCode: 204}},
+				&server.TestCase{Name: "b", Request: &server.Request{Api: "/b"}})
+			fake.results["a"] = &server.TestCaseResult{StatusCode: 200, Body: `{"name":"live"}`}
+			fake.results["b"] = &server.TestCaseResult{Error: "refused"}
+
+			suggester := NewAssertionSuggester(runner.runners, runner.pool, runner.sessions, NewDefaultConfig().Diff)
+			result, data, err := suggester.SuggestAssertions(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := result.Content[0].(*mcp.TextContent).Text
+			for _, line := range tt.expected {
+				if !strings.Contains(text, line) {
+					t.Fatalf("expected %q in %q", line, text)
+				}
+			}
+			if data.Applied != tt.applied || (fake.callsOf("UpdateTestCase") == 1) != tt.applied {
+				t.Fatalf("expected applied %v, got %+v", tt.applied, data)
+			}
+			if tt.applied {
+				if expect := fake.testCase("sample", "a").Response; expect.StatusCode != 204 || expect.Schema == "" {
+					t.Fatalf("unexpected expectation %v", expect)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+)
+
+type RPCSpec struct {
+	Import           []string `json:"import,omitempty" jsonschema:"the import paths of the proto files"`
+	ServerReflection *bool    `json:"serverReflection,omitempty" jsonschema:"use the gRPC server reflection instead of the proto files"`
+	Protofile        string   `json:"protofile,omitempty" jsonschema:"the path of the proto file"`
+	Protoset         string   `json:"protoset,omitempty" jsonschema:"the path or URL of the protoset file"`
+	Raw              string   `json:"raw,omitempty" jsonschema:"the content of the proto file"`
+}
+
+type SecureSpec struct {
+	Insecure   *bool  `json:"insecure,omitempty" jsonschema:"skip the verification of the server certificate"`
+	Cert       string `json:"cert,omitempty" jsonschema:"the path of the client certificate"`
+	CA         string `json:"ca,omitempty" jsonschema:"the path of the CA certificate"`
+	ServerName string `json:"serverName,omitempty" jsonschema:"the server name to verify"`
+	Key        string `json:"key,omitempty" jsonschema:"the path of the client key"`
+}
+
+// mergeInto applies the given fields on the current suite, the omitted ones are kept
+func (args TestSuiteArgs) mergeInto(suite *server.TestSuite) (err error) {
+	// the test suite of the runner has no such fields
+	switch {
+	case len(args.Headers) > 0 || args.Auth != nil:
+		err = errors.New("the default headers and auth of test suite are not supported by the runner, " +
+			"set them on the test cases or as the session headers with use-test-suite instead")
+		return
+	case args.Description != "":
+		err = errors.New("the description of test suite is not supported by the runner")
+		return
+	}
+
+	if args.API != "" {
+		suite.Api = args.API
+	}
+
+	for _, key := range args.RemoveParams {
+		suite.Param = slices.DeleteFunc(suite.Param, func(pair *server.Pair) bool {
+			return pair.Key == key
+		})
+	}
+	for _, item := range args.Param {
+		if item == nil || item.Key == "" {
+			err = errors.New("the key of param is required")
+			return
+		}
+		setParam(suite, item.Key, item.Value, item.Description)
+	}
+
+	if args.Spec != nil {
+		args.Spec.mergeInto(suite)
+	}
+	return
+}
+
+func (s *APISpec) mergeInto(suite *server.TestSuite) {
+	if suite.Spec == nil {
+		suite.Spec = &server.APISpec{}
+	}
+	spec := suite.Spec
+	if s.Kind != "" {
+		spec.Kind = s.Kind
+	}
+	if s.Url != "" {
+		spec.Url = s.Url
+	}
+
+	if s.RPC != nil {
+		if spec.Rpc == nil {
+			spec.Rpc = &server.RPC{}
+		}
+		if s.RPC.Import != nil {
+			spec.Rpc.Import = s.RPC.Import
+		}
+		if s.RPC.ServerReflection != nil {
+			spec.Rpc.ServerReflection = *s.RPC.ServerReflection
+		}
+		mergeString(&spec.Rpc.Protofile, s.RPC.Protofile)
+		mergeString(&spec.Rpc.Protoset, s.RPC.Protoset)
+		mergeString(&spec.Rpc.Raw, s.RPC.Raw)
+	}
+
+	if s.Secure != nil {
+		if spec.Secure == nil {
+			spec.Secure = &server.Secure{}
+		}
+		if s.Secure.Insecure != nil {
+			spec.Secure.Insecure = *s.Secure.Insecure
+		}
+		mergeString(&spec.Secure.Cert, s.Secure.Cert)
+		mergeString(&spec.Secure.Ca, s.Secure.CA)
+		mergeString(&spec.Secure.ServerName, s.Secure.ServerName)
+		mergeString(&spec.Secure.Key, s.Secure.Key)
+	}
+}
+
+func setParam(suite *server.TestSuite, key, value, description string) {
+	for _, pair := range suite.Param {
+		if pair.Key == key {
+			pair.Value = value
+			if description != "" {
+				pair.Description = description
+			}
+			return
+		}
+	}
+	suite.Param = append(suite.Param, &server.Pair{Key: key, Value: value, Description: description})
+}
+
+func mergeString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTestSuiteArgsMergeInto(t *testing.T) {
+	insecure := true
+	current := func() *server.TestSuite {
+		return &server.TestSuite{
+			Name: "sample",
+			Api:  "http://localhost:8080",
+			Param: []*server.Pair{
+				{Key: "token", Value: "abc"},
+				{Key: "user", Value: "admin"},
+			},
+			Spec: &server.APISpec{
+				Kind: "swagger",
+				Url:  "http://localhost:8080/swagger.json",
+				Rpc:  &server.RPC{Protofile: "server.proto", Import: []string{"."}},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		args   TestSuiteArgs
+		verify func(t *testing.T, suite *server.TestSuite)
+		err    string
+	}{{
+		name: "omitted fields are kept",
+		args: TestSuiteArgs{Name: "sample"},
+		verify: func(t *testing.T, suite *server.TestSuite) {
+			if !proto.Equal(suite, current()) {
+				t.Fatalf("the suite should not change, got %v", suite)
+			}
+		},
+	}, {
+		name: "partial fields",
+		args: TestSuiteArgs{Name: "sample", API: "http://localhost:9090"},
+		verify: func(t *testing.T, suite *server.TestSuite) {
+			expected := current()
+			expected.Api = "http://localhost:9090"
+			if !proto.Equal(suite, expected) {
+				t.Fatalf("expected %v, got %v", expected, suite)
+			}
+		},
+	}, {
+		name: "partial spec",
+		args: TestSuiteArgs{Spec: &APISpec{
+			RPC:    &RPCSpec{Raw: "syntax = \"proto3\";"},
+			Secure: &SecureSpec{Insecure: &insecure},
+		}},
+		verify: func(t *testing.T, suite *server.TestSuite) {
+			spec := suite.Spec
+			if spec.Kind != "swagger" || spec.Url == "" || spec.Rpc.Protofile != "server.proto" ||
+				len(spec.Rpc.Import) != 1 || spec.Rpc.Raw == "" || !spec.Secure.Insecure {
+				t.Fatalf("only the given spec fields should change, got %v", spec)
+			}
+		},
+	}, {
+		name: "params are set and removed",
+		args: TestSuiteArgs{
+			Param:        []*Pair{{Key: "token", Value: "def"}, {Key: "header.Accept", Value: "*/*"}},
+			RemoveParams: []string{"missing"},
+		},
+		verify: func(t *testing.T, suite *server.TestSuite) {
+			if value := paramValue(suite, "token"); value != "def" {
+				t.Fatalf("expected the updated param, got %q", value)
+			}
+			if value := paramValue(suite, "header.Accept"); value != "*/*" {
+				t.Fatalf("expected the new param, got %q", value)
+			}
+		},
+	}, {
+		name: "remove params",
+		args: TestSuiteArgs{RemoveParams: []string{"token"}},
+		verify: func(t *testing.T, suite *server.TestSuite) {
+			if len(suite.Param) != 1 || paramValue(suite, "token") != "" {
+				t.Fatalf("expected the param removed, got %v", suite.Param)
+			}
+		},
+	}, {
+		name: "empty param key",
+		args: TestSuiteArgs{Param: []*Pair{{Value: "abc"}}},
+		err:  "key of param is required",
+	}, {
+		name: "headers",
+		args: TestSuiteArgs{Headers: map[string]string{"X-Tenant": "demo"}},
+		err:  "default headers and auth of test suite are not supported",
+	}, {
+		name: "auth",
+		args: TestSuiteArgs{Auth: map[string]any{"type": "bearer"}},
+		err:  "default headers and auth of test suite are not supported",
+	}, {
+		name: "description",
+		args: TestSuiteArgs{Description: "the sample"},
+		err:  "description of test suite is not supported",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suite := current()
+			err := tt.args.mergeInto(suite)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.verify(t, suite)
+		})
+	}
+}
+
+func TestUpdateTestSuite(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  TestSuiteArgs
+		api   string
+		param string
+		err   string
+	}{{
+		name:  "merged",
+		args:  TestSuiteArgs{API: "http://localhost:9090", Param: []*Pair{{Key: "user", Value: "admin"}}},
+		api:   "http://localhost:9090",
+		param: "admin",
+	}, {
+		name: "invalid param",
+		args: TestSuiteArgs{API: "http://localhost:9090", Param: []*Pair{{Value: "admin"}}},
+		api:  "http://localhost:8080",
+		err:  "key of param is required",
+	}, {
+		name: "auth is not supported",
+		args: TestSuiteArgs{Auth: map[string]any{"type": "bearer", "token": "supersecret"}},
+		api:  "http://localhost:8080",
+		err:  "not supported by the runner",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, runner := newFakeRunner(t)
+			fake.addSuite(&server.TestSuite{Name: "sample", Api: "http://localhost:8080"})
+			fake.secrets["token"] = "abc"
+			runner.sessions.Set(nil, SessionState{Suite: "sample"})
+
+			result, _, err := runner.UpdateTestSuite(context.Background(), nil, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				if calls := fake.callsOf("UpdateTestSuite"); calls != 0 {
+					t.Fatalf("the invalid suite should not be saved")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if text := result.Content[0].(*mcp.TextContent).Text; text != `updated test suite "sample"` {
+				t.Fatalf("unexpected result %q", text)
+			}
+
+			suite := fake.suites["sample"]
+			if suite.Api != tt.api || paramValue(suite, "user") != tt.param {
+				t.Fatalf("unexpected suite %v", suite)
+			}
+			if len(fake.changes) != 0 || len(fake.secrets) != 1 || fake.secrets["token"] != "abc" {
+				t.Fatalf("the secrets should not change, got %v and %v", fake.changes, fake.secrets)
+			}
+		})
+	}
+}
+
+func paramValue(suite *server.TestSuite, key string) string {
+	for _, pair := range suite.Param {
+		if pair.Key == key {
+			return pair.Value
+		}
+	}
+	return ""
+}
+
+func headerValue(header []*server.Pair, key string) string {
+	for _, pair := range header {
+		if strings.EqualFold(pair.Key, key) {
+			return pair.Value
+		}
+	}
+	return ""
+}
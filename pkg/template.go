@@ -0,0 +1,276 @@
+package pkg
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/linuxsuren/api-testing/pkg/render"
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+const templateName = "template"
+
+var templatePositionPattern = regexp.MustCompile(`template: ` + templateName + `:(\d+):(?:(\d+):)?`)
+
+type RenderTemplateRequest struct {
+	Template string            `json:"template" jsonschema:"the template to render, such as {{.param.server}}/api or {{randAlpha 6}}"`
+	Suite    string            `json:"suite,omitempty" jsonschema:"the name of test suite whose params are used as .param"`
+	Params   map[string]string `json:"params,omitempty" jsonschema:"the params to use as .param, they override the ones of the suite"`
+	Env      map[string]string `json:"env,omitempty" jsonschema:"the environment variables for the env and expandenv functions, the other ones are not available in the preview"`
+}
+
+// RenderedTemplate is the result of rendering a template
+type RenderedTemplate struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+type ListTemplateFunctionsRequest struct {
+	Name string `json:"name,omitempty" jsonschema:"filter the functions by name"`
+	Kind string `json:"kind,omitempty" jsonschema:"the kind of functions: template (default) for the request fields, or verify for the verify expressions"`
+}
+
+// TemplateFunction is a function supported by the runner
+type TemplateFunction struct {
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Example   string `json:"example,omitempty"`
+}
+
+type TemplateFunctions struct {
+	Functions []TemplateFunction `json:"functions"`
+}
+
+func (r *gRPCRunner) RenderTemplate(ctx context.Context, request *mcp.CallToolRequest, args RenderTemplateRequest) (
+	result *mcp.CallToolResult, data RenderedTemplate, err error) {
+	params := map[string]string{}
+	if args.Suite != "" {
+		var conn grpc.ClientConnInterface
+		if conn, err = r.getConnection(request); err != nil {
+			return
+		}
+		var suite *server.TestSuite
+		if suite, err = server.NewRunnerClient(conn).GetTestSuite(ctx, &server.TestSuiteIdentity{Name: args.Suite}); err != nil {
+			return
+		}
+		params = pairsToMap(suite.Param)
+	}
+	maps.Copy(params, args.Params)
+
+	data = renderTemplate(args.Template, map[string]any{"param": params}, args.Env)
+	result = &mcp.CallToolResult{
+		IsError: data.Error != "",
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.String(args.Template)},
+		},
+	}
+	return
+}
+
+const (
+	// maxTemplateCount is the max count of the functions which repeat or generate things in the preview
+	maxTemplateCount = 10000
+	// maxTemplateOutput is the max size of the rendered output in the preview
+	maxTemplateOutput = 64 * 1024
+)
+
+var errTemplateOutputTooLarge = fmt.Errorf("the output exceeds the limit of %d bytes in the preview", maxTemplateOutput)
+
+// renderTemplate renders the template with the functions of the runner,
+// the functions which access the host or the secrets, or produce unbounded data are not available in the preview
+func renderTemplate(text string, ctx any, env map[string]string) (data RenderedTemplate) {
+	tpl, err := template.New(templateName).Funcs(previewFuncs(env)).Parse(text)
+	if err == nil {
+		buf := &limitedBuffer{limit: maxTemplateOutput}
+		if err = tpl.Execute(buf, ctx); err == nil {
+			data.Output = buf.String()
+			return
+		}
+	}
+
+	data.Error = err.Error()
+	if match := templatePositionPattern.FindStringSubmatch(data.Error); match != nil {
+		data.Line, _ = strconv.Atoi(match[1])
+		data.Column, _ = strconv.Atoi(match[2])
+	}
+	return
+}
+
+// previewFuncs returns the functions of the runner, along with the overrides which are safe to run in the MCP server
+func previewFuncs(env map[string]string) template.FuncMap {
+	// the environment of the MCP server is not the one of the runner, only the given variables are used
+	getenv := func(key string) (string, error) {
+		if value, ok := env[key]; ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("environment variable %q is not given, set it in env", key)
+	}
+	funcs := render.FuncMap()
+	funcs["env"] = getenv
+	funcs["expandenv"] = func(s string) (expanded string, err error) {
+		expanded = os.Expand(s, func(key string) string {
+			value, getErr := getenv(key)
+			err = cmp.Or(err, getErr)
+			return value
+		})
+		return
+	}
+	for _, name := range []string{"readFile", "secretValue", "getHostByName", "randImage", "randPdf", "randZip"} {
+		funcs[name] = func(...any) (string, error) {
+			return "", fmt.Errorf("%s is only available in the runner", name)
+		}
+	}
+
+	// the counts are bounded, the other arguments are checked by the original functions
+	bounded := func(name string, counts ...int) error {
+		for _, count := range counts {
+			if count > maxTemplateCount || count < -maxTemplateCount {
+				return fmt.Errorf("%s: %d exceeds the limit %d of the preview", name, count, maxTemplateCount)
+			}
+		}
+		return nil
+	}
+	repeat := funcs["repeat"].(func(int, string) string)
+	funcs["repeat"] = func(count int, text string) (string, error) {
+		if len(text) > 0 && count > maxTemplateOutput/len(text) {
+			return "", errTemplateOutputTooLarge
+		}
+		return repeat(count, text), nil
+	}
+	until := funcs["until"].(func(int) []int)
+	funcs["until"] = func(count int) (items []int, err error) {
+		if err = bounded("until", count); err == nil {
+			items = until(count)
+		}
+		return
+	}
+	untilStep := funcs["untilStep"].(func(int, int, int) []int)
+	funcs["untilStep"] = func(start, stop, step int) (items []int, err error) {
+		if step != 0 {
+			err = bounded("untilStep", (stop-start)/step)
+		}
+		if err == nil {
+			items = untilStep(start, stop, step)
+		}
+		return
+	}
+	seq := funcs["seq"].(func(...int) string)
+	funcs["seq"] = func(params ...int) (text string, err error) {
+		if len(params) > 0 {
+			err = bounded("seq", params[0], params[len(params)-1]-params[0])
+		}
+		if err == nil {
+			text = seq(params...)
+		}
+		return
+	}
+	for _, name := range []string{"randAlpha", "randAlphaNum", "randAscii", "randNumeric"} {
+		random := funcs[name].(func(int) string)
+		funcs[name] = func(count int) (text string, err error) {
+			if err = bounded(name, count); err == nil {
+				text = random(count)
+			}
+			return
+		}
+	}
+	randBytes := funcs["randBytes"].(func(int) (string, error))
+	funcs["randBytes"] = func(count int) (string, error) {
+		if err := bounded("randBytes", count); err != nil {
+			return "", err
+		}
+		return randBytes(count)
+	}
+	return funcs
+}
+
+// limitedBuffer fails the writes beyond the limit, which stops the template execution
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errTemplateOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// String renders the result, the position of the error is pointed out
+func (t RenderedTemplate) String(text string) string {
+	if t.Error == "" {
+		return t.Output
+	}
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "failed to render the template: %s\n", t.Error)
+	lines := strings.Split(text, "\n")
+	if t.Line > 0 && t.Line <= len(lines) {
+		fmt.Fprintf(&buf, "\n%d | %s\n", t.Line, lines[t.Line-1])
+		if t.Column > 0 {
+			fmt.Fprintf(&buf, "%s^\n", strings.Repeat(" ", len(strconv.Itoa(t.Line))+3+t.Column))
+		}
+	}
+	return buf.String()
+}
+
+func (r *gRPCRunner) ListTemplateFunctions(ctx context.Context, request *mcp.CallToolRequest, args ListTemplateFunctionsRequest) (
+	result *mcp.CallToolResult, data TemplateFunctions, err error) {
+	switch args.Kind {
+	case "", "template":
+		args.Kind = ""
+	case "verify":
+	default:
+		err = fmt.Errorf("not supported kind %q, should be template or verify", args.Kind)
+		return
+	}
+
+	var conn grpc.ClientConnInterface
+	if conn, err = r.getConnection(request); err != nil {
+		return
+	}
+	var reply *server.Pairs
+	if reply, err = server.NewRunnerClient(conn).FunctionsQuery(ctx, &server.SimpleQuery{Name: args.Name, Kind: args.Kind}); err != nil {
+		return
+	}
+
+	data.Functions = make([]TemplateFunction, 0, len(reply.Data))
+	for _, pair := range reply.Data {
+		data.Functions = append(data.Functions, TemplateFunction{
+			Name:      pair.Key,
+			Signature: pair.Value,
+			Example:   strings.TrimSpace(pair.Description),
+		})
+	}
+	slices.SortFunc(data.Functions, func(a, b TemplateFunction) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "%d function(s):\n", len(data.Functions))
+	for _, item := range data.Functions {
+		fmt.Fprintf(&buf, "- %s %s", item.Name, item.Signature)
+		if item.Example != "" {
+			fmt.Fprintf(&buf, ", e.g. %s", item.Example)
+		}
+		buf.WriteString("\n")
+	}
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: buf.String()},
+		},
+	}
+	return
+}
@@ -0,0 +1,104 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	t.Setenv("ATEST_MCP_TEMPLATE_HOST", "leaked")
+	tests := []struct {
+		name   string
+		text   string
+		env    map[string]string
+		output string
+		err    string
+		line   int
+		column int
+	}{
+		{name: "param", text: "{{.param.server}}/api", output: "http://localhost/api"},
+		{name: "function", text: `{{upper "abc"}}`, output: "ABC"},
+		{name: "given env", text: `{{env "HOST"}}`, env: map[string]string{"HOST": "localhost"}, output: "localhost"},
+		{name: "host env is not used", text: `x {{env "ATEST_MCP_TEMPLATE_HOST"}}`,
+			err: `environment variable "ATEST_MCP_TEMPLATE_HOST" is not given`, line: 1, column: 4},
+		{name: "given expandenv", text: `{{expandenv "$A-${B}"}}`, env: map[string]string{"A": "a", "B": "b"}, output: "a-b"},
+		{name: "host expandenv is not used", text: `{{expandenv "$A-$ATEST_MCP_TEMPLATE_HOST"}}`, env: map[string]string{"A": "a"},
+			err: `environment variable "ATEST_MCP_TEMPLATE_HOST" is not given`, line: 1, column: 2},
+		{name: "readFile", text: `{{readFile "/etc/passwd"}}`, err: "readFile is only available in the runner", line: 1, column: 2},
+		{name: "secretValue", text: `{{secretValue "token"}}`, err: "secretValue is only available in the runner", line: 1, column: 2},
+		{name: "getHostByName", text: `{{getHostByName "example.com"}}`, err: "getHostByName is only available in the runner",
+			line: 1, column: 2},
+		{name: "randZip", text: `{{randZip}}`, err: "randZip is only available in the runner", line: 1, column: 2},
+		{name: "randImage", text: `{{randImage 100 100}}`, err: "randImage is only available in the runner", line: 1, column: 2},
+		{name: "bounded repeat", text: `{{repeat 3 "ab"}}`, output: "ababab"},
+		{name: "unbounded repeat", text: `{{repeat 100000000 "ab"}}`, err: "the output exceeds the limit", line: 1, column: 2},
+		{name: "bounded until", text: `{{range until 3}}{{.}}{{end}}`, output: "012"},
+		{name: "unbounded until", text: `{{range until 1000000000}}{{end}}`, err: "until: 1000000000 exceeds the limit",
+			line: 1, column: 8},
+		{name: "unbounded untilStep", text: `{{untilStep 0 1000000000 1}}`, err: "untilStep: 1000000000 exceeds the limit",
+			line: 1, column: 2},
+		{name: "bounded seq", text: `{{seq 3}}`, output: "1 2 3"},
+		{name: "unbounded seq", text: `{{seq 1 1000000000}}`, err: "seq: 999999999 exceeds the limit", line: 1, column: 2},
+		{name: "bounded randAlpha", text: `{{len (randAlpha 6)}}`, output: "6"},
+		{name: "unbounded randAlpha", text: `{{randAlpha 1000000000}}`, err: "randAlpha: 1000000000 exceeds the limit",
+			line: 1, column: 2},
+		{name: "unbounded randBytes", text: `{{randBytes 1000000000}}`, err: "randBytes: 1000000000 exceeds the limit",
+			line: 1, column: 2},
+		{name: "large output", text: `{{range until 10000}}{{repeat 10 "x"}}{{end}}`, err: "the output exceeds the limit"},
+		{name: "parse error", text: "a\n{{ .param.server | nope }}", err: `function "nope" not defined`, line: 2},
+		{name: "execution error", text: "a\nb {{index .param 1}}", err: "error calling index", line: 2, column: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := renderTemplate(tt.text, map[string]any{"param": map[string]string{"server": "http://localhost"}}, tt.env)
+			if data.Output != tt.output || !strings.Contains(data.Error, tt.err) || (tt.err == "") != (data.Error == "") {
+				t.Fatalf("expected %q with error %q, got %+v", tt.output, tt.err, data)
+			}
+			if data.Line != tt.line || data.Column != tt.column {
+				t.Fatalf("expected the position %d:%d, got %d:%d", tt.line, tt.column, data.Line, data.Column)
+			}
+			if strings.Contains(data.Output+data.Error, "leaked") {
+				t.Fatalf("the environment of the server should not be used: %+v", data)
+			}
+		})
+	}
+}
+
+func TestRenderedTemplateString(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		data     RenderedTemplate
+		expected string
+	}{{
+		name:     "output",
+		data:     RenderedTemplate{Output: "abc"},
+		expected: "abc",
+	}, {
+		name:     "error without position",
+		data:     RenderedTemplate{Error: "failed"},
+		expected: "failed to render the template: failed\n",
+	}, {
+		name:     "error with line",
+		text:     "a\n{{ nope }}",
+		data:     RenderedTemplate{Error: "failed", Line: 2},
+		expected: "failed to render the template: failed\n\n2 | {{ nope }}\n",
+	}, {
+		name:     "error with column",
+		text:     `x {{env "A"}}`,
+		data:     RenderedTemplate{Error: "failed", Line: 1, Column: 4},
+		expected: "failed to render the template: failed\n\n1 | x {{env \"A\"}}\n        ^\n",
+	}, {
+		name:     "line out of range",
+		text:     "a",
+		data:     RenderedTemplate{Error: "failed", Line: 3, Column: 1},
+		expected: "failed to render the template: failed\n",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := tt.data.String(tt.text); actual != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const tracerName = "github.com/linuxsuren/atest-mcp-server"
+
+// SetupTracing installs the OpenTelemetry tracer provider which exports the spans via OTLP gRPC.
+// The trace context is always propagated to the runner, even if the exporting is disabled.
+func SetupTracing(ctx context.Context, config TracingConfig) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+	shutdown = func(context.Context) error { return nil }
+	if !config.Enabled {
+		return
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.Endpoint)}
+	if config.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+
+	var exporter *otlptrace.Exporter
+	if exporter, err = otlptracegrpc.New(ctx, options...); err != nil {
+		err = fmt.Errorf("failed to create the trace exporter: %w", err)
+		return
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewSchemaless(
+			semconv.ServiceName(config.ServiceName),
+			semconv.ServiceVersion(GetBuildInfo().Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	shutdown = provider.Shutdown
+	return
+}
+
+// NewTracingDialOption creates the spans of the gRPC requests, and propagates the trace context in the gRPC metadata
+func NewTracingDialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
+
+// startToolSpan starts a span of the tool call, the parent trace context is taken from the request _meta if any
+func startToolSpan(ctx context.Context, request *mcp.CallToolRequest, name string) (context.Context, func(isError bool, err error)) {
+	if request != nil && request.Params != nil {
+		carrier := propagation.MapCarrier{}
+		for key, val := range request.Params.GetMeta() {
+			if str, ok := val.(string); ok {
+				carrier[key] = str
+			}
+		}
+		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "tools/call "+name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("mcp.tool.name", name)))
+	return ctx, func(isError bool, err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if isError {
+			span.SetStatus(codes.Error, toolErrorCode)
+		}
+		span.End()
+	}
+}
+
+// InstrumentToolCall wraps the tool call with the metrics and the tracing span
+func InstrumentToolCall(ctx context.Context, request *mcp.CallToolRequest, name string,
+	call func(ctx context.Context) (result *mcp.CallToolResult, err error)) (err error) {
+	done := observeToolCall(name)
+	ctx, end := startToolSpan(ctx, request, name)
+
+	var result *mcp.CallToolResult
+	result, err = call(ctx)
+	isError := result != nil && result.IsError
+	end(isError, err)
+	done(isError, err)
+	return
+}
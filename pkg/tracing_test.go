@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentToolCall(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	if _, err := SetupTracing(context.Background(), TracingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name    string
+		request *mcp.CallToolRequest
+		result  *mcp.CallToolResult
+		err     error
+		code    codes.Code
+		traceID string
+	}{
+		{name: "passed", result: &mcp.CallToolResult{}, code: codes.Unset},
+		{name: "error result", result: &mcp.CallToolResult{IsError: true}, code: codes.Error},
+		{name: "error", err: errors.New("failed"), code: codes.Error},
+		{name: "parent from meta", request: &mcp.CallToolRequest{Params: &mcp.CallToolParams{Meta: mcp.Meta{"traceparent": parent}}},
+			code: codes.Unset, traceID: "4bf92f3577b34da6a3ce929d0e0e4736"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spanContext trace.SpanContext
+			err := InstrumentToolCall(context.Background(), tt.request, "tracing", func(ctx context.Context) (*mcp.CallToolResult, error) {
+				spanContext = trace.SpanContextFromContext(ctx)
+				return tt.result, tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+
+			spans := recorder.Ended()
+			if len(spans) != i+1 {
+				t.Fatalf("expected %d spans, got %d", i+1, len(spans))
+			}
+			span := spans[i]
+			if span.Name() != "tools/call tracing" || span.SpanKind() != trace.SpanKindServer || span.Status().Code != tt.code {
+				t.Fatalf("unexpected span %s %v %v", span.Name(), span.SpanKind(), span.Status())
+			}
+			if span.SpanContext().SpanID() != spanContext.SpanID() {
+				t.Fatal("the span should be in the context of the call")
+			}
+			if tt.traceID != "" && span.SpanContext().TraceID().String() != tt.traceID {
+				t.Fatalf("expected trace %s, got %s", tt.traceID, span.SpanContext().TraceID())
+			}
+		})
+	}
+}
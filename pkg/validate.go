@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template/parse"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+var httpMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace}
+
+var (
+	headerNamePattern = regexp.MustCompile("^[!#$%&'*+\\-.^_`|~0-9A-Za-z]+$")
+	templatePattern   = regexp.MustCompile(`{{.*?}}`)
+)
+
+// Validate checks the test case locally, and returns all the problems
+func (args CreateTestCaseRequest) Validate() (problems []string) {
+	if args.CaseName == "" {
+		problems = append(problems, "caseName is required")
+	}
+
+	switch args.protocol() {
+	case ProtocolHTTP:
+		if args.Method == "" {
+			problems = append(problems, "method is required")
+		} else if !slices.Contains(httpMethods, strings.ToUpper(args.Method)) {
+			problems = append(problems, fmt.Sprintf("method %q is not one of %s", args.Method, strings.Join(httpMethods, ", ")))
+		}
+
+		if args.API == "" {
+			problems = append(problems, "api is required")
+		} else if problem := validateAPI(args.API); problem != "" {
+			problems = append(problems, problem)
+		}
+	case ProtocolGraphQL:
+		// the API of the suite is the endpoint if it is empty
+		if problem := validateAPI(args.API); args.API != "" && problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	problems = append(problems, args.validateProtocol()...)
+
+	if args.ExpectStatus != 0 && (args.ExpectStatus < 100 || args.ExpectStatus > 599) {
+		problems = append(problems, fmt.Sprintf("expectStatus %d is not a valid HTTP status code", args.ExpectStatus))
+	}
+
+	problems = append(problems, validateHeaderNames("headers", args.Headers)...)
+	problems = append(problems, validateHeaderNames("expectHeaders", args.ExpectHeaders)...)
+	problems = append(problems, validateHeaderNames("secretHeaders", args.SecretHeaders)...)
+	for key, name := range args.SecretHeaders {
+		if name == "" {
+			problems = append(problems, fmt.Sprintf("secretHeaders[%s] should be the name of secret", key))
+		}
+	}
+
+	if len(args.FormParams) > 0 && args.Body != "" {
+		problems = append(problems, "formParams and body can not be used together")
+	}
+	if problem := validateBody(args.Body, args.Headers); problem != "" {
+		problems = append(problems, problem)
+	}
+
+	templates := map[string]string{"api": args.API, "body": args.Body, "expectBody": args.ExpectBody}
+	for _, group := range []struct {
+		name string
+		data map[string]string
+	}{{"headers", args.Headers}, {"queryParams", args.QueryParams}, {"cookies", args.Cookies}, {"formParams", args.FormParams}} {
+		for key, value := range group.data {
+			templates[fmt.Sprintf("%s[%s]", group.name, key)] = value
+		}
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := validateTemplate(name, templates[name]); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if err := ValidateSchema(args.ExpectSchema); err != nil {
+		problems = append(problems, fmt.Sprintf("expectSchema: %v", err))
+	}
+	return
+}
+
+// validateAPI checks if the API is a path or an absolute HTTP URL, the templates are allowed
+func validateAPI(api string) string {
+	if strings.HasPrefix(api, "{{") {
+		// the base URL comes from the template, such as {{.param.server}}/api
+		return ""
+	}
+	plain := templatePattern.ReplaceAllString(api, "x")
+	if strings.ContainsAny(plain, " \t\r\n") {
+		return fmt.Sprintf("api %q contains whitespace", api)
+	}
+	if strings.HasPrefix(plain, "/") {
+		return ""
+	}
+	u, err := url.Parse(plain)
+	if err != nil {
+		return fmt.Sprintf("api %q is not a valid URL: %v", api, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Sprintf("api %q should be a path starting with / or an absolute http(s) URL", api)
+	}
+	return ""
+}
+
+func validateHeaderNames(field string, headers map[string]string) (problems []string) {
+	for key := range headers {
+		if !headerNamePattern.MatchString(key) {
+			problems = append(problems, fmt.Sprintf("%s has an invalid header name %q", field, key))
+		}
+	}
+	slices.Sort(problems)
+	return
+}
+
+// validateBody checks if the body matches the content type
+func validateBody(body string, headers map[string]string) string {
+	if body == "" {
+		return ""
+	}
+	var contentType string
+	for key, value := range headers {
+		if strings.EqualFold(key, "Content-Type") {
+			contentType = value
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	// the templates are rendered before sending, take them as plain values
+	plain := templatePattern.ReplaceAllString(body, "0")
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if !json.Valid([]byte(plain)) {
+			return fmt.Sprintf("body is not a valid JSON, but the Content-Type is %s", contentType)
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if _, err := url.ParseQuery(plain); err != nil {
+			return fmt.Sprintf("body is not URL encoded, but the Content-Type is %s: %v", contentType, err)
+		}
+	}
+	return ""
+}
+
+// validateTemplate checks the syntax of the {{ }} expressions, the functions are provided by the runner so they are not checked
+func validateTemplate(name, text string) (err error) {
+	if !strings.Contains(text, "{{") {
+		return
+	}
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	_, err = tree.Parse(text, "", "", map[string]*parse.Tree{})
+	return
+}
+
+// invalidResult reports the problems as an error result
+func invalidResult(problems []string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: fmt.Sprintf("the test case is invalid:\n- %s", strings.Join(problems, "\n- "))},
+		},
+	}
+}
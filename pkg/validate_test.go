@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestCreateTestCaseRequestValidate(t *testing.T) {
+	valid := CreateTestCaseRequest{CaseName: "a", API: "/api", Method: "get"}
+	tests := []struct {
+		name     string
+		modify   func(args *CreateTestCaseRequest)
+		problems []string
+	}{
+		{name: "valid", modify: func(*CreateTestCaseRequest) {}},
+		{name: "required", modify: func(args *CreateTestCaseRequest) { *args = CreateTestCaseRequest{} },
+			problems: []string{"caseName is required", "method is required", "api is required"}},
+		{name: "method", modify: func(args *CreateTestCaseRequest) { args.Method = "FETCH" },
+			problems: []string{`method "FETCH" is not one of GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE`}},
+		{name: "template API", modify: func(args *CreateTestCaseRequest) { args.API = "{{.param.server}}/api/{{.id}}" }},
+		{name: "absolute API", modify: func(args *CreateTestCaseRequest) { args.API = "https://example.com/api" }},
+		{name: "relative API", modify: func(args *CreateTestCaseRequest) { args.API = "api/users" },
+			problems: []string{`api "api/users" should be a path starting with / or an absolute http(s) URL`}},
+		{name: "API with whitespace", modify: func(args *CreateTestCaseRequest) { args.API = "/api/ users" },
+			problems: []string{`api "/api/ users" contains whitespace`}},
+		{name: "status", modify: func(args *CreateTestCaseRequest) { args.ExpectStatus = 999 },
+			problems: []string{"expectStatus 999 is not a valid HTTP status code"}},
+		{name: "header names", modify: func(args *CreateTestCaseRequest) {
+			args.Headers = map[string]string{"X Bad": "1", "Good": "1"}
+			args.ExpectHeaders = map[string]string{"a:b": "1"}
+			args.SecretHeaders = map[string]string{"Authorization": ""}
+		}, problems: []string{`headers has an invalid header name "X Bad"`, `expectHeaders has an invalid header name "a:b"`,
+			"secretHeaders[Authorization] should be the name of secret"}},
+		{name: "form and body", modify: func(args *CreateTestCaseRequest) {
+			args.FormParams = map[string]string{"a": "1"}
+			args.Body = "a=1"
+		}, problems: []string{"formParams and body can not be used together"}},
+		{name: "JSON body", modify: func(args *CreateTestCaseRequest) {
+			args.Headers = map[string]string{"content-type": "application/json; charset=utf-8"}
+			args.Body = `{"id": {{.id}}, "name": "{{.name}}"}`
+		}},
+		{name: "invalid JSON body", modify: func(args *CreateTestCaseRequest) {
+			args.Headers = map[string]string{"Content-Type": "application/problem+json"}
+			args.Body = `{"id":`
+		}, problems: []string{"body is not a valid JSON, but the Content-Type is application/problem+json"}},
+		{name: "invalid form body", modify: func(args *CreateTestCaseRequest) {
+			args.Headers = map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+			args.Body = "a=%zz"
+		}, problems: []string{`body is not URL encoded, but the Content-Type is application/x-www-form-urlencoded: invalid URL escape "%zz"`}},
+		{name: "body without content type", modify: func(args *CreateTestCaseRequest) { args.Body = "{" }},
+		{name: "templates", modify: func(args *CreateTestCaseRequest) {
+			args.Body = "{{.id"
+			args.QueryParams = map[string]string{"page": "{{ end }}"}
+			args.Cookies = map[string]string{"token": `{{secretValue "token"}}`}
+		}, problems: []string{"template: body:1: unclosed action", "template: queryParams[page]:1: unexpected {{end}}"}},
+		{name: "schema", modify: func(args *CreateTestCaseRequest) { args.ExpectSchema = `{"type":"text"}` },
+			problems: []string{"expectSchema: invalid JSON schema"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := valid
+			tt.modify(&args)
+			problems := args.Validate()
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("expected problems %q, got %q", tt.problems, problems)
+			}
+			for i, problem := range tt.problems {
+				if !strings.HasPrefix(problems[i], problem) {
+					t.Fatalf("expected problems %q, got %q", tt.problems, problems)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidResult(t *testing.T) {
+	result := invalidResult([]string{"a", "b"})
+	if !result.IsError || !slices.ContainsFunc(result.Content, func(content mcp.Content) bool {
+		return content.(*mcp.TextContent).Text == "the test case is invalid:\n- a\n- b"
+	}) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
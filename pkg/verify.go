@@ -0,0 +1,233 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/file"
+	"github.com/linuxsuren/api-testing/pkg/runner/kubernetes"
+	"github.com/linuxsuren/api-testing/pkg/server"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/grpc"
+)
+
+var (
+	assignPattern   = regexp.MustCompile(`([^=!<>])=([^=~])`)
+	fieldRefPattern = regexp.MustCompile(`\bdata((?:\.[A-Za-z_][A-Za-z0-9_]*)+)`)
+	aliasPattern    = regexp.MustCompile(`\b(body|response|resp|json)\.`)
+	// only the bare variables, the fields such as data.status are not matched
+	extraVarPattern = regexp.MustCompile(`(?:^|[^.\w])(status|headers)\b`)
+	nullPattern     = regexp.MustCompile(`\bnull\b`)
+	literalPattern  = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'`)
+)
+
+type VerifyExpressionsRequest struct {
+	Expressions []string        `json:"expressions" jsonschema:"the verify expressions to evaluate, such as data.name == \"atest\" or len(data.items) > 0"`
+	Suite       string          `json:"suite,omitempty" jsonschema:"the name of test suite, the active suite of the session is used if it is empty"`
+	Testcase    string          `json:"testcase,omitempty" jsonschema:"the test case to run for a fresh response, it is required if the response is empty"`
+	Response    *SampleResponse `json:"response,omitempty" jsonschema:"the response to evaluate against"`
+}
+
+// ExpressionResult is the evaluation result of a verify expression
+type ExpressionResult struct {
+	Expression  string   `json:"expression"`
+	Passed      bool     `json:"passed"`
+	Value       string   `json:"value,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	Line        int      `json:"line,omitempty"`
+	Column      int      `json:"column,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+type VerifyResult struct {
+	StatusCode int32              `json:"statusCode"`
+	Passed     int                `json:"passed"`
+	Failed     int                `json:"failed"`
+	Results    []ExpressionResult `json:"results"`
+}
+
+func (r *gRPCRunner) VerifyExpressions(ctx context.Context, request *mcp.CallToolRequest, args VerifyExpressionsRequest) (
+	result *mcp.CallToolResult, data VerifyResult, err error) {
+	if len(args.Expressions) == 0 {
+		err = errors.New("expressions are required")
+		return
+	}
+
+	response := args.Response
+	if response == nil {
+		if args.Suite == "" {
+			args.Suite = r.session(request).Suite
+		}
+		if args.Suite == "" || args.Testcase == "" {
+			err = errors.New("response, or suite and testcase are required")
+			return
+		}
+
+		var conn grpc.ClientConnInterface
+		if conn, err = r.getConnection(request); err != nil {
+			return
+		}
+		var reply *server.TestCaseResult
+		if reply, err = server.NewRunnerClient(conn).RunTestCase(ctx,
+			&server.TestCaseIdentity{Suite: args.Suite, Testcase: args.Testcase}); err != nil {
+			return
+		}
+		response = &SampleResponse{
+			StatusCode: reply.StatusCode,
+			Headers:    pairsToMap(reply.Header),
+			Body:       reply.Body,
+		}
+	}
+
+	data = verifyExpressions(args.Expressions, response)
+	result = &mcp.CallToolResult{
+		Content: []mcp.Content{
+			&mcp.TextContent{Text: data.String()},
+		},
+	}
+	return
+}
+
+// verifyExpressions evaluates the expressions in the same way as the runner,
+// status and headers are available too but the runner only provides data
+func verifyExpressions(expressions []string, response *SampleResponse) (data VerifyResult) {
+	var body any
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		body = response.Body
+	}
+	headers := map[string]any{}
+	for key, value := range response.Headers {
+		headers[key] = value
+	}
+	env := map[string]any{
+		"data":    body,
+		"status":  int(response.StatusCode),
+		"headers": headers,
+	}
+
+	data.StatusCode = response.StatusCode
+	for _, expression := range expressions {
+		item := evaluateExpression(expression, env)
+		if item.Passed {
+			data.Passed++
+		} else {
+			data.Failed++
+		}
+		data.Results = append(data.Results, item)
+	}
+	return
+}
+
+func evaluateExpression(expression string, env map[string]any) (item ExpressionResult) {
+	item.Expression = expression
+	if match := extraVarPattern.FindStringSubmatch(literalPattern.ReplaceAllString(expression, `""`)); match != nil {
+		item.Suggestions = append(item.Suggestions, fmt.Sprintf(
+			"%s is only available in the playground, the runner provides data only, use expectStatus or expectHeaders instead", match[1]))
+	}
+
+	program, err := expr.Compile(expression, expr.Env(env), expr.AsBool(),
+		kubernetes.PodValidatorFunc(), kubernetes.KubernetesValidatorFunc())
+	if err == nil {
+		var value any
+		if value, err = expr.Run(program, env); err == nil {
+			item.Passed, _ = value.(bool)
+			item.Value = fmt.Sprint(value)
+			if !item.Passed {
+				item.Suggestions = append(item.Suggestions, suggestValues(expression, env["data"])...)
+			}
+			return
+		}
+	}
+
+	item.Error = err.Error()
+	var exprErr *file.Error
+	if errors.As(err, &exprErr) {
+		item.Line, item.Column = exprErr.Line, exprErr.Column+1
+	}
+	if strings.Contains(item.Error, "expected bool") {
+		item.Suggestions = append(item.Suggestions, "the expression should return a boolean, compare the value such as "+expression+" == <expected>")
+	}
+	item.Suggestions = append(item.Suggestions, suggestExpression(expression)...)
+	item.Suggestions = append(item.Suggestions, suggestValues(expression, env["data"])...)
+	return
+}
+
+// suggestExpression finds the common mistakes of the expression which fails to compile
+func suggestExpression(expression string) (suggestions []string) {
+	code := literalPattern.ReplaceAllString(expression, `""`)
+	if strings.Contains(code, "===") || strings.Contains(code, "!==") {
+		suggestions = append(suggestions, "use == and != instead of === and !==")
+	} else if assignPattern.MatchString(code) {
+		suggestions = append(suggestions, "use == for comparison instead of =")
+	}
+	if nullPattern.MatchString(code) {
+		suggestions = append(suggestions, "use nil instead of null")
+	}
+	if match := aliasPattern.FindStringSubmatch(code); match != nil {
+		suggestions = append(suggestions, fmt.Sprintf("the response body is named data, use data. instead of %s.", match[1]))
+	}
+	return
+}
+
+// suggestValues points out the fields which don't exist, and the similar ones
+func suggestValues(expression string, body any) (suggestions []string) {
+	if _, ok := body.([]any); ok && fieldRefPattern.MatchString(expression) {
+		suggestions = append(suggestions, "the response body is an array, access the items by index such as data[0] or use len(data)")
+		return
+	}
+	for _, match := range fieldRefPattern.FindAllStringSubmatch(expression, -1) {
+		current := body
+		path := "data"
+		for _, key := range strings.Split(strings.TrimPrefix(match[1], "."), ".") {
+			object, ok := current.(map[string]any)
+			if !ok {
+				break
+			}
+			value, ok := object[key]
+			if !ok {
+				suggestion := fmt.Sprintf("%s has no field %s", path, key)
+				keys := make([]string, 0, len(object))
+				for k := range object {
+					if strings.EqualFold(k, key) {
+						suggestion += fmt.Sprintf(", did you mean %s.%s", path, k)
+					}
+					keys = append(keys, k)
+				}
+				slices.Sort(keys)
+				if len(keys) > 0 {
+					suggestion += fmt.Sprintf(", the fields are: %s", strings.Join(keys, ", "))
+				}
+				suggestions = append(suggestions, suggestion)
+				break
+			}
+			current, path = value, path+"."+key
+		}
+	}
+	return
+}
+
+// String renders the results in a readable way
+func (v VerifyResult) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "status: %d, %d passed, %d failed\n", v.StatusCode, v.Passed, v.Failed)
+	for _, item := range v.Results {
+		switch {
+		case item.Error != "":
+			fmt.Fprintf(&buf, "\nERROR %s\n%s\n", item.Expression, item.Error)
+		case item.Passed:
+			fmt.Fprintf(&buf, "\nPASS  %s\n", item.Expression)
+		default:
+			fmt.Fprintf(&buf, "\nFAIL  %s\n", item.Expression)
+		}
+		for _, suggestion := range item.Suggestions {
+			fmt.Fprintf(&buf, "  hint: %s\n", suggestion)
+		}
+	}
+	return buf.String()
+}
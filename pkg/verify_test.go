@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVerifyExpressions(t *testing.T) {
+	response := &SampleResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"name":"atest","status":"ok","headers":{},"Items":[1,2]}`,
+	}
+	playground := "is only available in the playground, the runner provides data only, use expectStatus or expectHeaders instead"
+	tests := []struct {
+		name        string
+		expression  string
+		body        string
+		passed      bool
+		err         string
+		line        int
+		column      int
+		suggestions []string
+	}{
+		{name: "passed", expression: `data.name == "atest"`, passed: true},
+		{name: "field named status", expression: `data.status == "ok"`, passed: true},
+		{name: "field named headers", expression: `data.headers != nil && data?.status != ""`, passed: true},
+		{name: "literal status", expression: `data.name != "status"`, passed: true},
+		{name: "index named status", expression: `data["status"] == "ok"`, passed: true},
+		{name: "status variable", expression: `status == 200`, passed: true, suggestions: []string{"status " + playground}},
+		{name: "headers variable", expression: `len(headers) > 0 && data.name != ""`, passed: true,
+			suggestions: []string{"headers " + playground}},
+		{name: "missing field", expression: `data.items != nil`,
+			suggestions: []string{"data has no field items, did you mean data.Items, the fields are: Items, headers, name, status"}},
+		{name: "multiple lines", expression: "data.name == \"atest\" &&\n  data.x != nil",
+			suggestions: []string{"data has no field x, the fields are: Items, headers, name, status"}},
+		{name: "array body", expression: `data.name == "atest"`, body: `[{"name":"atest"}]`, err: "array elements",
+			line: 1, column: 6, suggestions: []string{"the response body is an array, access the items by index such as data[0] or use len(data)"}},
+		{name: "strict equality", expression: `data.name === "atest"`, err: "unexpected token", line: 1, column: 13,
+			suggestions: []string{"use == and != instead of === and !=="}},
+		{name: "assignment", expression: `data.name = "atest"`, err: "unexpected token", line: 1, column: 11,
+			suggestions: []string{"use == for comparison instead of ="}},
+		{name: "assignment in literal", expression: `data.name == "a=b"`},
+		{name: "null", expression: `data.name == null`, err: "unknown name null", line: 1, column: 14,
+			suggestions: []string{"use nil instead of null"}},
+		{name: "alias", expression: `body.name == "atest"`, err: "unknown name body", line: 1, column: 1,
+			suggestions: []string{"the response body is named data, use data. instead of body."}},
+		{name: "not boolean", expression: `data.name`, err: "expected bool",
+			suggestions: []string{"the expression should return a boolean, compare the value such as data.name == <expected>"}},
+		{name: "incomplete", expression: `data.name ==`, err: "unexpected token EOF", line: 1, column: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sample := *response
+			if tt.body != "" {
+				sample.Body = tt.body
+			}
+			data := verifyExpressions([]string{tt.expression}, &sample)
+			item := data.Results[0]
+			if item.Passed != tt.passed || !strings.Contains(item.Error, tt.err) || (tt.err == "") != (item.Error == "") {
+				t.Fatalf("expected passed %v with error %q, got %+v", tt.passed, tt.err, item)
+			}
+			if item.Line != tt.line || item.Column != tt.column {
+				t.Fatalf("expected the position %d:%d, got %d:%d", tt.line, tt.column, item.Line, item.Column)
+			}
+			if !slices.Equal(item.Suggestions, tt.suggestions) {
+				t.Fatalf("expected suggestions %q, got %q", tt.suggestions, item.Suggestions)
+			}
+			if passed := data.Passed == 1; passed != tt.passed || data.Passed+data.Failed != 1 {
+				t.Fatalf("unexpected counts %d passed, %d failed", data.Passed, data.Failed)
+			}
+		})
+	}
+}
+
+func TestVerifyResultString(t *testing.T) {
+	data := verifyExpressions([]string{`data.name == "atest"`, `data.name == "other"`, `data.name ==`, `status == 200`},
+		&SampleResponse{StatusCode: 200, Body: `{"name":"atest"}`})
+	expected := []string{
+		"status: 200, 2 passed, 2 failed",
+		`PASS  data.name == "atest"`,
+		`FAIL  data.name == "other"`,
+		"ERROR data.name ==",
+		"  hint: status is only available in the playground",
+	}
+	text := data.String()
+	for _, line := range expected {
+		if !strings.Contains(text, line) {
+			t.Fatalf("expected %q in %q", line, text)
+		}
+	}
+}